@@ -0,0 +1,317 @@
+// Package env is a gym-style learning environment over the machine package: agents reset a game, step it with
+// actions and get observations, rewards and episode ends read from the RAM of the game, as fast as the host runs.
+package env
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/cterence/goarcade/machine"
+)
+
+// Observation is what the agent sees of the game.
+type Observation string
+
+const (
+	// The upright screen, one byte per pixel
+	OBS_FRAME Observation = "frame"
+	// The work RAM of the game
+	OBS_RAM Observation = "ram"
+
+	// Work RAM observed, without the video RAM
+	RAM_SIZE = machine.VRAM_START - machine.RAM_START
+
+	DEFAULT_FRAME_SKIP = 4
+	// Frames an input is held, then released, when starting a game
+	START_HOLD_FRAMES = 5
+	// Frames given to the game to start once its start inputs are pressed
+	MAX_START_FRAMES = 1200
+)
+
+var Observations = []Observation{OBS_FRAME, OBS_RAM}
+
+var ErrNoEnv = errors.New("no env definition for game")
+
+type Env struct {
+	m *machine.Machine
+	// Env definition of the game
+	def *machine.Env
+
+	observation Observation
+	frameSkip   int
+	maxFrames   int
+
+	actions [][]string
+	// Inputs pressed by the last action
+	pressed []string
+
+	// Machine state once a game is started, restored by every reset
+	start []uint8
+
+	score  int
+	frames int
+	obs    []uint8
+}
+
+// Step is the result of a reset or of an action.
+type Step struct {
+	// Reused by the next step
+	Observation []uint8
+	// Score won during the step
+	Reward int
+	Done   bool
+	// Set when the episode ended on the frame limit and not in the game
+	Truncated bool
+	Info      Info
+}
+
+type Info struct {
+	Score int `json:"score"`
+	Lives int `json:"lives"`
+	// Frames run since the reset
+	Frame int `json:"frame"`
+}
+
+type Option func(*Env)
+
+// WithObservation selects the screen or the RAM as observation, the screen by default.
+func WithObservation(o Observation) Option {
+	return func(e *Env) {
+		e.observation = o
+	}
+}
+
+// WithFrameSkip sets the frames run by a step with the action held.
+func WithFrameSkip(frames int) Option {
+	return func(e *Env) {
+		e.frameSkip = frames
+	}
+}
+
+// WithMaxFrames truncates the episodes after a number of frames, 0 for no limit.
+func WithMaxFrames(frames int) Option {
+	return func(e *Env) {
+		e.maxFrames = frames
+	}
+}
+
+// New makes an environment of the game loaded in m, its spec must have an env definition.
+func New(m *machine.Machine, options ...Option) (*Env, error) {
+	g := m.Game()
+	if g == nil {
+		return nil, errors.New("env needs a game archive")
+	}
+
+	if g.Env == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNoEnv, g.Name)
+	}
+
+	e := &Env{
+		m:           m,
+		def:         g.Env,
+		observation: OBS_FRAME,
+		frameSkip:   DEFAULT_FRAME_SKIP,
+		actions:     g.Env.Actions,
+	}
+
+	for _, o := range options {
+		o(e)
+	}
+
+	if !slices.Contains(Observations, e.observation) {
+		return nil, fmt.Errorf("unknown observation %s, available: %v", e.observation, Observations)
+	}
+
+	if e.frameSkip < 1 {
+		return nil, fmt.Errorf("frame skip %d is lower than 1", e.frameSkip)
+	}
+
+	return e, nil
+}
+
+// Actions returns the inputs pressed by each action, actions are their index.
+func (e *Env) Actions() [][]string {
+	return e.actions
+}
+
+func (e *Env) Observation() Observation {
+	return e.observation
+}
+
+// Shape returns the dimensions of the observations, rows first.
+func (e *Env) Shape() []int {
+	if e.observation == OBS_RAM {
+		return []int{int(RAM_SIZE)}
+	}
+
+	return []int{machine.HEIGHT, machine.WIDTH}
+}
+
+func (e *Env) FrameSkip() int {
+	return e.frameSkip
+}
+
+// Reset starts a new game. The first reset boots the game and presses its start inputs, the next ones restore
+// the machine as it was then.
+func (e *Env) Reset() (Step, error) {
+	if e.start == nil {
+		if err := e.startGame(); err != nil {
+			return Step{}, err
+		}
+	} else if err := e.m.LoadState(bytes.NewReader(e.start)); err != nil {
+		return Step{}, err
+	}
+
+	e.m.AudioEvents()
+
+	e.pressed = nil
+	e.frames = 0
+	e.score = e.read(e.def.Score)
+
+	return Step{Observation: e.observe(), Info: e.info()}, nil
+}
+
+// Step holds the inputs of an action for the frame skip, or until the episode ends.
+func (e *Env) Step(action int) (Step, error) {
+	if e.start == nil {
+		return Step{}, errors.New("env stepped before its first reset")
+	}
+
+	if action < 0 || action >= len(e.actions) {
+		return Step{}, fmt.Errorf("action %d is out of range (0-%d)", action, len(e.actions)-1)
+	}
+
+	if err := e.press(e.actions[action]); err != nil {
+		return Step{}, err
+	}
+
+	var s Step
+
+	for range e.frameSkip {
+		e.m.RunFrame()
+		e.frames++
+
+		if s.Done = !e.playing(); s.Done {
+			break
+		}
+
+		if s.Truncated = e.maxFrames > 0 && e.frames >= e.maxFrames; s.Truncated {
+			s.Done = true
+
+			break
+		}
+	}
+
+	// Sounds are not part of the observations
+	e.m.AudioEvents()
+
+	score := e.read(e.def.Score)
+	s.Reward = score - e.score
+	e.score = score
+
+	s.Observation = e.observe()
+	s.Info = e.info()
+
+	return s, nil
+}
+
+// startGame reloads the game, presses its start inputs in turn and waits for the game to start.
+func (e *Env) startGame() error {
+	if err := e.m.PowerOn(); err != nil {
+		return err
+	}
+
+	for _, name := range e.def.Start {
+		for _, pressed := range []bool{true, false} {
+			if err := e.m.SetInput(name, pressed); err != nil {
+				return err
+			}
+
+			for range START_HOLD_FRAMES {
+				e.m.RunFrame()
+			}
+		}
+	}
+
+	for range MAX_START_FRAMES {
+		if e.playing() {
+			var b bytes.Buffer
+
+			if err := e.m.SaveState(&b); err != nil {
+				return err
+			}
+
+			e.start = b.Bytes()
+
+			return nil
+		}
+
+		e.m.RunFrame()
+	}
+
+	return fmt.Errorf("game did not start after %d frames", MAX_START_FRAMES)
+}
+
+// press releases the inputs of the last action which are not part of the new one, and presses the new ones.
+func (e *Env) press(inputs []string) error {
+	for _, name := range e.pressed {
+		if !slices.Contains(inputs, name) {
+			if err := e.m.SetInput(name, false); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, name := range inputs {
+		if err := e.m.SetInput(name, true); err != nil {
+			return err
+		}
+	}
+
+	e.pressed = inputs
+
+	return nil
+}
+
+// playing reports whether the game is played, from its playing flag or else from its lives.
+func (e *Env) playing() bool {
+	if !e.m.Running() {
+		return false
+	}
+
+	if e.def.Playing != nil {
+		return e.read(e.def.Playing) != 0
+	}
+
+	return e.read(e.def.Lives) > 0
+}
+
+func (e *Env) read(v *machine.RAMValue) int {
+	if v == nil {
+		return 0
+	}
+
+	return e.m.ReadValue(*v)
+}
+
+func (e *Env) observe() []uint8 {
+	if e.observation == OBS_FRAME {
+		return e.m.Frame().Pix
+	}
+
+	if e.obs == nil {
+		e.obs = make([]uint8, RAM_SIZE)
+	}
+
+	for i := range e.obs {
+		e.obs[i] = e.m.Read(machine.RAM_START + uint16(i))
+	}
+
+	return e.obs
+}
+
+func (e *Env) info() Info {
+	return Info{Score: e.score, Lives: e.read(e.def.Lives), Frame: e.frames}
+}
@@ -0,0 +1,133 @@
+package env
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cterence/goarcade/internal/arcade/lib"
+	"github.com/cterence/goarcade/internal/gametest"
+	"github.com/cterence/goarcade/machine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Starts playing on coin, then scores 42 and ends the game on fire
+var program = []uint8{
+	0xDB, 0x01, // in 1
+	0xE6, 0x01, // ani 01h
+	0xCA, 0x00, 0x00, // jz 0000h
+	0x3E, 0x01, // mvi a,01h
+	0x32, 0x00, 0x20, // sta 2000h
+	0xDB, 0x01, // in 1
+	0xE6, 0x10, // ani 10h
+	0xCA, 0x0C, 0x00, // jz 000ch
+	0x3E, 0x00, // mvi a,00h
+	0x32, 0x00, 0x20, // sta 2000h
+	0x3E, 0x42, // mvi a,42h
+	0x32, 0x01, 0x20, // sta 2001h
+	0xC3, 0x1D, 0x00, // jmp 001dh
+}
+
+func newEnv(t *testing.T, options ...Option) *Env {
+	archive, config := gametest.Game(t, program, "env:\n  score: { addr: 0x2001, bcd: true }\n  playing: { addr: 0x2000 }\n")
+
+	m := machine.New()
+	require.NoError(t, m.Load(archive, config, "game.zip"))
+
+	e, err := New(m, options...)
+	require.NoError(t, err)
+
+	return e
+}
+
+func Test_Env(t *testing.T) {
+	t.Run("episodes", func(t *testing.T) {
+		e := newEnv(t)
+		assert.Equal(t, [][]string{{}, {"p1_fire"}, {"p1_left"}, {"p1_right"}}, e.Actions())
+
+		for range 2 {
+			s, err := e.Reset()
+			require.NoError(t, err)
+			assert.Len(t, s.Observation, machine.WIDTH*machine.HEIGHT)
+			assert.Equal(t, Info{}, s.Info)
+
+			s, err = e.Step(0)
+			require.NoError(t, err)
+			assert.False(t, s.Done)
+			assert.Equal(t, 0, s.Reward)
+
+			s, err = e.Step(1)
+			require.NoError(t, err)
+			assert.True(t, s.Done)
+			assert.False(t, s.Truncated)
+			assert.Equal(t, 42, s.Reward)
+			assert.Equal(t, Info{Score: 42, Frame: DEFAULT_FRAME_SKIP + 1}, s.Info)
+		}
+	})
+
+	t.Run("truncated episodes", func(t *testing.T) {
+		e := newEnv(t, WithMaxFrames(6), WithObservation(OBS_RAM))
+
+		s, err := e.Reset()
+		require.NoError(t, err)
+		assert.Equal(t, uint8(1), s.Observation[0])
+
+		_, err = e.Step(0)
+		require.NoError(t, err)
+
+		s, err = e.Step(0)
+		require.NoError(t, err)
+		assert.True(t, s.Done)
+		assert.True(t, s.Truncated)
+		assert.Equal(t, 6, s.Info.Frame)
+
+		_, err = e.Step(4)
+		assert.Error(t, err)
+	})
+}
+
+func Test_Serve(t *testing.T) {
+	ln, err := Listen("127.0.0.1:0")
+	require.NoError(t, err)
+
+	e := newEnv(t)
+	ctx, cancel := context.WithCancel(t.Context())
+	served := make(chan error)
+
+	go func() {
+		served <- Serve(ctx, ln, func() (*Env, error) { return e, nil })
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer lib.DeferErr(conn.Close)
+
+	r := bufio.NewReader(conn)
+
+	_, err = conn.Write([]uint8(`{"cmd": "spec"}` + "\n"))
+	require.NoError(t, err)
+
+	line, err := r.ReadBytes('\n')
+	require.NoError(t, err)
+
+	var spec SpecResponse
+	require.NoError(t, json.Unmarshal(line, &spec))
+	assert.Equal(t, e.Actions(), spec.Actions)
+
+	cancel()
+
+	select {
+	case err := <-served:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the server still serves its client")
+	}
+
+	_, err = r.ReadBytes('\n')
+	assert.ErrorIs(t, err, io.EOF, "the client is disconnected")
+}
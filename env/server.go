@@ -0,0 +1,190 @@
+package env
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/cterence/goarcade/internal/arcade/lib"
+)
+
+// Request is a line sent by a client: {"cmd": "spec"}, {"cmd": "reset"} or {"cmd": "step", "action": 1}.
+type Request struct {
+	Cmd    string `json:"cmd"`
+	Action int    `json:"action"`
+}
+
+// SpecResponse answers spec requests.
+type SpecResponse struct {
+	Actions     [][]string  `json:"actions"`
+	Observation Observation `json:"observation"`
+	Shape       []int       `json:"shape"`
+	FrameSkip   int         `json:"frameSkip"`
+}
+
+// StepResponse answers reset and step requests, observations are encoded in base64.
+type StepResponse struct {
+	Observation []uint8 `json:"observation"`
+	Reward      int     `json:"reward"`
+	Done        bool    `json:"done"`
+	Truncated   bool    `json:"truncated"`
+	Info        Info    `json:"info"`
+}
+
+// ErrorResponse answers invalid requests.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// Listen listens on a TCP address, or on a unix socket path prefixed with unix:.
+func Listen(addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		return net.Listen("unix", path)
+	}
+
+	return net.Listen("tcp", addr)
+}
+
+// Serve answers JSON line requests until the context is done, then disconnects the clients and returns once
+// their environments stopped. Each connection has its own environment, so that agents can be trained in
+// parallel. Client errors are logged, they do not stop the server.
+func Serve(ctx context.Context, ln net.Listener, newEnv func() (*Env, error)) error {
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+		// Closes the connection of each client, set to nil once the server stops
+		conns = map[net.Conn]func() error{}
+	)
+
+	// Disconnects the clients before waiting for them
+	defer wg.Wait()
+
+	shutdown := sync.OnceFunc(func() {
+		if err := ln.Close(); err != nil {
+			log.Printf("failed to close env listener: %s", err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		for _, closeConn := range conns {
+			// Reported by the client goroutine
+			_ = closeConn()
+		}
+
+		conns = nil
+	})
+	defer shutdown()
+
+	stop := context.AfterFunc(ctx, shutdown)
+	defer stop()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return fmt.Errorf("failed to accept env client: %w", err)
+		}
+
+		closeConn := sync.OnceValue(conn.Close)
+
+		mu.Lock()
+
+		if conns == nil {
+			mu.Unlock()
+			lib.DeferErr(closeConn)
+
+			continue
+		}
+
+		conns[conn] = closeConn
+		mu.Unlock()
+
+		wg.Go(func() {
+			defer func() {
+				mu.Lock()
+				defer mu.Unlock()
+
+				delete(conns, conn)
+			}()
+			defer lib.DeferErr(closeConn)
+
+			if err := serveConn(conn, newEnv); err != nil && !errors.Is(err, net.ErrClosed) {
+				log.Printf("env client %s: %s", conn.RemoteAddr(), err)
+			}
+		})
+	}
+}
+
+func serveConn(conn net.Conn, newEnv func() (*Env, error)) error {
+	e, err := newEnv()
+	if err != nil {
+		_ = json.NewEncoder(conn).Encode(ErrorResponse{Error: err.Error()})
+
+		return err
+	}
+
+	scanner := bufio.NewScanner(conn)
+	w := bufio.NewWriter(conn)
+	enc := json.NewEncoder(w)
+
+	for scanner.Scan() {
+		var (
+			req Request
+			res any
+		)
+
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			res = ErrorResponse{Error: "invalid request: " + err.Error()}
+		} else {
+			res = e.handle(req)
+		}
+
+		if err := enc.Encode(res); err != nil {
+			return err
+		}
+
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil && !errors.Is(err, net.ErrClosed) {
+		return err
+	}
+
+	return nil
+}
+
+func (e *Env) handle(req Request) any {
+	var (
+		s   Step
+		err error
+	)
+
+	switch req.Cmd {
+	case "spec":
+		return SpecResponse{Actions: e.Actions(), Observation: e.Observation(), Shape: e.Shape(), FrameSkip: e.FrameSkip()}
+	case "reset":
+		s, err = e.Reset()
+	case "step":
+		s, err = e.Step(req.Action)
+	default:
+		err = fmt.Errorf("unknown command %q, available: spec, reset, step", req.Cmd)
+	}
+
+	if err != nil {
+		return ErrorResponse{Error: err.Error()}
+	}
+
+	return StepResponse{Observation: s.Observation, Reward: s.Reward, Done: s.Done, Truncated: s.Truncated, Info: s.Info}
+}
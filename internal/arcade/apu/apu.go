@@ -1,7 +1,10 @@
 package apu
 
 import (
+	"bytes"
 	"fmt"
+	"os"
+	"sync"
 	"time"
 
 	"github.com/Zyko0/go-sdl3/sdl"
@@ -10,16 +13,35 @@ import (
 type APU struct {
 	SoundListBytes [][]uint8
 
-	streams  []*sdl.AudioStream
+	streams []*sdl.AudioStream
+	// Decoded sounds, and the same sounds scaled to the volume
+	wavs     [][]uint8
 	sounds   [][]uint8
+	soundsMu sync.RWMutex
 	looping  []bool
 	loopStop []chan struct{}
 	device   sdl.AudioDeviceID
+
+	// Volume in percent
+	volume int
+
+	// Plays a stream of silence which paces the emulation, for the audio sync
+	Clock bool
+	clock *sdl.AudioStream
+	// Fraction of a sample left to queue in the clock stream
+	clockSamples float64
 }
 
+const (
+	MAX_VOLUME  = 100
+	SAMPLE_RATE = 11025
+	// Level of silence in unsigned 8 bit samples
+	SILENCE = 128
+)
+
 func (a *APU) Init() {
 	if len(a.SoundListBytes) == 0 {
-		fmt.Println("warning: sound files not loaded, audio disabled")
+		fmt.Fprintln(os.Stderr, "warning: sound files not loaded, audio disabled")
 
 		return
 	}
@@ -32,7 +54,7 @@ func (a *APU) Init() {
 	spec := &sdl.AudioSpec{
 		Format:   sdl.AUDIO_U8,
 		Channels: 1,
-		Freq:     11025,
+		Freq:     SAMPLE_RATE,
 	}
 
 	a.device, err = sdl.AUDIO_DEVICE_DEFAULT_PLAYBACK.OpenAudioDevice(spec)
@@ -41,6 +63,7 @@ func (a *APU) Init() {
 	}
 
 	a.streams = make([]*sdl.AudioStream, len(a.SoundListBytes))
+	a.wavs = make([][]uint8, len(a.SoundListBytes))
 	a.sounds = make([][]uint8, len(a.SoundListBytes))
 	a.looping = make([]bool, len(a.SoundListBytes))
 	a.loopStop = make([]chan struct{}, len(a.SoundListBytes))
@@ -56,8 +79,7 @@ func (a *APU) Init() {
 			panic("failed to load WAV file: " + err.Error())
 		}
 
-		// Downscale volume at 33% to allow 3 sounds to play simultaneously without audio clipping
-		a.sounds[i] = scaleVolume(soundData, 0.33)
+		a.wavs[i] = soundData
 
 		if a.streams[i] == nil {
 			a.streams[i], err = sdl.CreateAudioStream(spec, spec)
@@ -73,9 +95,76 @@ func (a *APU) Init() {
 		}
 	}
 
+	// The clock stream follows the device opened on each init
+	if a.Clock {
+		if a.clock != nil {
+			a.clock.Destroy()
+		}
+
+		a.clock, err = sdl.CreateAudioStream(spec, spec)
+		if err != nil {
+			panic("failed to create clock audio stream: " + err.Error())
+		}
+
+		if err := a.device.BindAudioStream(a.clock); err != nil {
+			panic("failed to bind clock audio stream to device: " + err.Error())
+		}
+	}
+
+	a.SetVolume(a.volume)
 	a.TogglePauseAudio(false)
 }
 
+// Clocked reports whether the clock stream plays, it needs the audio device opened for the sounds.
+func (a *APU) Clocked() bool {
+	return a.clock != nil
+}
+
+// Queued returns the playback time of the silence left in the clock stream.
+func (a *APU) Queued() time.Duration {
+	queued, err := a.clock.Queued()
+	if err != nil {
+		panic("failed to get queued clock bytes: " + err.Error())
+	}
+
+	return time.Duration(queued) * time.Second / SAMPLE_RATE
+}
+
+// QueueSilence appends d of silence to the clock stream.
+func (a *APU) QueueSilence(d time.Duration) {
+	a.clockSamples += d.Seconds() * SAMPLE_RATE
+	samples := int(a.clockSamples)
+	a.clockSamples -= float64(samples)
+
+	if err := a.clock.PutData(bytes.Repeat([]uint8{SILENCE}, samples)); err != nil {
+		panic("failed to put silence to clock stream: " + err.Error())
+	}
+}
+
+func (a *APU) Volume() int {
+	return a.volume
+}
+
+// SetVolume sets the volume in percent, clamped to 0-100.
+func (a *APU) SetVolume(volume int) {
+	a.volume = min(max(volume, 0), MAX_VOLUME)
+
+	a.soundsMu.Lock()
+	defer a.soundsMu.Unlock()
+
+	for i, wav := range a.wavs {
+		// Downscale volume at 33% to allow 3 sounds to play simultaneously without audio clipping
+		a.sounds[i] = scaleVolume(wav, 0.33*float64(a.volume)/MAX_VOLUME)
+	}
+}
+
+func (a *APU) sound(soundIndex uint8) []uint8 {
+	a.soundsMu.RLock()
+	defer a.soundsMu.RUnlock()
+
+	return a.sounds[soundIndex]
+}
+
 func (a *APU) TogglePauseAudio(pause bool) {
 	if a.streams == nil {
 		return
@@ -96,6 +185,10 @@ func (a *APU) Close() {
 	for _, s := range a.streams {
 		s.Destroy()
 	}
+
+	if a.clock != nil {
+		a.clock.Destroy()
+	}
 }
 
 func (a *APU) PlaySound(soundIndex uint8) {
@@ -108,7 +201,7 @@ func (a *APU) PlaySound(soundIndex uint8) {
 		panic("failed to get available audio stream: " + err.Error())
 	}
 
-	sound := a.sounds[soundIndex]
+	sound := a.sound(soundIndex)
 
 	if available < int32(len(sound)) {
 		err := a.streams[soundIndex].PutData(sound)
@@ -128,7 +221,6 @@ func (a *APU) StartSoundLoop(soundIndex uint8) {
 
 	go func() {
 		stream := a.streams[soundIndex]
-		sound := a.sounds[soundIndex]
 
 		for {
 			select {
@@ -144,6 +236,8 @@ func (a *APU) StartSoundLoop(soundIndex uint8) {
 					panic("failed to get queued bytes: " + err.Error())
 				}
 
+				// Read the sound on each loop so that volume changes apply to playing loops
+				sound := a.sound(soundIndex)
 				if queued < int32(len(sound)) {
 					if err := stream.PutData(sound); err != nil {
 						panic(err)
@@ -165,6 +259,17 @@ func (a *APU) StopSoundLoop(soundIndex uint8) {
 	a.looping[soundIndex] = false
 }
 
+// StopSounds stops the sound loops and drops the queued sounds.
+func (a *APU) StopSounds() {
+	for i, s := range a.streams {
+		a.StopSoundLoop(uint8(i))
+
+		if err := s.Clear(); err != nil {
+			panic("failed to clear audio stream: " + err.Error())
+		}
+	}
+}
+
 func scaleVolume(data []byte, scale float64) []byte {
 	scaled := make([]byte, len(data))
 	for i, sample := range data {
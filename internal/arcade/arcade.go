@@ -1,67 +1,106 @@
 package arcade
 
 import (
-	"archive/zip"
-	"bytes"
 	"context"
-	"encoding/gob"
 	"errors"
 	"fmt"
-	"io"
 	_ "net/http/pprof"
 	"os"
-	"os/signal"
 	"path/filepath"
 	"slices"
 	"strings"
-	"syscall"
-	"time"
 
 	"github.com/Zyko0/go-sdl3/bin/binsdl"
 	"github.com/cterence/goarcade/internal/arcade/apu"
 	"github.com/cterence/goarcade/internal/arcade/config"
 	"github.com/cterence/goarcade/internal/arcade/cpu"
 	"github.com/cterence/goarcade/internal/arcade/lib"
-	"github.com/cterence/goarcade/internal/arcade/memory"
+	"github.com/cterence/goarcade/internal/arcade/netplay"
+	"github.com/cterence/goarcade/internal/arcade/pacing"
+	"github.com/cterence/goarcade/internal/arcade/spectate"
 	"github.com/cterence/goarcade/internal/arcade/ui"
+	"github.com/cterence/goarcade/machine"
 )
 
-const (
-	CPU_TPS           = 2_000_000
-	FPS               = 60
-	CPU_TPS_PER_FRAME = CPU_TPS / FPS
-)
+// The machines of netplay sessions and spectators only change with the inputs received
+var errRemote = errors.New("not available in netplay and spectator mode")
+
+// remote sets the inputs of every frame from the network, and receives the inputs of the UI in their place.
+type remote interface {
+	Poll() error
+	Begin() (bool, error)
+	SendInput(port, bit uint8, pressed bool)
+	ReadPort(port uint8) uint8
+}
 
 type arcade struct {
-	cpu    *cpu.CPU
-	memory *memory.Memory
-	ui     *ui.UI
-	apu    *apu.APU
-	cancel context.CancelFunc
+	machine *machine.Machine
+	ui      *ui.UI
+	apu     *apu.APU
+	cancel  context.CancelFunc
 
 	saveState string
 
 	romPath string
+	// Config the game of the machine was loaded with, for the UI parts of its spec
+	configBytes []uint8
+
+	// Options of the machines created by the launcher
+	machineOpts []machine.Option
+	debug       bool
+
+	// Screen orientation from the command line, applied over the game display config
+	rotation uint16
+	flipX    bool
+	flipY    bool
+	cocktail bool
 
-	cpuOpts []cpu.Option
+	// Window options, applied to the UI before its window is created
+	scale         int
+	monitorAspect bool
 
-	cpm        bool
 	headless   bool
 	unthrottle bool
 	mute       bool
+
+	// Set when the whole emulator is shut down, and not only the game
+	quit bool
+
+	// Emulation speed in percent, raised to MAX_SPEED while fast forwarding
+	speed       int
+	fastForward bool
+	// Percent of a frame left to run, carried over pacer steps below 100% speed
+	credit int
+	// Frames to run while paused
+	advance int
+
+	// Timing source of the emulation, and its pacer for the running game
+	sync  pacing.Mode
+	pacer *pacing.Pacer
+
+	// Address of the remote control, and its server shared by the games of the launcher
+	serve  string
+	server *server
+
+	// Netplay session or spectated game, which receives the inputs of the UI
+	remote remote
+	// Server streaming the game to spectators
+	spectators *spectate.Server
 }
 
 type Option func(*arcade)
 
+// WithDebug prints the pacing stats when the game stops.
 func WithDebug(debug bool) Option {
 	return func(a *arcade) {
-		a.cpuOpts = append(a.cpuOpts, cpu.WithDebug(debug))
+		a.debug = debug
 	}
 }
 
-func WithCPM(cpm bool) Option {
+// WithMachine sets the options of the machines created for the games of the launcher.
+func WithMachine(options ...machine.Option) Option {
 	return func(a *arcade) {
-		a.cpm = cpm
+		a.machineOpts = options
 	}
 }
 
@@ -83,153 +122,246 @@ func WithUnthrottle(unthrottle bool) Option {
 	}
 }
 
-func WithSaveState(saveState string) Option {
+// WithRotation turns the screen clockwise by a multiple of 90 degrees, on top of the game rotation.
+func WithRotation(rotation uint16) Option {
 	return func(a *arcade) {
-		a.saveState = saveState
+		a.rotation = rotation
 	}
 }
 
-func Run(ctx context.Context, romBytes []uint8, configBytes []uint8, soundListBytes [][]uint8, romPath string, options ...Option) error {
-	aCtx, cancel := context.WithCancel(ctx)
-	defer cancel()
+// WithFlip mirrors the screen horizontally or vertically, after its rotation.
+func WithFlip(flipX, flipY bool) Option {
+	return func(a *arcade) {
+		a.flipX = flipX
+		a.flipY = flipY
+	}
+}
 
-	if len(romBytes) == 0 {
-		return errors.New("no rom passed to emulator")
+// WithCocktail flips the screen when the game sets its cocktail flip bit, for the player 2 of a cocktail cabinet.
+func WithCocktail(cocktail bool) Option {
+	return func(a *arcade) {
+		a.cocktail = cocktail
 	}
+}
 
-	a := arcade{
-		cpu:     &cpu.CPU{},
-		memory:  &memory.Memory{},
-		ui:      &ui.UI{},
-		apu:     &apu.APU{},
-		cancel:  cancel,
-		romPath: romPath,
+// WithScale sizes the window to a multiple of the screen size, instead of its saved size.
+func WithScale(scale int) Option {
+	return func(a *arcade) {
+		a.scale = scale
 	}
+}
 
-	a.cpu.Bus = a.memory
-	a.cpu.APU = a.apu
+// WithMonitorAspect shows the screen at the 4:3 aspect of the arcade monitor instead of square pixels.
+func WithMonitorAspect(monitorAspect bool) Option {
+	return func(a *arcade) {
+		a.monitorAspect = monitorAspect
+	}
+}
 
-	a.ui.Arcade = &a
-	a.ui.Bus = a.memory
-	a.ui.CPU = a.cpu
-	a.ui.APU = a.apu
+// WithSpeed sets the emulation speed in percent of the hardware speed.
+func WithSpeed(speed int) Option {
+	return func(a *arcade) {
+		a.speed = speed
+	}
+}
 
-	a.apu.SoundListBytes = soundListBytes
+// WithSync paces the emulation on a high resolution clock, the display vertical sync or the audio playback.
+func WithSync(sync string) Option {
+	return func(a *arcade) {
+		a.sync = pacing.Mode(sync)
+	}
+}
 
-	for _, o := range options {
-		o(&a)
+// WithServe serves the remote control API, the frame stream and the web player on addr.
+func WithServe(addr string) Option {
+	return func(a *arcade) {
+		a.serve = addr
+	}
+}
+
+// WithNetplay plays the game of a netplay session, the machine is the one of the session.
+func WithNetplay(s *netplay.Session) Option {
+	return func(a *arcade) {
+		a.remote = s
+	}
+}
+
+// WithSpectate replays the game streamed to a viewer, the machine is the one of the viewer.
+func WithSpectate(v *spectate.Viewer) Option {
+	return func(a *arcade) {
+		a.remote = v
+	}
+}
+
+// WithSpectators streams the frames of the game to the viewers of a server.
+func WithSpectators(s *spectate.Server) Option {
+	return func(a *arcade) {
+		a.spectators = s
+	}
+}
+
+func WithSaveState(saveState string) Option {
+	return func(a *arcade) {
+		a.saveState = saveState
+	}
+}
+
+// Run plays a machine loaded with configBytes until its CPU halts, the window is closed or ctx is canceled. It
+// installs no signal handler, the caller cancels ctx on interrupt.
+func Run(ctx context.Context, m *machine.Machine, configBytes []uint8, soundListBytes [][]uint8, options ...Option) error {
+	aCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	a := newArcade(cancel, m, &ui.UI{}, &apu.APU{SoundListBytes: soundListBytes}, options...)
+	a.configBytes = configBytes
+	a.apu.SetVolume(apu.MAX_VOLUME)
+
+	if a.serve != "" {
+		a.server = newServer(soundListBytes)
+		a.server.listen(a.serve)
 	}
 
 	if !a.headless {
 		defer binsdl.Load().Unload()
 		defer a.apu.Close()
 		defer a.ui.Close()
+		defer saveWindow(a.ui)
 
-		trapSigInt(cancel)
+		a.initWindow()
 	}
 
-	romBytesReader := bytes.NewReader(romBytes)
-	gameName := strings.ReplaceAll(filepath.Base(romPath), filepath.Ext(romPath), "")
+	return a.run(aCtx)
+}
 
-	i := 0
+// newArcade plays a loaded machine with a UI and an APU, which can be reused by the next game.
+func newArcade(cancel context.CancelFunc, m *machine.Machine, u *ui.UI, ap *apu.APU, options ...Option) *arcade {
+	a := &arcade{
+		machine: m,
+		ui:      u,
+		apu:     ap,
+		cancel:  cancel,
+		romPath: m.Path(),
+		speed:   DEFAULT_SPEED,
+		sync:    pacing.MODE_CLOCK,
+	}
 
-	if filepath.Ext(romPath) == ".zip" {
-		r, err := zip.NewReader(romBytesReader, int64(len(romBytes)))
-		if err != nil {
-			return fmt.Errorf("failed to open zip archive: %w", err)
-		}
+	a.ui.Arcade = a
+	a.ui.Bus = m
+	a.ui.CPU = m
+	a.ui.APU = a.apu
+	a.ui.TargetFPS = machine.FPS
 
-		config, err := config.LoadConfig(configBytes, gameName)
-		if err != nil {
-			return err
-		}
+	for _, o := range options {
+		o(a)
+	}
 
-		a.ui.ColorOverlays = config.ColorOverlays
-		a.cpu.InPorts = config.InPorts
+	if a.remote != nil {
+		a.ui.CPU = a.remote
+	}
 
-		a.Reset()
+	a.apu.Clock = a.sync == pacing.MODE_AUDIO
 
-		for _, p := range config.ROMParts {
-			if err := a.LoadBytes(p.StartAddr, p.ExpectedSize, lib.Must(GetFileBytesFromZip(r.File, p.FileName))); err != nil {
-				return fmt.Errorf("failed to load %s", p.FileName)
-			}
-		}
+	return a
+}
 
-		for _, p := range config.ColorPROMs {
-			a.ui.ColorPROM = append(a.ui.ColorPROM, lib.Must(GetFileBytesFromZip(r.File, p.FileName))...)
-		}
-	} else {
-		if a.cpm {
-			i = 0x100
-		}
+// run sets up the UI for the game of the machine and runs it until the CPU halts or the context is canceled.
+func (a *arcade) run(ctx context.Context) error {
+	defer a.apu.StopSounds()
+
+	a.ui.Inputs = config.DefaultInputs
+	a.ui.KeyBindings = config.DefaultKeyBindings
+	a.ui.GamepadBindings = config.DefaultGamepadBindings
+	a.ui.GamepadDeadzone = config.DEFAULT_GAMEPAD_DEADZONE
+	a.ui.ColorOverlays = nil
+	a.ui.ColorOverlayImage = nil
+	a.ui.ColorPROM = nil
+	a.ui.DIPSwitches = nil
+	a.ui.Video = nil
+	a.ui.Cocktail = a.cocktail
+
+	if err := CheckSpeed(a.speed); err != nil {
+		return err
+	}
 
-		a.Reset()
+	if !slices.Contains(pacing.Modes, a.sync) {
+		return fmt.Errorf("sync %q is not clock, vsync or audio", a.sync)
+	}
 
-		for _, b := range romBytes {
-			a.memory.Write(uint16(i), b)
-			i++
-		}
+	if a.rotation%90 != 0 || a.rotation >= 360 {
+		return fmt.Errorf("rotation %d is not 0, 90, 180 or 270", a.rotation)
 	}
 
-	if a.cpm {
-		// inject "out 0,a" at 0x0000 (signal to stop the test)
-		a.memory.Write(0x0000, 0xD3)
-		a.memory.Write(0x0001, 0x00)
+	a.ui.Display = a.display(config.Display{})
 
-		// inject "out 1,a" at 0x0005 (signal to output some characters)
-		a.memory.Write(0x0005, 0xD3)
-		a.memory.Write(0x0006, 0x01)
-		a.memory.Write(0x0007, 0xC9)
-	}
+	if g := a.machine.Game(); g != nil {
+		if g.Identified {
+			fmt.Fprintln(os.Stderr, "identified rom set: "+g.Name)
+		}
 
-	if a.saveState != "" {
-		if err := a.LoadState(); err != nil {
+		spec, err := config.LoadConfig(a.configBytes, g.Name)
+		if err != nil {
 			return err
 		}
-	}
-
-	cpuCycles := uint64(0)
 
-	// FPS * 2 so that the half and full VBLANK interrupts fire at the correct timing
-	frameTicker := time.NewTicker(time.Second / (FPS * 2))
-	defer frameTicker.Stop()
+		a.ui.ColorOverlays = spec.ColorOverlays
+		a.ui.Inputs = spec.Inputs
+		a.ui.KeyBindings = spec.KeyBindings
+		a.ui.GamepadBindings = spec.GamepadBindings
+		a.ui.GamepadDeadzone = spec.GamepadDeadzone
+		a.ui.DIPSwitches = spec.DIPSwitches
+		a.ui.Display = a.display(spec.Display)
 
-	if a.unthrottle {
-		for a.cpu.Running {
-			a.cpu.Step()
+		a.ui.ColorPROM, err = g.ColorPROM()
+		if err != nil {
+			return err
 		}
-	}
 
-	for a.cpu.Running {
-		select {
-		case <-frameTicker.C:
-			for !a.ui.Paused && cpuCycles < CPU_TPS_PER_FRAME/2 {
-				cpuCycles += uint64(a.cpu.Step())
+		if !a.headless {
+			a.ui.ColorOverlayImage, err = loadArtwork(spec.ColorOverlayImage, filepath.Dir(a.romPath))
+			if err != nil {
+				return err
 			}
 
-			cpuCycles = 0
-
-			if !a.headless {
-				a.ui.Step()
+			a.ui.Video, err = newVideoPipeline(spec.Video, a.ui.Display, filepath.Dir(a.romPath))
+			if err != nil {
+				return err
 			}
-		case <-aCtx.Done():
-			return nil
 		}
 	}
 
-	return nil
+	a.initUI()
+
+	if a.saveState != "" {
+		if err := a.LoadState(0); err != nil {
+			return err
+		}
+	}
+
+	return a.loop(ctx)
 }
 
+// Reset restarts the machine, and the UI and APU for it.
 func (a *arcade) Reset() {
-	cpuPC := uint16(0)
+	if a.remote != nil {
+		a.ui.Notify("failed to reset: " + errRemote.Error())
 
-	if a.cpm {
-		cpuPC = 0x100
+		return
 	}
 
-	a.cpu.Init(cpuPC, a.cpuOpts...)
+	a.machine.Reset()
+	a.resync()
+	a.initUI()
+}
+
+// resync sends the state of the machine to the spectators, after it changed outside of the inputs.
+func (a *arcade) resync() {
+	if a.spectators != nil {
+		a.spectators.Resync()
+	}
+}
 
-	if !a.headless && !a.unthrottle {
+func (a *arcade) initUI() {
+	if !a.headless {
 		a.ui.Init()
 
 		if !a.mute {
@@ -238,35 +370,37 @@ func (a *arcade) Reset() {
 	}
 }
 
-func GetFileBytesFromZip(files []*zip.File, fileName string) ([]uint8, error) {
-	fileIndex := slices.IndexFunc(files, func(f *zip.File) bool { return f.Name == fileName })
+func (a *arcade) DIPSwitchSetting(name string) string {
+	return a.machine.DIPSwitchSetting(name)
+}
 
-	f, err := files[fileIndex].Open()
-	if err != nil {
-		return nil, fmt.Errorf("failed to open file: %w", err)
+func (a *arcade) SetDIPSwitch(name, label string) error {
+	if a.remote != nil {
+		return errRemote
 	}
-	defer lib.DeferErr(f.Close)
 
-	bytes, err := io.ReadAll(f)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read file bytes: %w", err)
+	if err := a.machine.SetDIPSwitch(name, label); err != nil {
+		return err
 	}
 
-	return bytes, nil
+	a.resync()
+
+	return nil
 }
 
-func (a *arcade) LoadBytes(start, expectedSize uint16, bytes []uint8) error {
-	if len(bytes) != int(expectedSize) {
-		return fmt.Errorf("unexpected size difference when loading bytes, expected: %d, actual: %d", expectedSize, len(bytes))
-	}
+// display applies the command line orientation over a game display config.
+func (a *arcade) display(d config.Display) config.Display {
+	d.Rotation = (d.Rotation + a.rotation) % 360
 
-	addr := start
-	for _, b := range bytes {
-		a.memory.Write(addr, b)
-		addr++
+	// Flips mirror the rotated screen, a quarter turn swaps the axes of the game flips
+	if a.rotation%180 != 0 {
+		d.FlipX, d.FlipY = d.FlipY, d.FlipX
 	}
 
-	return nil
+	d.FlipX = d.FlipX != a.flipX
+	d.FlipY = d.FlipY != a.flipY
+
+	return d
 }
 
 func Disassemble(romBytes, configBytes []uint8, romPath string) error {
@@ -276,23 +410,16 @@ func Disassemble(romBytes, configBytes []uint8, romPath string) error {
 
 	readableROMBytes := romBytes
 
-	romBytesReader := bytes.NewReader(romBytes)
-	gameName := strings.ReplaceAll(filepath.Base(romPath), filepath.Ext(romPath), "")
-
 	if filepath.Ext(romPath) == ".zip" {
-		r, err := zip.NewReader(romBytesReader, int64(len(romBytes)))
+		g, err := machine.OpenGame(romBytes, configBytes, romPath)
 		if err != nil {
-			return fmt.Errorf("failed to open zip archive: %w", err)
+			return err
 		}
 
-		config, err := config.LoadConfig(configBytes, gameName)
+		readableROMBytes, err = g.ROM()
 		if err != nil {
 			return err
 		}
-
-		for _, p := range config.ROMParts {
-			readableROMBytes = append(readableROMBytes, lib.Must(GetFileBytesFromZip(r.File, p.FileName))...)
-		}
 	}
 
 	var i uint16
@@ -326,30 +453,20 @@ func Disassemble(romBytes, configBytes []uint8, romPath string) error {
 	return nil
 }
 
-type saveState struct {
-	CPU    []uint8
-	Memory []uint8
-}
-
-func (a *arcade) SaveState() error {
-	cpu, err := a.cpu.SaveState()
-	if err != nil {
-		return err
-	}
-
-	memory := make([]uint8, 0x10000)
+// statePath returns the state file of a save slot, <rom>.state for slot 0 and <rom>.<slot>.state for the others.
+func (a *arcade) statePath(slot int) string {
+	romDir, romFileName := filepath.Split(a.romPath)
+	ext := ".state"
 
-	for addr := range memory {
-		memory[addr] = a.memory.Read(uint16(addr))
+	if slot > 0 {
+		ext = fmt.Sprintf(".%d.state", slot)
 	}
 
-	s := saveState{
-		CPU:    cpu,
-		Memory: memory,
-	}
+	return filepath.Join(romDir, strings.TrimSuffix(romFileName, filepath.Ext(romFileName))+ext)
+}
 
-	romDir, romFileName := filepath.Split(a.romPath)
-	stateFilePath := filepath.Join(romDir, strings.ReplaceAll(romFileName, filepath.Ext(romFileName), ".state"))
+func (a *arcade) SaveState(slot int) error {
+	stateFilePath := a.statePath(slot)
 
 	f, err := os.Create(stateFilePath)
 	if err != nil {
@@ -357,22 +474,24 @@ func (a *arcade) SaveState() error {
 	}
 	defer lib.DeferErr(f.Close)
 
-	enc := gob.NewEncoder(f)
-
-	if err := enc.Encode(s); err != nil {
+	if err := a.machine.SaveState(f); err != nil {
 		return err
 	}
 
-	fmt.Println("saved state file: " + stateFilePath)
+	a.ui.Notify("saved state file: " + stateFilePath)
 
 	return nil
 }
 
-func (a *arcade) LoadState() error {
-	stateFilePath := a.saveState
-	if stateFilePath == "" {
-		romDir, romFileName := filepath.Split(a.romPath)
-		stateFilePath = filepath.Join(romDir, strings.ReplaceAll(romFileName, filepath.Ext(romFileName), ".state"))
+// LoadState loads the state file of a save slot, the --state file replaces slot 0.
+func (a *arcade) LoadState(slot int) error {
+	if a.remote != nil {
+		return errRemote
+	}
+
+	stateFilePath := a.statePath(slot)
+	if a.saveState != "" && slot == 0 {
+		stateFilePath = a.saveState
 	}
 
 	f, err := os.Open(stateFilePath)
@@ -381,36 +500,23 @@ func (a *arcade) LoadState() error {
 	}
 	defer lib.DeferErr(f.Close)
 
-	var s saveState
-
-	dec := gob.NewDecoder(f)
-	if err := dec.Decode(&s); err != nil {
-		return fmt.Errorf("failed to decode save state: %w", err)
-	}
-
-	if err := a.cpu.LoadState(s.CPU); err != nil {
-		return fmt.Errorf("failed to load CPU state: %w", err)
-	}
-
-	for addr, b := range s.Memory {
-		a.memory.Write(uint16(addr), b)
+	if err := a.machine.LoadState(f); err != nil {
+		return err
 	}
 
-	fmt.Println("loaded state file: " + stateFilePath)
+	a.resync()
+	a.ui.Notify("loaded state file: " + stateFilePath)
 
 	return nil
 }
 
+// Shutdown stops the game and the launcher it was started from.
 func (a *arcade) Shutdown() {
+	a.quit = true
 	a.cancel()
 }
 
-func trapSigInt(cancel context.CancelFunc) {
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
-
-	go func() {
-		<-c
-		cancel()
-	}()
+// Exit stops the game and goes back to the launcher it was started from.
+func (a *arcade) Exit() {
+	a.cancel()
 }
@@ -0,0 +1,65 @@
+package arcade
+
+import (
+	"fmt"
+	"image"
+	_ "image/png"
+	"os"
+	"path/filepath"
+
+	"github.com/cterence/goarcade/internal/arcade/config"
+	"github.com/cterence/goarcade/internal/arcade/lib"
+	"github.com/cterence/goarcade/internal/arcade/ui"
+	"github.com/cterence/goarcade/internal/arcade/video"
+)
+
+// newVideoPipeline loads the artwork of a game, relative to its rom directory, and creates its video pipeline
+// for the displayed frame. It returns nil when the game has no video config.
+func newVideoPipeline(v config.Video, d config.Display, romDir string) (*video.Pipeline, error) {
+	if !video.Enabled(v) {
+		return nil, nil
+	}
+
+	background, err := loadArtwork(v.Background, romDir)
+	if err != nil {
+		return nil, err
+	}
+
+	bezel, err := loadArtwork(v.Bezel, romDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// The frame is drawn for a monitor on its side, turning it a quarter makes its scanlines horizontal
+	width, height := ui.FrameSize(d)
+
+	p, err := video.New(v, width, height, d.Rotation%180 != 0, background, bezel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create video pipeline: %w", err)
+	}
+
+	return p, nil
+}
+
+func loadArtwork(path, romDir string) (image.Image, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(romDir, path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open artwork: %w", err)
+	}
+	defer lib.DeferErr(f.Close)
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode artwork %s: %w", path, err)
+	}
+
+	return img, nil
+}
@@ -0,0 +1,234 @@
+package arcade
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cterence/goarcade/machine"
+)
+
+// Instances listed for a group of identical results
+const MAX_LISTED_INSTANCES = 8
+
+// BatchMovie is a movie file to replay, with its path for the results.
+type BatchMovie struct {
+	Path  string
+	Movie *machine.Movie
+}
+
+// BatchResult is the state of a machine at the end of a movie replay.
+type BatchResult struct {
+	Movie    string `json:"movie"`
+	Instance int    `json:"instance"`
+	Frames   int    `json:"frames"`
+	Cycles   uint64 `json:"cycles"`
+	// Read from the env definition of the game, when it has one
+	Score *int `json:"score,omitempty"`
+	Lives *int `json:"lives,omitempty"`
+	// SHA1 of the RAM, video RAM included
+	RAM string `json:"ram"`
+	// Console output of CP/M programs
+	Output string `json:"output,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// BatchOptions are the settings of a batch of replays.
+type BatchOptions struct {
+	// Replays of each movie, each on its own machine
+	Instances int
+	// Machines running at once
+	Jobs int
+	// Print the result of each instance as a JSON line, instead of grouping them by movie and identical results
+	JSON bool
+	// Results are printed to Output and the throughput to Stats
+	Output io.Writer
+	Stats  io.Writer
+	// Program replayed when there is no game, like the CP/M tests
+	Program []uint8
+	// Options of the machines, their output is kept in the results
+	Machine []machine.Option
+}
+
+// Batch replays every movie on the game, or on the program of the options when game is nil. The game is opened
+// once and loaded by every machine.
+func Batch(ctx context.Context, game *machine.Game, movies []BatchMovie, o BatchOptions) error {
+	if o.Instances < 1 || o.Jobs < 1 {
+		return fmt.Errorf("instances %d and jobs %d must be positive", o.Instances, o.Jobs)
+	}
+
+	results := make([]BatchResult, len(movies)*o.Instances)
+	sem := make(chan struct{}, o.Jobs)
+	start := time.Now()
+
+	var wg sync.WaitGroup
+
+	for i := range results {
+		results[i] = BatchResult{Movie: movies[i/o.Instances].Path, Instance: i % o.Instances}
+
+		wg.Go(func() {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			replay(ctx, &results[i], movies[i/o.Instances].Movie, game, o)
+		})
+	}
+
+	wg.Wait()
+
+	elapsed := time.Since(start)
+
+	if o.JSON {
+		enc := json.NewEncoder(o.Output)
+
+		for _, r := range results {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+	} else {
+		printBatchResults(o.Output, results, o.Instances)
+	}
+
+	frames, failed := 0, 0
+
+	for _, r := range results {
+		frames += r.Frames
+
+		if r.Error != "" {
+			failed++
+		}
+	}
+
+	fps := float64(frames) / elapsed.Seconds()
+	fmt.Fprintf(o.Stats, "%d frames in %s: %.0f fps, %.0fx real time\n", frames, elapsed.Round(time.Millisecond), fps, fps/machine.FPS)
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d replays failed", failed, len(results))
+	}
+
+	return ctx.Err()
+}
+
+// replay runs a movie on a new machine and fills its result.
+func replay(ctx context.Context, r *BatchResult, mv *machine.Movie, game *machine.Game, o BatchOptions) {
+	var output bytes.Buffer
+
+	m := machine.New(slices.Concat(o.Machine, []machine.Option{machine.WithOutput(&output), machine.WithLog(io.Discard)})...)
+
+	err := errors.New("no rom passed to emulator")
+
+	switch {
+	case game != nil:
+		err = m.LoadGame(game)
+	case len(o.Program) > 0:
+		err = m.LoadProgram(o.Program)
+	}
+
+	if err == nil {
+		r.Frames, err = m.Replay(ctx, mv)
+	}
+
+	if err != nil {
+		r.Error = err.Error()
+	}
+
+	r.Cycles = m.Cycles()
+	r.Output = output.String()
+
+	ram := make([]uint8, machine.RAM_SIZE)
+	for i := range ram {
+		ram[i] = m.Read(machine.RAM_START + uint16(i))
+	}
+
+	sum := sha1.Sum(ram)
+	r.RAM = hex.EncodeToString(sum[:])
+
+	if game != nil && game.Env != nil {
+		if v := game.Env.Score; v != nil {
+			score := m.ReadValue(*v)
+			r.Score = &score
+		}
+
+		if v := game.Env.Lives; v != nil {
+			lives := m.ReadValue(*v)
+			r.Lives = &lives
+		}
+	}
+}
+
+// printBatchResults prints the distinct results of each movie with their instances, the replays of a movie
+// are expected to give the same result.
+func printBatchResults(w io.Writer, results []BatchResult, instances int) {
+	for i := 0; i < len(results); i += instances {
+		movie := results[i : i+instances]
+
+		var (
+			groups    []string
+			byResult  = map[string][]int{}
+			summaries = map[string]string{}
+		)
+
+		for _, r := range movie {
+			s := batchSummary(r)
+
+			key := s + "\x00" + r.Output
+			if _, ok := byResult[key]; !ok {
+				groups = append(groups, key)
+				summaries[key] = s
+			}
+
+			byResult[key] = append(byResult[key], r.Instance)
+		}
+
+		fmt.Fprintf(w, "%s: %d instances, %d distinct results\n", movie[0].Movie, instances, len(groups))
+
+		for _, key := range groups {
+			ids := byResult[key]
+
+			listed := make([]string, 0, MAX_LISTED_INSTANCES)
+			for _, id := range ids[:min(len(ids), MAX_LISTED_INSTANCES)] {
+				listed = append(listed, fmt.Sprint(id))
+			}
+
+			if len(ids) > MAX_LISTED_INSTANCES {
+				listed = append(listed, "...")
+			}
+
+			fmt.Fprintf(w, "  %d instances (%s): %s\n", len(ids), strings.Join(listed, " "), summaries[key])
+		}
+	}
+}
+
+func batchSummary(r BatchResult) string {
+	if r.Error != "" {
+		return "error: " + r.Error
+	}
+
+	s := fmt.Sprintf("%d frames, %d cycles", r.Frames, r.Cycles)
+
+	if r.Score != nil {
+		s += fmt.Sprintf(", score %d", *r.Score)
+	}
+
+	if r.Lives != nil {
+		s += fmt.Sprintf(", lives %d", *r.Lives)
+	}
+
+	s += ", ram " + r.RAM[:12]
+
+	if r.Output != "" {
+		s += fmt.Sprintf(", %d bytes of output", len(r.Output))
+	}
+
+	return s
+}
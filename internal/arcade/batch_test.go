@@ -0,0 +1,80 @@
+package arcade
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/cterence/goarcade/machine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Batch(t *testing.T) {
+	// Adds the coin input to the first byte of RAM in a loop
+	program := []uint8{
+		0xDB, 0x01, // in 1
+		0x47,             // mov b,a
+		0x3A, 0x00, 0x20, // lda 2000h
+		0x80,             // add b
+		0x32, 0x00, 0x20, // sta 2000h
+		0xC3, 0x00, 0x00, // jmp 0000h
+	}
+
+	mv, err := machine.ParseMovie([]uint8("frames: 10\ninputs:\n  - { frame: 4, input: coin, pressed: true }\n"))
+	require.NoError(t, err)
+
+	movies := []BatchMovie{{Path: "a.yaml", Movie: mv}, {Path: "b.yaml", Movie: mv}}
+
+	t.Run("json", func(t *testing.T) {
+		var out, stats bytes.Buffer
+
+		err := Batch(t.Context(), nil, movies, BatchOptions{Instances: 3, Jobs: 2, JSON: true, Output: &out, Stats: &stats, Program: program})
+		require.NoError(t, err)
+
+		dec := json.NewDecoder(&out)
+
+		var results []BatchResult
+
+		for dec.More() {
+			var r BatchResult
+			require.NoError(t, dec.Decode(&r))
+
+			results = append(results, r)
+		}
+
+		require.Len(t, results, 6)
+		assert.Equal(t, "b.yaml", results[5].Movie)
+		assert.Equal(t, 2, results[5].Instance)
+
+		for _, r := range results {
+			assert.Equal(t, 10, r.Frames)
+			assert.Equal(t, results[0].RAM, r.RAM)
+		}
+
+		assert.Contains(t, stats.String(), "60 frames in ")
+	})
+
+	t.Run("grouped", func(t *testing.T) {
+		var out, stats bytes.Buffer
+
+		err := Batch(t.Context(), nil, movies[:1], BatchOptions{Instances: 2, Jobs: 1, Output: &out, Stats: &stats, Program: program})
+		require.NoError(t, err)
+
+		assert.Contains(t, out.String(), "a.yaml: 2 instances, 1 distinct results\n  2 instances (0 1): 10 frames")
+	})
+
+	t.Run("no rom", func(t *testing.T) {
+		var out, stats bytes.Buffer
+
+		err := Batch(t.Context(), nil, movies[:1], BatchOptions{Instances: 1, Jobs: 1, Output: &out, Stats: &stats})
+		require.EqualError(t, err, "1 of 1 replays failed")
+
+		assert.Contains(t, out.String(), "error: no rom passed to emulator")
+	})
+
+	t.Run("invalid jobs", func(t *testing.T) {
+		err := Batch(t.Context(), nil, movies, BatchOptions{Instances: 1})
+		assert.EqualError(t, err, "instances 1 and jobs 0 must be positive")
+	})
+}
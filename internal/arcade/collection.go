@@ -0,0 +1,193 @@
+package arcade
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/cterence/goarcade/internal/arcade/config"
+	"github.com/cterence/goarcade/internal/arcade/romset"
+)
+
+// List writes the game specs of the config with their files and DIP switches.
+func List(w io.Writer, configBytes []uint8) error {
+	config, err := config.ParseConfig(configBytes)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(config.GameSpecs))
+	for name := range config.GameSpecs {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	for _, name := range names {
+		spec, err := config.GameSpec(name)
+		if err != nil {
+			fmt.Fprintf(w, "%s: %s\n", name, err)
+
+			continue
+		}
+
+		if spec.Parent != "" {
+			fmt.Fprintf(w, "%s (clone of %s)\n", name, spec.Parent)
+		} else {
+			fmt.Fprintln(w, name)
+		}
+
+		for _, p := range spec.ROMParts {
+			fmt.Fprintln(w, strings.TrimRight(fmt.Sprintf("  %-16s rom   %s  %s", p.FileName, addrRange(p), checksums(p.ROMFile)), " "))
+		}
+
+		for _, p := range spec.ColorPROMs {
+			fmt.Fprintln(w, strings.TrimRight(fmt.Sprintf("  %-16s prom  %4d bytes  %s", p.FileName, p.ExpectedSize, checksums(p.ROMFile)), " "))
+		}
+
+		for _, d := range spec.DIPSwitches {
+			fmt.Fprintf(w, "  dip %s: %s (default: %s)\n", d.Name, strings.Join(d.Labels(), "/"), d.DefaultSetting().Label)
+		}
+	}
+
+	return nil
+}
+
+// addrRange returns the first and last addresses of a ROM part, empty parts have no last address.
+func addrRange(p config.ROMPart) string {
+	if p.ExpectedSize == 0 {
+		return fmt.Sprintf("%04x-????", p.StartAddr)
+	}
+
+	return fmt.Sprintf("%04x-%04x", p.StartAddr, uint32(p.StartAddr)+uint32(p.ExpectedSize)-1)
+}
+
+func checksums(f config.ROMFile) string {
+	var b strings.Builder
+
+	if f.CRC32 != 0 {
+		fmt.Fprintf(&b, "crc32:%08x ", f.CRC32)
+	}
+
+	if f.SHA1 != "" {
+		b.WriteString("sha1:" + strings.ToLower(f.SHA1))
+	}
+
+	return strings.TrimSpace(b.String())
+}
+
+// Verify audits every .zip archive of a directory against the config game specs, and writes the status of each.
+func Verify(w io.Writer, configBytes []uint8, romDir string) error {
+	config, err := config.ParseConfig(configBytes)
+	if err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(romDir)
+	if err != nil {
+		return fmt.Errorf("failed to read rom directory: %w", err)
+	}
+
+	counts := map[romset.Status]int{}
+
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".zip" {
+			continue
+		}
+
+		gameName, status, err := auditFile(config, filepath.Join(romDir, e.Name()))
+		counts[status]++
+
+		line := fmt.Sprintf("%-24s %s", e.Name(), status)
+		if gameName != "" {
+			line += " (" + gameName + ")"
+		}
+
+		fmt.Fprintln(w, line)
+
+		if err != nil {
+			for _, e := range strings.Split(err.Error(), "\n") {
+				fmt.Fprintln(w, "  "+e)
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "\n%d complete, %d missing parts, %d wrong checksums, %d unknown\n",
+		counts[romset.STATUS_COMPLETE], counts[romset.STATUS_MISSING], counts[romset.STATUS_BAD_DUMP], counts[romset.STATUS_UNKNOWN])
+
+	return nil
+}
+
+func auditFile(c *config.Config, romPath string) (string, romset.Status, error) {
+	romBytes, err := os.ReadFile(romPath)
+	if err != nil {
+		return "", romset.STATUS_UNKNOWN, fmt.Errorf("failed to read rom file: %w", err)
+	}
+
+	set, err := romset.Open(romBytes)
+	if err != nil {
+		return "", romset.STATUS_UNKNOWN, err
+	}
+
+	gameName := strings.TrimSuffix(filepath.Base(romPath), ".zip")
+
+	gameName, status, err := romset.Audit(c, gameName, set, filepath.Dir(romPath))
+	if errors.Is(err, romset.ErrUnknownSet) {
+		return "", status, nil
+	}
+
+	return gameName, status, err
+}
+
+func CheckConfig(configBytes []uint8, configPath string) error {
+	err := config.Check(configBytes)
+	if err == nil {
+		fmt.Println(configPath + ": ok")
+
+		return nil
+	}
+
+	problems := strings.Split(err.Error(), "\n")
+
+	for _, p := range problems {
+		fmt.Println(configPath + ": " + p)
+	}
+
+	return fmt.Errorf("%d problems found in config file", len(problems))
+}
+
+// ImportMAME merges the game specs of a MAME -listxml file into the config file.
+func ImportMAME(configPath, xmlPath string, dryRun bool) error {
+	configBytes, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	xmlBytes, err := os.ReadFile(xmlPath)
+	if err != nil {
+		return fmt.Errorf("failed to read mame xml file: %w", err)
+	}
+
+	merged, names, err := config.ImportMAME(configBytes, xmlBytes)
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		fmt.Print(string(merged))
+
+		return nil
+	}
+
+	if err := os.WriteFile(configPath, merged, 0o644); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+
+	fmt.Printf("imported %d game specs into %s: %s\n", len(names), configPath, strings.Join(names, ", "))
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package arcade
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cterence/goarcade/internal/gametest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const collectionConfig = `gameSpecs:
+  game:
+    romParts:
+      - fileName: a
+        startAddr: 0x0
+        expectedSize: 0x4
+        crc32: 0xb63cfbcd
+        sha1: 12dada1fff4d4787ade3333147202c3b443e376f
+      - fileName: empty
+        startAddr: 0x4
+        expectedSize: 0x0
+    dipSwitches:
+      - name: lives
+        port: 2
+        bits: [0]
+        default: "3"
+        settings:
+          - { label: "3", value: 0 }
+          - { label: "4", value: 1 }
+  clone:
+    parent: game
+    romParts:
+      - fileName: c
+        startAddr: 0xfffc
+        expectedSize: 0x4
+`
+
+func writeZip(t *testing.T, path string, files map[string][]uint8) {
+	require.NoError(t, os.WriteFile(path, gametest.Archive(t, files), 0o644))
+}
+
+func Test_List(t *testing.T) {
+	var b bytes.Buffer
+
+	require.NoError(t, List(&b, []uint8(collectionConfig)))
+	assert.Equal(t, `clone (clone of game)
+  a                rom   0000-0003  crc32:b63cfbcd sha1:12dada1fff4d4787ade3333147202c3b443e376f
+  empty            rom   0004-????
+  c                rom   fffc-ffff
+  dip lives: 3/4 (default: 3)
+game
+  a                rom   0000-0003  crc32:b63cfbcd sha1:12dada1fff4d4787ade3333147202c3b443e376f
+  empty            rom   0004-????
+  dip lives: 3/4 (default: 3)
+`, b.String())
+}
+
+func Test_Verify(t *testing.T) {
+	romDir := t.TempDir()
+
+	writeZip(t, filepath.Join(romDir, "game.zip"), map[string][]uint8{"a": {1, 2, 3, 4}, "empty": {}})
+	writeZip(t, filepath.Join(romDir, "clone.zip"), map[string][]uint8{"c": {5, 6, 7, 8}})
+	writeZip(t, filepath.Join(romDir, "other.zip"), map[string][]uint8{"x": {9}})
+
+	var b bytes.Buffer
+
+	require.NoError(t, Verify(&b, []uint8(collectionConfig), romDir))
+	assert.Equal(t, `clone.zip                complete (clone)
+game.zip                 complete (game)
+other.zip                unknown
+
+2 complete, 0 missing parts, 0 wrong checksums, 1 unknown
+`, b.String())
+}
@@ -1,21 +1,33 @@
 package config
 
 import (
+	"cmp"
 	"errors"
 	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
 
 	"github.com/goccy/go-yaml"
 )
 
-type ROMPart struct {
+// ROMFile describes a file expected inside a game .zip archive.
+// CRC32 and SHA1 are optional, a zero value disables the check.
+type ROMFile struct {
 	FileName     string `yaml:"fileName"`
-	StartAddr    uint16 `yaml:"startAddr"`
 	ExpectedSize uint16 `yaml:"expectedSize"`
+	CRC32        uint32 `yaml:"crc32"`
+	SHA1         string `yaml:"sha1"`
+}
+
+type ROMPart struct {
+	ROMFile   `yaml:",inline"`
+	StartAddr uint16 `yaml:"startAddr"`
 }
 
 type ColorPROM struct {
-	FileName     string `yaml:"fileName"`
-	ExpectedSize uint16 `yaml:"expectedSize"`
+	ROMFile `yaml:",inline"`
 }
 
 type ColorOverlay struct {
@@ -26,6 +38,7 @@ type ColorOverlay struct {
 	Color uint32 `yaml:"color"`
 }
 
+// activePosition is the level of an input bit when its input is active, high when unset.
 type activePosition string
 
 const (
@@ -33,21 +46,97 @@ const (
 	POSITION_HIGH activePosition = "high"
 )
 
+// Port is an input port bit set on reset, Active is the state of the input and not the bit level.
 type Port struct {
-	Bit    uint8 `yaml:"bit"`
-	Active bool  `yaml:"active"`
-	// ActivePosition activePosition `yaml:"activePosition"`
+	Bit            uint8          `yaml:"bit"`
+	Active         bool           `yaml:"active"`
+	ActivePosition activePosition `yaml:"activePosition"`
+}
+
+// Display orients the screen, which is drawn by default for the vertical monitor of the Midway 8080 cabinets.
+type Display struct {
+	// Clockwise rotation in degrees (0, 90, 180 or 270), 90 shows horizontal games upright.
+	// The flips mirror the rotated screen.
+	Rotation uint16 `yaml:"rotation"`
+	FlipX    bool   `yaml:"flipX"`
+	FlipY    bool   `yaml:"flipY"`
+	// Output port bit set by the game to flip the screen for player 2, followed in cocktail mode
+	CocktailFlip *OutputBit `yaml:"cocktailFlip"`
+}
+
+type OutputBit struct {
+	Port uint8 `yaml:"port"`
+	Bit  uint8 `yaml:"bit"`
+}
+
+// Video configures the CPU-side post-processing and the artwork of a game, every effect is off at its zero value.
+type Video struct {
+	// Darkening of the gaps between the CRT scanlines, from 0 to 1
+	Scanlines float64 `yaml:"scanlines"`
+	// Part of the previous frame kept by the phosphor, from 0 to 1
+	Persistence float64 `yaml:"persistence"`
+	// Part of the neighbor pixels bleeding on a pixel, from 0 to 1
+	Glow float64 `yaml:"glow"`
+	// Gamma correction, 0 or 1 to disable
+	Gamma float64 `yaml:"gamma"`
+	// PNG images, relative paths are resolved from the game archive directory
+	Background string `yaml:"background"`
+	Bezel      string `yaml:"bezel"`
+	// Position of the screen in the bezel image
+	Screen Screen `yaml:"screen"`
+}
+
+type Screen struct {
+	X      uint16 `yaml:"x"`
+	Y      uint16 `yaml:"y"`
+	Width  uint16 `yaml:"width"`
+	Height uint16 `yaml:"height"`
 }
 
 type GameSpec struct {
-	InPorts       map[int][8]Port `yaml:"inPorts"`
-	ROMParts      []ROMPart       `yaml:"romParts"`
-	ColorOverlays []ColorOverlay  `yaml:"colorOverlays"`
-	ColorPROMs    []ColorPROM     `yaml:"colorPROMs"`
+	Parent            string            `yaml:"parent"`
+	InPorts           map[int][]Port    `yaml:"inPorts"`
+	ROMParts          []ROMPart         `yaml:"romParts"`
+	ColorOverlays     []ColorOverlay    `yaml:"colorOverlays"`
+	ColorOverlayImage string            `yaml:"colorOverlayImage"`
+	ColorPROMs        []ColorPROM       `yaml:"colorPROMs"`
+	Inputs            map[string]Input  `yaml:"inputs"`
+	KeyBindings       map[string]string `yaml:"keyBindings"`
+	GamepadBindings   map[string]string `yaml:"gamepadBindings"`
+	GamepadDeadzone   uint16            `yaml:"gamepadDeadzone"`
+	DIPSwitches       []DIPSwitch       `yaml:"dipSwitches"`
+	Display           Display           `yaml:"display"`
+	Video             Video             `yaml:"video"`
+	Env               *Env              `yaml:"env"`
 }
 
 type Config struct {
-	GameSpecs map[string]GameSpec `yaml:"gameSpecs"`
+	ROMDir          string              `yaml:"romDir"`
+	Inputs          map[string]Input    `yaml:"inputs"`
+	KeyBindings     map[string]string   `yaml:"keyBindings"`
+	GamepadBindings map[string]string   `yaml:"gamepadBindings"`
+	GamepadDeadzone uint16              `yaml:"gamepadDeadzone"`
+	Video           Video               `yaml:"video"`
+	GameSpecs       map[string]GameSpec `yaml:"gameSpecs"`
+
+	// Raw config, used to locate validation errors
+	source []uint8
+	// Keys written in the config, a written zero value is not inherited
+	keys configKeys
+}
+
+type specKeys struct {
+	Display map[string]any `yaml:"display"`
+	Video   map[string]any `yaml:"video"`
+}
+
+func (k specKeys) add(keys specKeys) {
+	maps.Copy(k.Display, keys.Display)
+	maps.Copy(k.Video, keys.Video)
+}
+
+type configKeys struct {
+	GameSpecs map[string]specKeys `yaml:"gameSpecs"`
 }
 
 const (
@@ -55,68 +144,160 @@ const (
 	MAX_Y uint16 = 256
 )
 
-func LoadConfig(configBytes []uint8, gameName string) (*GameSpec, error) {
+var ErrNoSpec = errors.New("no specs for game")
+
+func ParseConfig(configBytes []uint8) (*Config, error) {
 	var config Config
 
-	err := yaml.Unmarshal(configBytes, &config)
+	err := yaml.UnmarshalWithOptions(configBytes, &config, yaml.Strict())
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse gamespecs: %w", err)
 	}
 
-	s, ok := config.GameSpecs[gameName]
-	if !ok {
-		return nil, fmt.Errorf("no specs for game: %s", gameName)
+	if err := config.setSource(configBytes); err != nil {
+		return nil, fmt.Errorf("failed to parse gamespecs: %w", err)
+	}
+
+	return &config, nil
+}
+
+func (c *Config) setSource(configBytes []uint8) error {
+	c.source = configBytes
+
+	return yaml.Unmarshal(configBytes, &c.keys)
+}
+
+func LoadConfig(configBytes []uint8, gameName string) (*GameSpec, error) {
+	config, err := ParseConfig(configBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return config.GameSpec(gameName)
+}
+
+func (c *Config) GameSpec(gameName string) (*GameSpec, error) {
+	if _, ok := c.GameSpecs[gameName]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNoSpec, gameName)
 	}
 
-	if err := validateConfig(&s); err != nil {
+	if err := c.locate(validateConfig(c, gameName)); err != nil {
 		return nil, fmt.Errorf("config validation failed: %w", err)
 	}
 
+	s := c.resolve(gameName)
+
 	return &s, nil
 }
 
-func validateConfig(s *GameSpec) error {
-	if len(s.ROMParts) == 0 {
-		return errors.New("missing game parts")
+// Parents returns the ancestors of a game, closest first.
+func (c *Config) Parents(gameName string) []string {
+	var parents []string
+
+	for name := c.GameSpecs[gameName].Parent; name != "" && !slices.Contains(parents, name); name = c.GameSpecs[name].Parent {
+		parents = append(parents, name)
 	}
 
-	prevPart := s.ROMParts[0]
-	for i, currentPart := range s.ROMParts {
-		if i == 0 {
-			continue
-		}
+	return parents
+}
 
-		if currentPart.StartAddr <= prevPart.StartAddr {
-			return fmt.Errorf("game parts: start address %x of part %s is higher than start address %x of part %s", prevPart.StartAddr, prevPart.FileName, currentPart.StartAddr, currentPart.FileName)
-		}
+// resolve merges a game spec over its ancestors then over the global and default inputs and bindings,
+// the parent chain must have been validated.
+func (c *Config) resolve(gameName string) GameSpec {
+	s := c.GameSpecs[gameName]
+	written := specKeys{Display: map[string]any{}, Video: map[string]any{}}
+
+	written.add(c.keys.GameSpecs[gameName])
 
-		if prevPart.StartAddr+prevPart.ExpectedSize > currentPart.StartAddr {
-			return fmt.Errorf("game parts: part %s (start: %x, end: %x) overlaps with part %s (start: %x, end: %x)", prevPart.FileName, prevPart.StartAddr, prevPart.StartAddr+prevPart.ExpectedSize, currentPart.FileName, currentPart.StartAddr, currentPart.StartAddr+currentPart.ExpectedSize)
+	for _, name := range c.Parents(gameName) {
+		s = inherit(c.GameSpecs[name], s, written)
+		written.add(c.keys.GameSpecs[name])
+	}
+
+	s.Inputs = mergeMaps(DefaultInputs, c.Inputs, s.Inputs)
+	s.KeyBindings = mergeMaps(DefaultKeyBindings, c.KeyBindings, s.KeyBindings)
+	s.GamepadBindings = mergeMaps(DefaultGamepadBindings, c.GamepadBindings, s.GamepadBindings)
+
+	s.GamepadDeadzone = cmp.Or(s.GamepadDeadzone, c.GamepadDeadzone, DEFAULT_GAMEPAD_DEADZONE)
+	inheritFields(&s.Video, c.Video, written.Video)
+
+	return s
+}
+
+// inherit overrides parent ROM parts at the same start address, input ports by index, inputs and bindings
+// by name, display and video by field, and color overlays, PROMs and env as a whole. The display and video
+// fields written for the clone are kept even when zero.
+func inherit(parent, clone GameSpec, written specKeys) GameSpec {
+	s := clone
+	s.ROMParts = slices.Clone(parent.ROMParts)
+
+	for _, p := range clone.ROMParts {
+		i := slices.IndexFunc(s.ROMParts, func(pp ROMPart) bool { return pp.StartAddr == p.StartAddr })
+		if i == -1 {
+			s.ROMParts = append(s.ROMParts, p)
+		} else {
+			s.ROMParts[i] = p
 		}
+	}
 
-		prevPart = currentPart
+	slices.SortFunc(s.ROMParts, func(a, b ROMPart) int { return cmp.Compare(a.StartAddr, b.StartAddr) })
+
+	if len(clone.ColorOverlays) == 0 && clone.ColorOverlayImage == "" {
+		s.ColorOverlays = parent.ColorOverlays
+		s.ColorOverlayImage = parent.ColorOverlayImage
 	}
 
-	if len(s.ColorOverlays) >= 2 {
-		for x := range MAX_X {
-			for y := range MAX_Y {
-				var matchingCM *int
+	if len(clone.ColorPROMs) == 0 {
+		s.ColorPROMs = parent.ColorPROMs
+	}
 
-				for i, cm := range s.ColorOverlays {
-					xMatch := (cm.XMin == 0 && cm.XMax == 0) || (x >= cm.XMin && x <= cm.XMax)
+	if len(clone.DIPSwitches) == 0 {
+		s.DIPSwitches = parent.DIPSwitches
+	}
+
+	if clone.Env == nil {
+		s.Env = parent.Env
+	}
 
-					yMatch := (cm.YMin == 0 && cm.YMax == 0) || (y >= cm.YMin && y <= cm.YMax)
-					if xMatch && yMatch {
-						if matchingCM != nil {
-							return fmt.Errorf("color overlays: overlays %d and %d are overlapping at pixel x: %d, y: %d", *matchingCM, i, x, y)
-						}
+	if len(parent.InPorts) > 0 {
+		s.InPorts = maps.Clone(parent.InPorts)
+		maps.Copy(s.InPorts, clone.InPorts)
+	}
+
+	s.Inputs = mergeMaps(parent.Inputs, clone.Inputs)
+	s.KeyBindings = mergeMaps(parent.KeyBindings, clone.KeyBindings)
+	s.GamepadBindings = mergeMaps(parent.GamepadBindings, clone.GamepadBindings)
+	s.GamepadDeadzone = cmp.Or(clone.GamepadDeadzone, parent.GamepadDeadzone)
+	inheritFields(&s.Display, parent.Display, written.Display)
+	inheritFields(&s.Video, parent.Video, written.Video)
+
+	return s
+}
 
-						matchingCM = &i
-					}
-				}
-			}
+// inheritFields sets the zero fields of s which are not written to the parent ones.
+func inheritFields[T any](s *T, parent T, written map[string]any) {
+	v, p := reflect.ValueOf(s).Elem(), reflect.ValueOf(parent)
+
+	for i := range v.NumField() {
+		name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("yaml"), ",")
+
+		if _, ok := written[name]; !ok && v.Field(i).IsZero() {
+			v.Field(i).Set(p.Field(i))
 		}
 	}
+}
+
+// Files returns every file of the game archive, ROM parts first then color PROMs.
+func (s *GameSpec) Files() []ROMFile {
+	files := make([]ROMFile, 0, len(s.ROMParts)+len(s.ColorPROMs))
+
+	for _, p := range s.ROMParts {
+		files = append(files, p.ROMFile)
+	}
+
+	for _, p := range s.ColorPROMs {
+		files = append(files, p.ROMFile)
+	}
 
-	return nil
+	return files
 }
@@ -0,0 +1,411 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_GameSpecParent(t *testing.T) {
+	configBytes := []uint8(`
+video:
+  persistence: 0.3
+gameSpecs:
+  parent:
+    romParts:
+      - fileName: a
+        startAddr: 0x0
+        expectedSize: 0x800
+      - fileName: b
+        startAddr: 0x800
+        expectedSize: 0x800
+    colorOverlays:
+      - yMin: 32
+        yMax: 61
+        color: 0xFFFF0000
+    inPorts:
+      1:
+        - bit: 0
+          active: true
+      2:
+        - bit: 7
+          active: true
+    display:
+      rotation: 90
+      flipX: true
+    video:
+      scanlines: 0.5
+      gamma: 2
+  clone:
+    parent: parent
+    romParts:
+      - fileName: c
+        startAddr: 0x0
+        expectedSize: 0x800
+    inPorts:
+      2:
+        - bit: 7
+          active: false
+    keyBindings:
+      Space: p1_fire
+    display:
+      rotation: 0
+    video:
+      scanlines: 0
+      persistence: 0
+  grandclone:
+    parent: clone
+  orphan:
+    parent: missing
+  cycle1:
+    parent: cycle2
+  cycle2:
+    parent: cycle1
+`)
+
+	c, err := ParseConfig(configBytes)
+	require.NoError(t, err)
+
+	t.Run("clone inherits and overrides parent", func(t *testing.T) {
+		s, err := c.GameSpec("clone")
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"c", "b"}, []string{s.ROMParts[0].FileName, s.ROMParts[1].FileName})
+		assert.Equal(t, c.GameSpecs["parent"].ColorOverlays, s.ColorOverlays)
+		assert.True(t, s.InPorts[1][0].Active)
+		assert.False(t, s.InPorts[2][0].Active)
+		assert.True(t, c.GameSpecs["parent"].InPorts[2][0].Active)
+		assert.Equal(t, Input{Port: 1, Bit: 4}, s.Inputs["p1_fire"])
+		assert.Equal(t, "p1_fire", s.KeyBindings["Space"])
+		assert.Equal(t, "p1_fire", s.KeyBindings["Left Ctrl"])
+	})
+
+	t.Run("written zero values are not inherited", func(t *testing.T) {
+		for _, name := range []string{"clone", "grandclone"} {
+			s, err := c.GameSpec(name)
+			require.NoError(t, err)
+
+			assert.Equal(t, Display{FlipX: true}, s.Display, name)
+			assert.Equal(t, Video{Gamma: 2}, s.Video, name)
+		}
+
+		s, err := c.GameSpec("parent")
+		require.NoError(t, err)
+
+		assert.Equal(t, Display{Rotation: 90, FlipX: true}, s.Display)
+		assert.Equal(t, Video{Scanlines: 0.5, Persistence: 0.3, Gamma: 2}, s.Video)
+	})
+
+	t.Run("unresolved parent", func(t *testing.T) {
+		_, err := c.GameSpec("orphan")
+		assert.ErrorContains(t, err, "unresolved parent missing")
+	})
+
+	t.Run("parent cycle", func(t *testing.T) {
+		_, err := c.GameSpec("cycle1")
+		assert.ErrorContains(t, err, "cycle1 -> cycle2 -> cycle1")
+	})
+}
+
+func Test_Check(t *testing.T) {
+	configBytes := []uint8(`gameSpecs:
+  game:
+    romPart:
+      - fileName: a
+    romParts:
+      - fileName: a
+        startAddr: 0x0
+        expectedSize: 0x800
+        crc: 0x1
+      - fileName: b
+        startAddr: 0x400
+        expectedSize: 0x800
+    inPorts:
+      9:
+        - bit: 0
+      2:
+        - bit: 8
+    colorOverlays:
+      - yMin: 0
+        yMax: 100
+        color: 0xFFFF0000
+      - yMin: 50
+        yMax: 256
+        color: 0xFF00FF00
+`)
+
+	err := Check(configBytes)
+	require.Error(t, err)
+
+	assert.Equal(t, []string{
+		`line 3: $.gameSpecs.game: unknown key "romPart"`,
+		`line 9: $.gameSpecs.game.romParts[0]: unknown key "crc"`,
+		"line 17: game: in ports: bit 8 of port 2 is out of range (0-7)",
+		"line 14: game: in ports: port 9 is out of range (0-7)",
+		"line 22: game: color overlays: overlay 1 is outside of the screen (max x: 223, max y: 255)",
+		"line 22: game: color overlays: overlays 0 and 1 are overlapping at pixel x: 0, y: 50",
+		"line 5: game: game parts: part a (start: 0, end: 800) overlaps with part b (start: 400, end: c00)",
+	}, strings.Split(err.Error(), "\n"))
+
+	_, err = ParseConfig(configBytes)
+	assert.ErrorContains(t, err, "unknown field")
+}
+
+func Test_CheckConfigFile(t *testing.T) {
+	configBytes, err := os.ReadFile("../../../config.yaml")
+	require.NoError(t, err)
+
+	assert.NoError(t, Check(configBytes))
+}
+
+func Test_CheckActivePosition(t *testing.T) {
+	configBytes := []uint8(`gameSpecs:
+  game:
+    romParts:
+      - fileName: a
+        startAddr: 0x0
+        expectedSize: 0x800
+    inPorts:
+      1:
+        - bit: 0
+          activePosition: low
+    inputs:
+      p1_fire: { port: 1, bit: 4, activePosition: up }
+`)
+
+	err := Check(configBytes)
+	require.Error(t, err)
+
+	assert.Equal(t, []string{
+		`line 12: game: inputs: input p1_fire has an invalid active position "up" (low, high)`,
+		"line 8: game: inputs: input coin and in port 1 use bit 0 of port 1 with different active positions",
+	}, strings.Split(err.Error(), "\n"))
+}
+
+func Test_CheckVideo(t *testing.T) {
+	configBytes := []uint8(`video:
+  gamma: 6
+gameSpecs:
+  game:
+    romParts:
+      - fileName: a
+        startAddr: 0x0
+        expectedSize: 0x800
+    video:
+      scanlines: 1.5
+      bezel: bezel.png
+`)
+
+	err := Check(configBytes)
+	require.Error(t, err)
+
+	assert.Equal(t, []string{
+		"line 2: global: video: gamma 6 is out of range (0-5)",
+		"line 10: game: video: scanlines 1.5 is out of range (0-1)",
+		"line 9: game: video: bezel bezel.png has no screen position",
+	}, strings.Split(err.Error(), "\n"))
+}
+
+func Test_CheckGamepadDeadzone(t *testing.T) {
+	configBytes := []uint8(`gamepadDeadzone: 4000
+gameSpecs:
+  game:
+    romParts:
+      - fileName: a
+        startAddr: 0x0
+        expectedSize: 0x800
+    gamepadDeadzone: 32767
+`)
+
+	err := Check(configBytes)
+	require.Error(t, err)
+
+	assert.Equal(t, []string{
+		"line 8: game: gamepad deadzone 32767 is out of range (0-32000)",
+	}, strings.Split(err.Error(), "\n"))
+}
+
+func Test_CheckDisplay(t *testing.T) {
+	configBytes := []uint8(`gameSpecs:
+  game:
+    romParts:
+      - fileName: a
+        startAddr: 0x0
+        expectedSize: 0x800
+    keyBindings:
+      Up: p1_up
+      U: p3_up
+    display:
+      rotation: 45
+      cocktailFlip: { port: 5, bit: 8 }
+`)
+
+	err := Check(configBytes)
+	require.Error(t, err)
+
+	assert.Equal(t, []string{
+		"line 11: game: display: rotation 45 is not 0, 90, 180 or 270",
+		"line 12: game: display: cocktail flip port 5 bit 8 is out of range (0-7)",
+		`line 2: game: key bindings: key "U" is bound to unknown input or action p3_up`,
+	}, strings.Split(err.Error(), "\n"))
+}
+
+func Test_CheckEnv(t *testing.T) {
+	configBytes := []uint8(`gameSpecs:
+  game:
+    romParts:
+      - fileName: a
+        startAddr: 0x0
+        expectedSize: 0x800
+    env:
+      score: { addr: 0xFFFF, size: 2, bcd: true }
+      start: [coin, p3_start]
+`)
+
+	err := Check(configBytes)
+	require.Error(t, err)
+
+	assert.Equal(t, []string{
+		"line 8: game: env: score at ffff overflows the memory",
+		"line 7: game: env: lives or playing is needed to end the episodes",
+		"line 9: game: env: start input p3_start is unknown",
+	}, strings.Split(err.Error(), "\n"))
+
+	score := RAMValue{BCD: true, Size: 2}
+	assert.Equal(t, 1250, score.Decode([]uint8{0x50, 0x12}))
+}
+
+func Test_ImportMAME(t *testing.T) {
+	const invaders = `  <machine name="invaders" sourcefile="mw8080bw.cpp">
+    <rom name="invaders.h" size="2048" crc="734f5ad8" sha1="FF6200AF4C9110D8181249CBCEF1A8A40FA40B7F" region="maincpu" offset="0"/>
+    <rom name="invaders.g" size="2048" crc="6bfaca4a" region="maincpu" offset="800"/>
+  </machine>
+`
+
+	const sitv = `  <machine name="sitv" sourcefile="mw8080bw.cpp" cloneof="invaders">
+    <rom name="tv0h.s1" size="2048" crc="fef18aad" region="maincpu" offset="0"/>
+    <rom name="invaders.g" merge="invaders.g" size="2048" crc="6bfaca4a" region="maincpu" offset="800"/>
+    <rom name="tv.prom" size="32" status="nodump" region="proms"/>
+  </machine>
+`
+
+	tests := []struct {
+		name      string
+		config    string
+		xml       string
+		want      string
+		wantNames []string
+		wantErr   string
+	}{
+		{
+			name:   "new games",
+			config: "# Games\ngameSpecs: {}\n",
+			xml:    "<mame>\n" + invaders + sitv + `  <machine name="galaxian" sourcefile="galaxian.cpp"/>` + "\n</mame>",
+			want: `# Games
+gameSpecs:
+  invaders:
+    romParts:
+      - fileName: invaders.h
+        startAddr: 0x0
+        expectedSize: 0x800
+        crc32: 0x734f5ad8
+        sha1: ff6200af4c9110d8181249cbcef1a8a40fa40b7f
+      - fileName: invaders.g
+        startAddr: 0x800
+        expectedSize: 0x800
+        crc32: 0x6bfaca4a
+  sitv:
+    parent: invaders
+    romParts:
+      - fileName: tv0h.s1
+        startAddr: 0x0
+        expectedSize: 0x800
+        crc32: 0xfef18aad
+`,
+			wantNames: []string{"invaders", "sitv"},
+		},
+		{
+			name: "existing game with comments",
+			config: `# Games
+gameSpecs:
+  # Midway original
+  invaders:
+    romParts:
+      - fileName: old
+        startAddr: 0x0
+        expectedSize: 0x800
+    display:
+      rotation: 270 # upright cabinet
+`,
+			xml: "<mame>\n" + invaders + "</mame>",
+			want: `# Games
+gameSpecs:
+  # Midway original
+  invaders:
+    romParts:
+      - fileName: invaders.h
+        startAddr: 0x0
+        expectedSize: 0x800
+        crc32: 0x734f5ad8
+        sha1: ff6200af4c9110d8181249cbcef1a8a40fa40b7f
+      - fileName: invaders.g
+        startAddr: 0x800
+        expectedSize: 0x800
+        crc32: 0x6bfaca4a
+    display:
+      rotation: 270 # upright cabinet
+`,
+			wantNames: []string{"invaders"},
+		},
+		{
+			name:      "clone without its parent keeps the merged files",
+			config:    "gameSpecs: {}\n",
+			xml:       "<mame>\n" + sitv + "</mame>",
+			want:      "gameSpecs:\n  sitv:\n    romParts:\n      - fileName: tv0h.s1\n        startAddr: 0x0\n        expectedSize: 0x800\n        crc32: 0xfef18aad\n      - fileName: invaders.g\n        startAddr: 0x800\n        expectedSize: 0x800\n        crc32: 0x6bfaca4a\n",
+			wantNames: []string{"sitv"},
+		},
+		{
+			name:      "empty game specs",
+			config:    "romDir: roms\ngameSpecs:\n",
+			xml:       `<mame><machine name="sitv" sourcefile="mw8080bw.cpp"><rom name="a" size="16" region="maincpu" offset="0"/></machine></mame>`,
+			want:      "romDir: roms\ngameSpecs:\n  sitv:\n    romParts:\n      - fileName: a\n        startAddr: 0x0\n        expectedSize: 0x10\n",
+			wantNames: []string{"sitv"},
+		},
+		{
+			name:    "invalid xml",
+			config:  "gameSpecs: {}\n",
+			xml:     "<mame><machine name=",
+			wantErr: "failed to parse mame xml",
+		},
+		{
+			name:    "invalid rom size",
+			config:  "gameSpecs: {}\n",
+			xml:     `<mame><machine name="invaders" sourcefile="mw8080bw.cpp"><rom name="a" size="big" region="maincpu" offset="0"/></machine></mame>`,
+			wantErr: `machine invaders: rom a: invalid size "big"`,
+		},
+		{
+			name:    "no supported machine",
+			config:  "gameSpecs: {}\n",
+			xml:     `<mame><machine name="galaxian" sourcefile="galaxian.cpp"/></mame>`,
+			wantErr: "no 8080bw/mw8080bw machine found in mame xml",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, names, err := ImportMAME([]uint8(tt.config), []uint8(tt.xml))
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, strings.TrimSuffix(string(out), "\n"))
+			assert.Equal(t, tt.wantNames, names)
+		})
+	}
+}
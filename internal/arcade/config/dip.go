@@ -0,0 +1,44 @@
+package config
+
+import "slices"
+
+type DIPSetting struct {
+	Label string `yaml:"label"`
+	Value uint8  `yaml:"value"`
+}
+
+// DIPSwitch is a named group of input port bits, the setting value bits are mapped to Bits in order.
+type DIPSwitch struct {
+	Name     string       `yaml:"name"`
+	Port     uint8        `yaml:"port"`
+	Bits     []uint8      `yaml:"bits"`
+	Default  string       `yaml:"default"`
+	Settings []DIPSetting `yaml:"settings"`
+}
+
+func (d *DIPSwitch) Setting(label string) (DIPSetting, bool) {
+	i := slices.IndexFunc(d.Settings, func(s DIPSetting) bool { return s.Label == label })
+	if i == -1 {
+		return DIPSetting{}, false
+	}
+
+	return d.Settings[i], true
+}
+
+// DefaultSetting returns the default setting, the first one when no default is set.
+func (d *DIPSwitch) DefaultSetting() DIPSetting {
+	if s, ok := d.Setting(d.Default); ok {
+		return s
+	}
+
+	return d.Settings[0]
+}
+
+func (d *DIPSwitch) Labels() []string {
+	labels := make([]string, len(d.Settings))
+	for i, s := range d.Settings {
+		labels[i] = s.Label
+	}
+
+	return labels
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+const MAX_RAM_VALUE_SIZE uint8 = 4
+
+// RAMValue is a number stored by a game in RAM, little endian like the 8080.
+type RAMValue struct {
+	Addr uint16 `yaml:"addr"`
+	// Bytes of the value, 1 when unset
+	Size uint8 `yaml:"size"`
+	// Binary coded decimal digits, like the scores of most games
+	BCD bool `yaml:"bcd"`
+}
+
+// Env describes a game for the learning environment: where its score and lives are, and how to start a game.
+type Env struct {
+	Score *RAMValue `yaml:"score"`
+	Lives *RAMValue `yaml:"lives"`
+	// Non-zero while a game is played, zero in attract mode and once the game is over
+	Playing *RAMValue `yaml:"playing"`
+	// Inputs pressed in turn to start a game, coin then p1_start when unset
+	Start []string `yaml:"start"`
+	// Inputs pressed by each action, no input then every player 1 input alone when unset
+	Actions [][]string `yaml:"actions"`
+}
+
+// DefaultEnvStart starts a one player game on the Midway 8080 hardware.
+var DefaultEnvStart = []string{"coin", "p1_start"}
+
+func (v *RAMValue) Bytes() uint8 {
+	return max(v.Size, 1)
+}
+
+// Decode returns the value from the RAM bytes at its address.
+func (v *RAMValue) Decode(b []uint8) int {
+	value := 0
+
+	for i := len(b) - 1; i >= 0; i-- {
+		if v.BCD {
+			value = value*100 + int(b[i]>>4)*10 + int(b[i]&0xF)
+		} else {
+			value = value<<8 | int(b[i])
+		}
+	}
+
+	return value
+}
+
+// EnvStart returns the inputs starting a game.
+func (s *GameSpec) EnvStart() []string {
+	if s.Env == nil || len(s.Env.Start) == 0 {
+		return DefaultEnvStart
+	}
+
+	return s.Env.Start
+}
+
+// EnvActions returns the inputs of each action, the first action is a no-op unless set otherwise.
+func (s *GameSpec) EnvActions() [][]string {
+	if s.Env != nil && len(s.Env.Actions) > 0 {
+		return s.Env.Actions
+	}
+
+	actions := [][]string{{}}
+
+	for _, name := range slices.Sorted(maps.Keys(s.Inputs)) {
+		if strings.HasPrefix(name, "p1_") && name != "p1_start" {
+			actions = append(actions, []string{name})
+		}
+	}
+
+	return actions
+}
+
+func validateEnv(path, gameName string, s *GameSpec) []error {
+	if s.Env == nil {
+		return nil
+	}
+
+	var errs []error
+
+	path += ".env"
+
+	for _, v := range []struct {
+		name  string
+		value *RAMValue
+	}{{"score", s.Env.Score}, {"lives", s.Env.Lives}, {"playing", s.Env.Playing}} {
+		if v.value == nil {
+			continue
+		}
+
+		if v.value.Size > MAX_RAM_VALUE_SIZE {
+			errs = append(errs, newError(path+"."+v.name, "%s: env: %s size %d is out of range (1-%d)", gameName, v.name, v.value.Size, MAX_RAM_VALUE_SIZE))
+		} else if int(v.value.Addr)+int(v.value.Bytes()) > 0x10000 {
+			errs = append(errs, newError(path+"."+v.name, "%s: env: %s at %x overflows the memory", gameName, v.name, v.value.Addr))
+		}
+	}
+
+	if s.Env.Lives == nil && s.Env.Playing == nil {
+		errs = append(errs, newError(path, "%s: env: lives or playing is needed to end the episodes", gameName))
+	}
+
+	for i, name := range s.Env.Start {
+		if _, ok := s.Inputs[name]; !ok {
+			errs = append(errs, newError(fmt.Sprintf("%s.start[%d]", path, i), "%s: env: start input %s is unknown", gameName, name))
+		}
+	}
+
+	for i, action := range s.Env.Actions {
+		for _, name := range action {
+			if _, ok := s.Inputs[name]; !ok {
+				errs = append(errs, newError(fmt.Sprintf("%s.actions[%d]", path, i), "%s: env: action %d input %s is unknown", gameName, i, name))
+			}
+		}
+	}
+
+	return errs
+}
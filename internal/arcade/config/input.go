@@ -0,0 +1,157 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// Input is the port bit driven by a logical input, the bit is set when the input is pressed unless it is active low.
+type Input struct {
+	Port           uint8          `yaml:"port"`
+	Bit            uint8          `yaml:"bit"`
+	ActivePosition activePosition `yaml:"activePosition"`
+}
+
+// Emulator actions that can be bound like logical inputs.
+const (
+	ACTION_PAUSE      = "pause"
+	ACTION_RESET      = "reset"
+	ACTION_SAVE_STATE = "save_state"
+	ACTION_LOAD_STATE = "load_state"
+	ACTION_DIP_SELECT = "dip_select"
+	ACTION_DIP_CHANGE = "dip_change"
+	ACTION_SAVE_SLOT  = "save_slot"
+	ACTION_TOGGLE_OSD = "toggle_osd"
+	ACTION_MENU       = "menu"
+	ACTION_FULLSCREEN = "fullscreen"
+	// Speed actions, fast_forward is held and frame_advance pauses the game then runs one frame per press
+	ACTION_SPEED_UP      = "speed_up"
+	ACTION_SPEED_DOWN    = "speed_down"
+	ACTION_FAST_FORWARD  = "fast_forward"
+	ACTION_FRAME_ADVANCE = "frame_advance"
+)
+
+var Actions = []string{
+	ACTION_PAUSE, ACTION_RESET, ACTION_SAVE_STATE, ACTION_LOAD_STATE, ACTION_DIP_SELECT, ACTION_DIP_CHANGE, ACTION_SAVE_SLOT,
+	ACTION_TOGGLE_OSD, ACTION_MENU, ACTION_FULLSCREEN, ACTION_SPEED_UP, ACTION_SPEED_DOWN, ACTION_FAST_FORWARD, ACTION_FRAME_ADVANCE,
+}
+
+// DefaultInputs are the logical inputs of the Midway 8080 hardware, used when a config does not define them.
+var DefaultInputs = map[string]Input{
+	"coin":     {Port: 1, Bit: 0},
+	"p2_start": {Port: 1, Bit: 1},
+	"p1_start": {Port: 1, Bit: 2},
+	"p1_fire":  {Port: 1, Bit: 4},
+	"p1_left":  {Port: 1, Bit: 5},
+	"p1_right": {Port: 1, Bit: 6},
+	"p2_fire":  {Port: 2, Bit: 4},
+	"p2_left":  {Port: 2, Bit: 5},
+	"p2_right": {Port: 2, Bit: 6},
+}
+
+// DefaultKeyBindings map SDL key names to logical inputs or actions, used when a config does not define them.
+// Up and down drive left and right when the screen is turned a quarter.
+var DefaultKeyBindings = map[string]string{
+	"5":         "coin",
+	"1":         "p1_start",
+	"2":         "p2_start",
+	"Left":      "p1_left",
+	"Right":     "p1_right",
+	"Up":        "p1_up",
+	"Down":      "p1_down",
+	"Left Ctrl": "p1_fire",
+	"A":         "p2_left",
+	"D":         "p2_right",
+	"W":         "p2_fire",
+	"P":         ACTION_PAUSE,
+	"R":         ACTION_RESET,
+	"0":         ACTION_SAVE_STATE,
+	"9":         ACTION_LOAD_STATE,
+	"F1":        ACTION_TOGGLE_OSD,
+	"F2":        ACTION_DIP_SELECT,
+	"F3":        ACTION_DIP_CHANGE,
+	"F4":        ACTION_SAVE_SLOT,
+	"F11":       ACTION_FULLSCREEN,
+	"=":         ACTION_SPEED_UP,
+	"-":         ACTION_SPEED_DOWN,
+	"Tab":       ACTION_FAST_FORWARD,
+	"F":         ACTION_FRAME_ADVANCE,
+	"Escape":    ACTION_MENU,
+}
+
+// DefaultGamepadBindings map SDL gamepad buttons, and axes with their direction, to logical inputs or actions.
+// Inputs are relative to the player of the gamepad: "fire" is "p1_fire" for the first gamepad, "p2_fire" for the second.
+var DefaultGamepadBindings = map[string]string{
+	"dpleft":  "left",
+	"dpright": "right",
+	"dpup":    "up",
+	"dpdown":  "down",
+	"leftx-":  "left",
+	"leftx+":  "right",
+	"lefty-":  "up",
+	"lefty+":  "down",
+	"south":   "fire",
+	"east":    "fire",
+	"back":    "coin",
+	"start":   "start",
+	"guide":   ACTION_MENU,
+}
+
+const (
+	DEFAULT_GAMEPAD_DEADZONE uint16 = 8000
+	// Axes range from -32768 to 32767, sticks would not leave a higher deadzone
+	MAX_GAMEPAD_DEADZONE uint16 = 32000
+)
+
+// PlayerInput returns the input of a player for a player-relative input name, or the name itself if the player has none.
+func PlayerInput(inputs map[string]Input, player int, name string) string {
+	playerName := fmt.Sprintf("p%d_%s", player, name)
+	if _, ok := inputs[playerName]; ok || DirectionalInput(inputs, playerName) {
+		return playerName
+	}
+
+	return name
+}
+
+// Directions are the suffixes of directional inputs (p1_left), which follow the screen orientation.
+var Directions = []string{"left", "right", "up", "down"}
+
+// DirectionalInput reports whether name is a direction of a player with directional inputs, even if the game has
+// no input for this direction: a turned screen maps it to another one.
+func DirectionalInput(inputs map[string]Input, name string) bool {
+	prefix, dir, ok := cutDirection(name)
+	if !ok || !slices.Contains(Directions, dir) {
+		return false
+	}
+
+	for _, d := range Directions {
+		if _, ok := inputs[prefix+d]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// cutDirection splits a directional input name after its last underscore.
+func cutDirection(name string) (string, string, bool) {
+	i := strings.LastIndex(name, "_")
+	if i == -1 {
+		return "", "", false
+	}
+
+	return name[:i+1], name[i+1:], true
+}
+
+// mergeMaps returns a new map with the entries of every map, later maps taking precedence.
+func mergeMaps[M ~map[K]V, K comparable, V any](ms ...M) M {
+	merged := M{}
+
+	for _, m := range ms {
+		maps.Copy(merged, m)
+	}
+
+	return merged
+}
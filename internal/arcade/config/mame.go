@@ -0,0 +1,351 @@
+package config
+
+import (
+	"cmp"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+)
+
+// MAME source files of the drivers emulated by goarcade.
+var mameDrivers = []string{"8080bw.cpp", "mw8080bw.cpp"}
+
+type mameList struct {
+	Machines []mameMachine `xml:"machine"`
+	// Older MAME versions use <game> elements
+	Games []mameMachine `xml:"game"`
+}
+
+type mameMachine struct {
+	Name       string    `xml:"name,attr"`
+	SourceFile string    `xml:"sourcefile,attr"`
+	CloneOf    string    `xml:"cloneof,attr"`
+	ROMs       []mameROM `xml:"rom"`
+}
+
+type mameROM struct {
+	Name   string `xml:"name,attr"`
+	Size   string `xml:"size,attr"`
+	CRC    string `xml:"crc,attr"`
+	SHA1   string `xml:"sha1,attr"`
+	Region string `xml:"region,attr"`
+	Offset string `xml:"offset,attr"`
+	Merge  string `xml:"merge,attr"`
+	Status string `xml:"status,attr"`
+}
+
+// ImportMAME reads a MAME -listxml excerpt and merges the game specs of the supported drivers into a config.
+// ROM parts, color PROMs and parents of existing games are replaced, other keys and comments are kept.
+// It returns the updated config and the names of the imported games.
+func ImportMAME(configBytes, xmlBytes []uint8) ([]uint8, []string, error) {
+	var list mameList
+
+	if err := xml.Unmarshal(xmlBytes, &list); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse mame xml: %w", err)
+	}
+
+	config, err := ParseConfig(configBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	machines := slices.DeleteFunc(append(list.Machines, list.Games...), func(m mameMachine) bool {
+		return !slices.Contains(mameDrivers, filepath.Base(m.SourceFile))
+	})
+
+	if len(machines) == 0 {
+		return nil, nil, errors.New("no 8080bw/mw8080bw machine found in mame xml")
+	}
+
+	known := func(name string) bool {
+		_, ok := config.GameSpecs[name]
+
+		return ok || slices.ContainsFunc(machines, func(m mameMachine) bool { return m.Name == name })
+	}
+
+	f, err := parser.ParseBytes(configBytes, parser.ParseComments)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse gamespecs: %w", err)
+	}
+
+	names := make([]string, 0, len(machines))
+
+	for _, m := range machines {
+		spec, err := m.gameSpec(known(m.CloneOf))
+		if err != nil {
+			return nil, nil, fmt.Errorf("machine %s: %w", m.Name, err)
+		}
+
+		if len(spec.ROMParts) == 0 && spec.Parent == "" {
+			continue
+		}
+
+		if _, ok := config.GameSpecs[m.Name]; ok {
+			err = replaceGameSpec(f, m.Name, spec)
+		} else {
+			err = addGameSpec(f, m.Name, spec)
+		}
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("machine %s: %w", m.Name, err)
+		}
+
+		names = append(names, m.Name)
+	}
+
+	out := []uint8(f.String() + "\n")
+
+	// Make sure the merged config is still readable
+	if _, err := ParseConfig(out); err != nil {
+		return nil, nil, err
+	}
+
+	return out, names, nil
+}
+
+// gameSpec converts a MAME machine, files merged from the parent are omitted when the parent is known.
+func (m mameMachine) gameSpec(withParent bool) (GameSpec, error) {
+	var s GameSpec
+
+	if m.CloneOf != "" && withParent {
+		s.Parent = m.CloneOf
+	}
+
+	for _, r := range m.ROMs {
+		if r.Status == "nodump" || (s.Parent != "" && r.Merge != "") {
+			continue
+		}
+
+		size, err := strconv.ParseUint(r.Size, 10, 16)
+		if err != nil {
+			return s, fmt.Errorf("rom %s: invalid size %q", r.Name, r.Size)
+		}
+
+		var crc uint64
+
+		if r.CRC != "" {
+			crc, err = strconv.ParseUint(r.CRC, 16, 32)
+			if err != nil {
+				return s, fmt.Errorf("rom %s: invalid crc %q", r.Name, r.CRC)
+			}
+		}
+
+		f := ROMFile{FileName: r.Name, ExpectedSize: uint16(size), CRC32: uint32(crc), SHA1: strings.ToLower(r.SHA1)}
+
+		switch r.Region {
+		case "maincpu":
+			offset, err := strconv.ParseUint(strings.TrimPrefix(r.Offset, "0x"), 16, 16)
+			if err != nil {
+				return s, fmt.Errorf("rom %s: invalid offset %q", r.Name, r.Offset)
+			}
+
+			s.ROMParts = append(s.ROMParts, ROMPart{ROMFile: f, StartAddr: uint16(offset)})
+		case "proms":
+			s.ColorPROMs = append(s.ColorPROMs, ColorPROM{ROMFile: f})
+		}
+	}
+
+	slices.SortFunc(s.ROMParts, func(a, b ROMPart) int { return cmp.Compare(a.StartAddr, b.StartAddr) })
+
+	return s, nil
+}
+
+func romFileYAML(b *strings.Builder, f ROMFile, indent string) {
+	if f.CRC32 != 0 {
+		fmt.Fprintf(b, "%scrc32: 0x%08x\n", indent, f.CRC32)
+	}
+
+	if f.SHA1 != "" {
+		fmt.Fprintf(b, "%ssha1: %s\n", indent, f.SHA1)
+	}
+}
+
+// romPartsYAML renders ROM parts the way config.yaml is written by hand, with hexadecimal addresses.
+func romPartsYAML(parts []ROMPart) string {
+	var b strings.Builder
+
+	for _, p := range parts {
+		fmt.Fprintf(&b, "- fileName: %s\n  startAddr: 0x%X\n  expectedSize: 0x%X\n", yamlString(p.FileName), p.StartAddr, p.ExpectedSize)
+		romFileYAML(&b, p.ROMFile, "  ")
+	}
+
+	return b.String()
+}
+
+func colorPROMsYAML(proms []ColorPROM) string {
+	var b strings.Builder
+
+	for _, p := range proms {
+		fmt.Fprintf(&b, "- fileName: %s\n  expectedSize: 0x%X\n", yamlString(p.FileName), p.ExpectedSize)
+		romFileYAML(&b, p.ROMFile, "  ")
+	}
+
+	return b.String()
+}
+
+// yamlString quotes file names that would not be decoded as strings, like "01.1".
+func yamlString(s string) string {
+	if _, err := strconv.ParseFloat(s, 64); err == nil || strings.ContainsAny(s, ":#'\"[]{}, ") {
+		return strconv.Quote(s)
+	}
+
+	return s
+}
+
+func yamlNode(s string) (ast.Node, error) {
+	f, err := parser.ParseBytes([]uint8(s), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return f.Docs[0].Body, nil
+}
+
+func setKey(f *ast.File, gamePath, key, value string) error {
+	node, err := yamlNode(value)
+	if err != nil {
+		return err
+	}
+
+	p, err := yaml.PathString(gamePath + "." + key)
+	if err != nil {
+		return err
+	}
+
+	if _, err := p.FilterFile(f); err == nil {
+		return p.ReplaceWithNode(f, node)
+	}
+
+	if strings.Contains(value, "\n") {
+		node, err = yamlNode(key + ":\n" + indent(value))
+	} else {
+		node, err = yamlNode(key + ": " + value)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	p, err = yaml.PathString(gamePath)
+	if err != nil {
+		return err
+	}
+
+	return p.MergeFromNode(f, node)
+}
+
+func replaceGameSpec(f *ast.File, name string, s GameSpec) error {
+	gamePath := "$.gameSpecs." + name
+
+	if s.Parent != "" {
+		if err := setKey(f, gamePath, "parent", s.Parent); err != nil {
+			return err
+		}
+	}
+
+	if len(s.ROMParts) > 0 {
+		if err := setKey(f, gamePath, "romParts", romPartsYAML(s.ROMParts)); err != nil {
+			return err
+		}
+	}
+
+	if len(s.ColorPROMs) > 0 {
+		if err := setKey(f, gamePath, "colorPROMs", colorPROMsYAML(s.ColorPROMs)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func addGameSpec(f *ast.File, name string, s GameSpec) error {
+	var b strings.Builder
+
+	b.WriteString(name + ":\n")
+
+	if s.Parent != "" {
+		b.WriteString("  parent: " + s.Parent + "\n")
+	}
+
+	if len(s.ROMParts) > 0 {
+		b.WriteString("  romParts:\n" + indent(indent(romPartsYAML(s.ROMParts))))
+	}
+
+	if len(s.ColorPROMs) > 0 {
+		b.WriteString("  colorPROMs:\n" + indent(indent(colorPROMsYAML(s.ColorPROMs))))
+	}
+
+	node, err := yamlNode(b.String())
+	if err != nil {
+		return err
+	}
+
+	p, err := yaml.PathString("$.gameSpecs")
+	if err != nil {
+		return err
+	}
+
+	specs, err := p.FilterFile(f)
+	if err != nil {
+		return err
+	}
+
+	// Flow mappings are not merged with block ones, an empty one like {} is replaced
+	switch n := specs.(type) {
+	case *ast.NullNode:
+		return setGameSpecs(f, node)
+	case *ast.MappingNode:
+		if n.IsFlowStyle && len(n.Values) == 0 {
+			return setGameSpecs(f, node)
+		}
+
+		if n.IsFlowStyle {
+			return errors.New("gameSpecs is a flow mapping, write it as a block mapping to import games")
+		}
+	}
+
+	return p.MergeFromNode(f, node)
+}
+
+// setGameSpecs replaces the empty gameSpecs of a config, indenting the games under the key.
+func setGameSpecs(f *ast.File, node ast.Node) error {
+	var values []*ast.MappingValueNode
+
+	switch root := f.Docs[0].Body.(type) {
+	case *ast.MappingNode:
+		values = root.Values
+	case *ast.MappingValueNode:
+		values = []*ast.MappingValueNode{root}
+	}
+
+	for _, v := range values {
+		if v.Key.GetToken().Value == "gameSpecs" {
+			node.AddColumn(v.Key.GetToken().Position.Column + 1)
+			v.Value = node
+
+			return nil
+		}
+	}
+
+	return errors.New("no gameSpecs found in config")
+}
+
+func indent(s string) string {
+	lines := strings.SplitAfter(s, "\n")
+
+	for i, l := range lines {
+		if l != "" {
+			lines[i] = "  " + l
+		}
+	}
+
+	return strings.Join(lines, "")
+}
@@ -0,0 +1,570 @@
+package config
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+)
+
+const (
+	MAX_PORT uint8 = 7
+	MAX_BIT  uint8 = 7
+
+	MAX_GAMMA = 5.0
+)
+
+// ValidationError is a config problem located by its YAML path, and by its line once located.
+type ValidationError struct {
+	Path string
+	Line int
+	Msg  string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+	}
+
+	return e.Msg
+}
+
+func newError(path, format string, a ...any) error {
+	return &ValidationError{Path: path, Msg: fmt.Sprintf(format, a...)}
+}
+
+func gamePath(gameName string) string {
+	return "$.gameSpecs." + gameName
+}
+
+// Check reports every problem of a config at once: unknown keys, then parent chains and game spec values.
+func Check(configBytes []uint8) error {
+	var config Config
+
+	if err := yaml.Unmarshal(configBytes, &config); err != nil {
+		return fmt.Errorf("failed to parse gamespecs: %w", err)
+	}
+
+	if err := config.setSource(configBytes); err != nil {
+		return fmt.Errorf("failed to parse gamespecs: %w", err)
+	}
+
+	f, err := parser.ParseBytes(configBytes, 0)
+	if err != nil {
+		return fmt.Errorf("failed to parse gamespecs: %w", err)
+	}
+
+	var errs []error
+
+	for _, doc := range f.Docs {
+		errs = append(errs, unknownKeys(doc.Body, reflect.TypeFor[Config](), "$")...)
+	}
+
+	names := make([]string, 0, len(config.GameSpecs))
+	for name := range config.GameSpecs {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	errs = append(errs, validateInputs("$", "global", config.Inputs)...)
+	errs = append(errs, validateDeadzone("$", "global", config.GamepadDeadzone)...)
+	errs = append(errs, validateVideo("$.video", "global", config.Video)...)
+
+	for _, name := range names {
+		s := config.GameSpecs[name]
+		errs = append(errs, validateSpec(name, &s)...)
+
+		if err := validateParents(&config, name); err != nil {
+			errs = append(errs, err)
+
+			continue
+		}
+
+		resolved := config.resolve(name)
+		errs = append(errs, validateResolved(name, &resolved)...)
+	}
+
+	return config.locate(errs)
+}
+
+// validateConfig checks a game spec, its ancestors and the resulting merged spec.
+func validateConfig(c *Config, gameName string) []error {
+	if err := validateParents(c, gameName); err != nil {
+		return []error{err}
+	}
+
+	errs := validateInputs("$", "global", c.Inputs)
+	errs = append(errs, validateDeadzone("$", "global", c.GamepadDeadzone)...)
+	errs = append(errs, validateVideo("$.video", "global", c.Video)...)
+
+	for _, name := range append([]string{gameName}, c.Parents(gameName)...) {
+		s := c.GameSpecs[name]
+		errs = append(errs, validateSpec(name, &s)...)
+	}
+
+	s := c.resolve(gameName)
+
+	return append(errs, validateResolved(gameName, &s)...)
+}
+
+// locate sets the line of validation errors from their path and joins them.
+func (c *Config) locate(errs []error) error {
+	if len(errs) == 0 || c.source == nil {
+		return errors.Join(errs...)
+	}
+
+	f, err := parser.ParseBytes(c.source, 0)
+	if err != nil {
+		return errors.Join(errs...)
+	}
+
+	for _, err := range errs {
+		var vErr *ValidationError
+
+		if !errors.As(err, &vErr) || vErr.Path == "" {
+			continue
+		}
+
+		if node := findNode(f, vErr.Path); node != nil {
+			vErr.Line = nodeLine(node)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// findNode returns the node at a YAML path, the key/value pair for map keys so that the key line is used.
+func findNode(f *ast.File, path string) ast.Node {
+	i := strings.LastIndex(path, ".")
+	parentPath, key := path[:i], path[i+1:]
+
+	if strings.Contains(key, "[") {
+		parentPath, key = path, ""
+	}
+
+	p, err := yaml.PathString(parentPath)
+	if err != nil {
+		return nil
+	}
+
+	node, err := p.FilterFile(f)
+	if err != nil || node == nil || key == "" {
+		return node
+	}
+
+	values := []*ast.MappingValueNode{}
+
+	switch n := node.(type) {
+	case *ast.MappingNode:
+		values = n.Values
+	case *ast.MappingValueNode:
+		values = append(values, n)
+	}
+
+	for _, v := range values {
+		if v.Key.GetToken().Value == key {
+			return v
+		}
+	}
+
+	return node
+}
+
+func nodeLine(node ast.Node) int {
+	switch n := node.(type) {
+	case *ast.MappingNode:
+		if len(n.Values) > 0 {
+			return nodeLine(n.Values[0])
+		}
+	case *ast.MappingValueNode:
+		return n.Key.GetToken().Position.Line
+	}
+
+	return node.GetToken().Position.Line
+}
+
+// unknownKeys walks the YAML tree along the config types and reports keys that match no field.
+func unknownKeys(node ast.Node, t reflect.Type, path string) []error {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	var errs []error
+
+	switch n := node.(type) {
+	case *ast.MappingNode:
+		for _, v := range n.Values {
+			errs = append(errs, unknownKeys(v, t, path)...)
+		}
+	case *ast.MappingValueNode:
+		key := n.Key.GetToken().Value
+
+		switch t.Kind() {
+		case reflect.Struct:
+			field, ok := yamlField(t, key)
+			if !ok {
+				return []error{&ValidationError{Line: nodeLine(n), Msg: fmt.Sprintf("%s: unknown key %q", path, key)}}
+			}
+
+			errs = append(errs, unknownKeys(n.Value, field.Type, path+"."+key)...)
+		case reflect.Map:
+			errs = append(errs, unknownKeys(n.Value, t.Elem(), path+"."+key)...)
+		}
+	case *ast.SequenceNode:
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			for i, v := range n.Values {
+				errs = append(errs, unknownKeys(v, t.Elem(), path+"["+strconv.Itoa(i)+"]")...)
+			}
+		}
+	}
+
+	return errs
+}
+
+// yamlField finds a struct field by its yaml tag, looking into inlined structs.
+func yamlField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+
+		if opts == "inline" {
+			if field, ok := yamlField(f.Type, key); ok {
+				return field, true
+			}
+
+			continue
+		}
+
+		if f.IsExported() && name == key {
+			return f, true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
+
+func validateParents(c *Config, gameName string) error {
+	chain := []string{gameName}
+
+	for name := gameName; c.GameSpecs[name].Parent != ""; {
+		parent := c.GameSpecs[name].Parent
+
+		if _, ok := c.GameSpecs[parent]; !ok {
+			return newError(gamePath(name)+".parent", "parent: game %s has unresolved parent %s", name, parent)
+		}
+
+		if slices.Contains(chain, parent) {
+			return newError(gamePath(name)+".parent", "parent: cycle detected %s", strings.Join(append(chain, parent), " -> "))
+		}
+
+		chain = append(chain, parent)
+		name = parent
+	}
+
+	return nil
+}
+
+// validateSpec checks the values of a game spec as written, before parent inheritance.
+func validateSpec(gameName string, s *GameSpec) []error {
+	var errs []error
+
+	path := gamePath(gameName)
+
+	for i := 1; i < len(s.ROMParts); i++ {
+		prevPart, currentPart := s.ROMParts[i-1], s.ROMParts[i]
+
+		if currentPart.StartAddr <= prevPart.StartAddr {
+			errs = append(errs, newError(fmt.Sprintf("%s.romParts[%d]", path, i), "%s: game parts: start address %x of part %s is higher than start address %x of part %s", gameName, prevPart.StartAddr, prevPart.FileName, currentPart.StartAddr, currentPart.FileName))
+		}
+	}
+
+	for i, p := range s.ROMParts {
+		if err := validateFile(p.ROMFile); err != nil {
+			errs = append(errs, newError(fmt.Sprintf("%s.romParts[%d]", path, i), "%s: %s", gameName, err))
+		}
+	}
+
+	for i, p := range s.ColorPROMs {
+		if err := validateFile(p.ROMFile); err != nil {
+			errs = append(errs, newError(fmt.Sprintf("%s.colorPROMs[%d]", path, i), "%s: %s", gameName, err))
+		}
+	}
+
+	ports := make([]int, 0, len(s.InPorts))
+	for id := range s.InPorts {
+		ports = append(ports, id)
+	}
+
+	slices.Sort(ports)
+
+	for _, id := range ports {
+		portPath := fmt.Sprintf("%s.inPorts.%d", path, id)
+
+		if id < 0 || id > int(MAX_PORT) {
+			errs = append(errs, newError(portPath, "%s: in ports: port %d is out of range (0-%d)", gameName, id, MAX_PORT))
+
+			continue
+		}
+
+		for i, p := range s.InPorts[id] {
+			if p.Bit > MAX_BIT {
+				errs = append(errs, newError(fmt.Sprintf("%s[%d]", portPath, i), "%s: in ports: bit %d of port %d is out of range (0-%d)", gameName, p.Bit, id, MAX_BIT))
+			}
+
+			if !validActivePosition(p.ActivePosition) {
+				errs = append(errs, newError(fmt.Sprintf("%s[%d]", portPath, i), "%s: in ports: bit %d of port %d has an invalid active position %q (low, high)", gameName, p.Bit, id, p.ActivePosition))
+			}
+		}
+	}
+
+	errs = append(errs, validateInputs(path, gameName, s.Inputs)...)
+	errs = append(errs, validateDeadzone(path, gameName, s.GamepadDeadzone)...)
+	errs = append(errs, validateDIPSwitches(path, gameName, s.DIPSwitches)...)
+	errs = append(errs, validateDisplay(path+".display", gameName, s.Display)...)
+	errs = append(errs, validateVideo(path+".video", gameName, s.Video)...)
+
+	for i, cm := range s.ColorOverlays {
+		overlayPath := fmt.Sprintf("%s.colorOverlays[%d]", path, i)
+
+		if cm.XMin > cm.XMax || cm.YMin > cm.YMax {
+			errs = append(errs, newError(overlayPath, "%s: color overlays: overlay %d has min coordinates higher than max coordinates", gameName, i))
+		}
+
+		if cm.XMax >= MAX_X || cm.YMax >= MAX_Y {
+			errs = append(errs, newError(overlayPath, "%s: color overlays: overlay %d is outside of the screen (max x: %d, max y: %d)", gameName, i, MAX_X-1, MAX_Y-1))
+		}
+
+		for j, other := range s.ColorOverlays[:i] {
+			if x, y, ok := overlap(other, cm); ok {
+				errs = append(errs, newError(overlayPath, "%s: color overlays: overlays %d and %d are overlapping at pixel x: %d, y: %d", gameName, j, i, x, y))
+			}
+		}
+	}
+
+	return errs
+}
+
+func validateInputs(path, name string, inputs map[string]Input) []error {
+	var errs []error
+
+	for _, inputName := range slices.Sorted(maps.Keys(inputs)) {
+		in := inputs[inputName]
+
+		if in.Port > MAX_PORT || in.Bit > MAX_BIT {
+			errs = append(errs, newError(path+".inputs."+inputName, "%s: inputs: port %d bit %d of input %s is out of range (0-%d)", name, in.Port, in.Bit, inputName, MAX_BIT))
+		}
+
+		if slices.Contains(Actions, inputName) {
+			errs = append(errs, newError(path+".inputs."+inputName, "%s: inputs: input %s has the name of an action", name, inputName))
+		}
+
+		if !validActivePosition(in.ActivePosition) {
+			errs = append(errs, newError(path+".inputs."+inputName, "%s: inputs: input %s has an invalid active position %q (low, high)", name, inputName, in.ActivePosition))
+		}
+	}
+
+	return errs
+}
+
+// validatePolarity checks that inputs and input ports sharing a bit agree on its active position.
+func validatePolarity(path, gameName string, s *GameSpec) []error {
+	var errs []error
+
+	low := map[[2]uint8]bool{}
+	declared := map[[2]uint8]string{}
+
+	declare := func(nodePath string, port, bit uint8, p activePosition, name string) {
+		key := [2]uint8{port, bit}
+		isLow := p == POSITION_LOW
+
+		if other, ok := declared[key]; ok && low[key] != isLow {
+			errs = append(errs, newError(nodePath, "%s: inputs: %s and %s use bit %d of port %d with different active positions", gameName, other, name, bit, port))
+
+			return
+		}
+
+		low[key] = isLow
+		declared[key] = name
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(s.Inputs)) {
+		in := s.Inputs[name]
+		declare(path+".inputs."+name, in.Port, in.Bit, in.ActivePosition, "input "+name)
+	}
+
+	for _, id := range slices.Sorted(maps.Keys(s.InPorts)) {
+		for _, p := range s.InPorts[id] {
+			declare(fmt.Sprintf("%s.inPorts.%d", path, id), uint8(id), p.Bit, p.ActivePosition, fmt.Sprintf("in port %d", id))
+		}
+	}
+
+	return errs
+}
+
+// validateDeadzone checks the gamepad deadzone of a config or game spec, 0 is the default one.
+func validateDeadzone(path, name string, deadzone uint16) []error {
+	if deadzone > MAX_GAMEPAD_DEADZONE {
+		return []error{newError(path+".gamepadDeadzone", "%s: gamepad deadzone %d is out of range (0-%d)", name, deadzone, MAX_GAMEPAD_DEADZONE)}
+	}
+
+	return nil
+}
+
+func validateDisplay(path, name string, d Display) []error {
+	var errs []error
+
+	if d.Rotation%90 != 0 || d.Rotation >= 360 {
+		errs = append(errs, newError(path+".rotation", "%s: display: rotation %d is not 0, 90, 180 or 270", name, d.Rotation))
+	}
+
+	if f := d.CocktailFlip; f != nil && (f.Port > MAX_PORT || f.Bit > MAX_BIT) {
+		errs = append(errs, newError(path+".cocktailFlip", "%s: display: cocktail flip port %d bit %d is out of range (0-%d)", name, f.Port, f.Bit, MAX_BIT))
+	}
+
+	return errs
+}
+
+func validateVideo(path, name string, v Video) []error {
+	var errs []error
+
+	for _, effect := range []struct {
+		name  string
+		value float64
+	}{{"scanlines", v.Scanlines}, {"persistence", v.Persistence}, {"glow", v.Glow}} {
+		if effect.value < 0 || effect.value > 1 {
+			errs = append(errs, newError(path+"."+effect.name, "%s: video: %s %g is out of range (0-1)", name, effect.name, effect.value))
+		}
+	}
+
+	if v.Gamma < 0 || v.Gamma > MAX_GAMMA {
+		errs = append(errs, newError(path+".gamma", "%s: video: gamma %g is out of range (0-%g)", name, v.Gamma, MAX_GAMMA))
+	}
+
+	if v.Bezel != "" && (v.Screen.Width == 0 || v.Screen.Height == 0) {
+		errs = append(errs, newError(path, "%s: video: bezel %s has no screen position", name, v.Bezel))
+	}
+
+	return errs
+}
+
+func validActivePosition(p activePosition) bool {
+	return p == "" || p == POSITION_LOW || p == POSITION_HIGH
+}
+
+func validateDIPSwitches(path, gameName string, dips []DIPSwitch) []error {
+	var errs []error
+
+	for i, d := range dips {
+		dipPath := fmt.Sprintf("%s.dipSwitches[%d]", path, i)
+
+		switch {
+		case d.Name == "":
+			errs = append(errs, newError(dipPath, "%s: dip switches: dip switch %d has no name", gameName, i))
+		case slices.ContainsFunc(dips[:i], func(other DIPSwitch) bool { return other.Name == d.Name }):
+			errs = append(errs, newError(dipPath, "%s: dip switches: duplicate dip switch %s", gameName, d.Name))
+		}
+
+		if d.Port > MAX_PORT || len(d.Bits) == 0 || slices.ContainsFunc(d.Bits, func(b uint8) bool { return b > MAX_BIT }) {
+			errs = append(errs, newError(dipPath, "%s: dip switches: dip switch %s must use bits 0-%d of a port 0-%d", gameName, d.Name, MAX_BIT, MAX_PORT))
+		}
+
+		if len(d.Settings) == 0 {
+			errs = append(errs, newError(dipPath, "%s: dip switches: dip switch %s has no settings", gameName, d.Name))
+
+			continue
+		}
+
+		if _, ok := d.Setting(d.Default); d.Default != "" && !ok {
+			errs = append(errs, newError(dipPath+".default", "%s: dip switches: default %q of dip switch %s is not a setting", gameName, d.Default, d.Name))
+		}
+
+		for j, setting := range d.Settings {
+			if len(d.Bits) < 8 && setting.Value >= 1<<len(d.Bits) {
+				errs = append(errs, newError(fmt.Sprintf("%s.settings[%d]", dipPath, j), "%s: dip switches: value %d of setting %s does not fit in %d bits", gameName, setting.Value, setting.Label, len(d.Bits)))
+			}
+		}
+	}
+
+	return errs
+}
+
+// validateResolved checks a game spec after parent inheritance.
+func validateResolved(gameName string, s *GameSpec) []error {
+	path := gamePath(gameName)
+
+	if len(s.ROMParts) == 0 {
+		return []error{newError(path, "%s: missing game parts", gameName)}
+	}
+
+	var errs []error
+
+	for _, key := range slices.Sorted(maps.Keys(s.KeyBindings)) {
+		action := s.KeyBindings[key]
+		if _, ok := s.Inputs[action]; action != "" && !ok && !DirectionalInput(s.Inputs, action) && !slices.Contains(Actions, action) {
+			errs = append(errs, newError(path, "%s: key bindings: key %q is bound to unknown input or action %s", gameName, key, action))
+		}
+	}
+
+	for _, control := range slices.Sorted(maps.Keys(s.GamepadBindings)) {
+		action := PlayerInput(s.Inputs, 1, s.GamepadBindings[control])
+		if _, ok := s.Inputs[action]; action != "" && !ok && !DirectionalInput(s.Inputs, action) && !slices.Contains(Actions, action) {
+			errs = append(errs, newError(path, "%s: gamepad bindings: control %q is bound to unknown input or action %s", gameName, control, action))
+		}
+	}
+
+	errs = append(errs, validatePolarity(path, gameName, s)...)
+	errs = append(errs, validateEnv(path, gameName, s)...)
+
+	for i := 1; i < len(s.ROMParts); i++ {
+		prevPart, currentPart := s.ROMParts[i-1], s.ROMParts[i]
+
+		if uint32(prevPart.StartAddr)+uint32(prevPart.ExpectedSize) > uint32(currentPart.StartAddr) && currentPart.StartAddr > prevPart.StartAddr {
+			errs = append(errs, newError(path+".romParts", "%s: game parts: part %s (start: %x, end: %x) overlaps with part %s (start: %x, end: %x)", gameName, prevPart.FileName, prevPart.StartAddr, prevPart.StartAddr+prevPart.ExpectedSize, currentPart.FileName, currentPart.StartAddr, currentPart.StartAddr+currentPart.ExpectedSize))
+		}
+	}
+
+	return errs
+}
+
+func validateFile(f ROMFile) error {
+	if f.FileName == "" {
+		return errors.New("game files: missing file name")
+	}
+
+	if _, err := hex.DecodeString(f.SHA1); err != nil || (f.SHA1 != "" && len(f.SHA1) != sha1.Size*2) {
+		return fmt.Errorf("game files: invalid sha1 %q for file %s", f.SHA1, f.FileName)
+	}
+
+	return nil
+}
+
+// bounds returns the inclusive pixel range of an overlay axis, 0/0 meaning the whole axis.
+func bounds(minV, maxV, size uint16) (uint16, uint16) {
+	if minV == 0 && maxV == 0 {
+		return 0, size - 1
+	}
+
+	return minV, maxV
+}
+
+// overlap returns the first pixel shared by two overlays.
+func overlap(a, b ColorOverlay) (uint16, uint16, bool) {
+	aXMin, aXMax := bounds(a.XMin, a.XMax, MAX_X)
+	aYMin, aYMax := bounds(a.YMin, a.YMax, MAX_Y)
+	bXMin, bXMax := bounds(b.XMin, b.XMax, MAX_X)
+	bYMin, bYMax := bounds(b.YMin, b.YMax, MAX_Y)
+
+	x, y := max(aXMin, bXMin), max(aYMin, bYMin)
+
+	return x, y, x <= min(aXMax, bXMax) && y <= min(aYMax, bYMax)
+}
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"encoding/gob"
 	"fmt"
+	"io"
+	"os"
 	"strconv"
 	"strings"
 
@@ -26,12 +28,20 @@ type CPU struct {
 	APU apu
 	state
 
+	// Input ports bits set on reset, and logical inputs released on reset and on state load
+	InPorts map[int][]config.Port
+	Inputs  map[string]config.Input
+	// Active low bits of each port, inverted when sending inputs
+	activeLow [8]uint8
+
 	Running bool
+
+	// Console of the CP/M programs, and debug traces and warnings
+	out io.Writer
+	log io.Writer
 }
 
 type state struct {
-	InPorts map[int][8]config.Port
-
 	// Cycle counter
 	Cyc uint64
 	// Program counter
@@ -43,7 +53,7 @@ type state struct {
 	SR uint16
 
 	// IO ports
-	ioPorts [8]uint8
+	IOPorts [8]uint8
 	Debug   bool
 
 	// Shift offset
@@ -63,6 +73,9 @@ type state struct {
 	Interrupts bool
 }
 
+// Snapshot is an in-memory copy of the CPU state, inputs included, much faster than a save state.
+type Snapshot state
+
 type Option func(*CPU)
 
 func WithDebug(debug bool) Option {
@@ -71,8 +84,24 @@ func WithDebug(debug bool) Option {
 	}
 }
 
+// WithOutput writes the console output of CP/M programs to w instead of stdout.
+func WithOutput(w io.Writer) Option {
+	return func(c *CPU) {
+		c.out = w
+	}
+}
+
+// WithLog writes the debug traces and warnings to w instead of stdout.
+func WithLog(w io.Writer) Option {
+	return func(c *CPU) {
+		c.log = w
+	}
+}
+
 func (c *CPU) Init(pc uint16, options ...Option) {
 	c.Running = true
+	c.out = os.Stdout
+	c.log = os.Stdout
 	c.PC = pc
 	c.SP = 0
 	c.SR = 0
@@ -88,16 +117,30 @@ func (c *CPU) Init(pc uint16, options ...Option) {
 	c.F = 2
 	c.Interrupts = false
 
+	c.activeLow = [8]uint8{}
+
 	for id, port := range c.InPorts {
 		for _, portBit := range port {
-			if portBit.Active {
-				c.ioPorts[id] |= 1 << portBit.Bit
-			} else {
-				c.ioPorts[id] &= ^(1 << portBit.Bit)
+			if portBit.ActivePosition == config.POSITION_LOW {
+				c.activeLow[id] |= 1 << portBit.Bit
 			}
 		}
 	}
 
+	for _, in := range c.Inputs {
+		if in.ActivePosition == config.POSITION_LOW {
+			c.activeLow[in.Port] |= 1 << in.Bit
+		}
+	}
+
+	for id, port := range c.InPorts {
+		for _, portBit := range port {
+			c.SendInput(uint8(id), portBit.Bit, portBit.Active)
+		}
+	}
+
+	c.releaseInputs()
+
 	for _, o := range options {
 		o(c)
 	}
@@ -123,7 +166,7 @@ func (c *CPU) Step() uint8 {
 	inst := InstByOpcode[c.Bus.Read(c.PC)]
 
 	if c.Debug {
-		fmt.Printf("%s (%02X %02X %02X %02X) %-13s\n", c, c.Bus.Read(c.PC), c.Bus.Read(c.PC+1), c.Bus.Read(c.PC+2), c.Bus.Read(c.PC+3), inst.Name+" "+inst.Op1+" "+inst.Op2)
+		fmt.Fprintf(c.log, "%s (%02X %02X %02X %02X) %-13s\n", c, c.Bus.Read(c.PC), c.Bus.Read(c.PC+1), c.Bus.Read(c.PC+2), c.Bus.Read(c.PC+3), inst.Name+" "+inst.Op1+" "+inst.Op2)
 		// fmt.Printf("%s (%02X %02X %02X %02X)\n", c, c.Bus.Read(c.pc), c.Bus.Read(c.pc+1), c.Bus.Read(c.pc+2), c.Bus.Read(c.pc+3))
 	}
 
@@ -145,11 +188,29 @@ func (c *CPU) RequestInterrupt(num uint8) {
 	}
 }
 
-func (c *CPU) SendInput(port, bit uint8, value bool) {
-	if value {
-		c.ioPorts[port] |= 1 << bit
+// ReadPort returns the latch of an I/O port, last written by the game or set by inputs.
+func (c *CPU) ReadPort(port uint8) uint8 {
+	return c.IOPorts[port]
+}
+
+// SendInput sets the level of a port bit from the state of its input, active low bits are inverted.
+func (c *CPU) SendInput(port, bit uint8, active bool) {
+	if active != (c.activeLow[port]>>bit&1 == 1) {
+		c.IOPorts[port] |= 1 << bit
 	} else {
-		c.ioPorts[port] &= ^(1 << bit)
+		c.IOPorts[port] &= ^(1 << bit)
+	}
+}
+
+// InputActive reports whether the input of a port bit is active, active low bits are inverted.
+func (c *CPU) InputActive(port, bit uint8) bool {
+	return c.IOPorts[port]>>bit&1 != c.activeLow[port]>>bit&1
+}
+
+// releaseInputs sets every logical input to its released level.
+func (c *CPU) releaseInputs() {
+	for _, in := range c.Inputs {
+		c.SendInput(in.Port, in.Bit, false)
 	}
 }
 
@@ -184,6 +245,18 @@ func (c *CPU) LoadState(stateBytes []uint8) error {
 	}
 
 	c.state = s
+	// Inputs held when the state was saved are not held anymore
+	c.releaseInputs()
 
 	return nil
 }
+
+// Snapshot copies the state of the CPU into s.
+func (c *CPU) Snapshot(s *Snapshot) {
+	*s = Snapshot(c.state)
+}
+
+// Restore brings back a state copied by Snapshot, with the inputs held when it was taken.
+func (c *CPU) Restore(s *Snapshot) {
+	c.state = state(*s)
+}
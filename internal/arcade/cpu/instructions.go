@@ -339,7 +339,7 @@ func portIn(c *CPU, _ string) {
 	case 3:
 		c.A = uint8(c.SR >> (8 - c.SO))
 	default:
-		c.A = c.ioPorts[portNumber]
+		c.A = c.IOPorts[portNumber]
 	}
 }
 
@@ -352,7 +352,7 @@ func portOut(c *CPU, _ string) {
 	case 1:
 		switch c.C {
 		case 2:
-			fmt.Print(string(c.E))
+			fmt.Fprint(c.out, string(c.E))
 		case 9:
 			addr := uint16(c.D)<<8 | uint16(c.E)
 			for offset := uint16(0); ; offset++ {
@@ -361,17 +361,17 @@ func portOut(c *CPU, _ string) {
 					break
 				}
 
-				fmt.Print(string(b))
+				fmt.Fprint(c.out, string(b))
 			}
 
 		default:
-			fmt.Printf("unimplemented out operation for port 1: %02x\n", c.C)
+			fmt.Fprintf(c.log, "unimplemented out operation for port 1: %02x\n", c.C)
 		}
 	case 2:
 		c.SO = c.A & 0x7
 	case 3:
-		rising := c.A & ^c.ioPorts[portNumber]
-		falling := c.ioPorts[portNumber] & ^c.A
+		rising := c.A & ^c.IOPorts[portNumber]
+		falling := c.IOPorts[portNumber] & ^c.A
 
 		switch {
 		case rising&1 == 1:
@@ -386,11 +386,11 @@ func portOut(c *CPU, _ string) {
 			c.APU.PlaySound(3)
 		}
 
-		c.ioPorts[portNumber] = c.A
+		c.IOPorts[portNumber] = c.A
 	case 4:
 		c.SR = uint16(c.A)<<8 | c.SR>>8
 	case 5:
-		rising := c.A & ^c.ioPorts[portNumber]
+		rising := c.A & ^c.IOPorts[portNumber]
 
 		switch {
 		case rising&1 == 1:
@@ -405,9 +405,9 @@ func portOut(c *CPU, _ string) {
 			c.APU.PlaySound(8)
 		}
 
-		c.ioPorts[portNumber] = c.A
+		c.IOPorts[portNumber] = c.A
 	case 6: // NOP for watchdog
 	default:
-		fmt.Printf("unimplemented out port: %02x\n", portNumber)
+		fmt.Fprintf(c.log, "unimplemented out port: %02x\n", portNumber)
 	}
 }
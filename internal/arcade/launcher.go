@@ -0,0 +1,197 @@
+package arcade
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Zyko0/go-sdl3/bin/binsdl"
+	"github.com/cterence/goarcade/internal/arcade/apu"
+	"github.com/cterence/goarcade/internal/arcade/config"
+	"github.com/cterence/goarcade/internal/arcade/pacing"
+	"github.com/cterence/goarcade/internal/arcade/romset"
+	"github.com/cterence/goarcade/internal/arcade/settings"
+	"github.com/cterence/goarcade/internal/arcade/ui"
+	"github.com/cterence/goarcade/machine"
+)
+
+// Launch lists the games of a ROM directory in a window, and runs the selected games in it until the window is closed.
+// The directory defaults to the config romDir then to the current directory.
+func Launch(ctx context.Context, configBytes []uint8, soundListBytes [][]uint8, romDir string, options ...Option) error {
+	lCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	c, err := config.ParseConfig(configBytes)
+	if err != nil {
+		return err
+	}
+
+	romDir = cmp.Or(romDir, c.ROMDir, ".")
+
+	defer binsdl.Load().Unload()
+
+	u := &ui.UI{
+		Inputs:          config.DefaultInputs,
+		KeyBindings:     config.DefaultKeyBindings,
+		GamepadBindings: config.DefaultGamepadBindings,
+		GamepadDeadzone: config.DEFAULT_GAMEPAD_DEADZONE,
+		TargetFPS:       machine.FPS,
+	}
+
+	ap := &apu.APU{SoundListBytes: soundListBytes}
+	ap.SetVolume(apu.MAX_VOLUME)
+	u.APU = ap
+
+	defer ap.Close()
+	defer u.Close()
+	defer saveWindow(u)
+
+	// The launcher creates the window, with the window options given for the games
+	l := newArcade(cancel, machine.New(), u, ap, options...)
+	l.initWindow()
+
+	if l.serve != "" {
+		l.server = newServer(soundListBytes)
+		l.server.listen(l.serve)
+	}
+
+	selected := ""
+
+	for lCtx.Err() == nil {
+		games, err := launcherGames(c, romDir)
+		if err != nil {
+			return err
+		}
+
+		romPath := u.Launcher(lCtx, games, selected)
+		if romPath == "" {
+			return nil
+		}
+
+		selected = romPath
+
+		romBytes, err := os.ReadFile(romPath)
+		if err != nil {
+			u.Notify("failed to read rom file: " + err.Error())
+
+			continue
+		}
+
+		m := machine.New(l.machineOpts...)
+
+		if err := m.Load(romBytes, configBytes, romPath); err != nil {
+			u.Notify("failed to load " + filepath.Base(romPath) + ": " + err.Error())
+
+			continue
+		}
+
+		recordPlayed(m.Game().Name)
+
+		gameCtx, gameCancel := context.WithCancel(lCtx)
+		a := newArcade(gameCancel, m, u, ap, options...)
+		a.server = l.server
+		a.configBytes = configBytes
+
+		err = a.run(gameCtx)
+
+		gameCancel()
+
+		if err != nil {
+			u.Notify("failed to run " + filepath.Base(romPath) + ": " + err.Error())
+		}
+
+		if a.quit {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// launcherGames audits the archives of a ROM directory, archives of unknown games are left out.
+func launcherGames(c *config.Config, romDir string) ([]ui.LauncherGame, error) {
+	entries, err := os.ReadDir(romDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rom directory: %w", err)
+	}
+
+	s, err := settings.Load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "warning: "+err.Error())
+
+		s = &settings.Settings{}
+	}
+
+	var games []ui.LauncherGame
+
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".zip" {
+			continue
+		}
+
+		romPath := filepath.Join(romDir, e.Name())
+
+		gameName, status, _ := auditFile(c, romPath)
+		if gameName == "" || status == romset.STATUS_UNKNOWN {
+			continue
+		}
+
+		games = append(games, ui.LauncherGame{
+			ROMPath:    romPath,
+			Name:       gameName,
+			Status:     string(status),
+			LastPlayed: s.LastPlayed[gameName],
+		})
+	}
+
+	return games, nil
+}
+
+// recordPlayed saves the time a game was started from the launcher, to show it in the list.
+func recordPlayed(gameName string) {
+	s, err := settings.Load()
+	if err == nil {
+		s.Played(gameName)
+		err = s.Save()
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "warning: failed to record last played game: "+err.Error())
+	}
+}
+
+// initWindow applies the window options and the saved window placement to the UI.
+func (a *arcade) initWindow() {
+	a.ui.Scale = a.scale
+	a.ui.MonitorAspect = a.monitorAspect
+	a.ui.VSync = a.sync == pacing.MODE_VSYNC
+
+	s, err := settings.Load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "warning: failed to load window placement: "+err.Error())
+
+		return
+	}
+
+	a.ui.Placement = s.Window
+}
+
+// saveWindow saves the window placement for the next run, when it changed.
+func saveWindow(u *ui.UI) {
+	s, err := settings.Load()
+	if err == nil {
+		p := u.WindowPlacement()
+		if p == s.Window {
+			return
+		}
+
+		s.Window = p
+		err = s.Save()
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "warning: failed to save window placement: "+err.Error())
+	}
+}
@@ -6,16 +6,68 @@ const (
 
 type Memory struct {
 	state
+
+	// Start of the watched range, whose changed bytes are flagged until they are taken
+	watchStart uint16
+	dirty      []bool
 }
 
 type state struct {
 	memory [MEMORY_SIZE]uint8
 }
 
+// Snapshot is an in-memory copy of the memory content.
+type Snapshot state
+
 func (m *Memory) Read(addr uint16) uint8 {
 	return m.memory[addr]
 }
 
 func (m *Memory) Write(addr uint16, value uint8) {
+	if i := int(addr - m.watchStart); i < len(m.dirty) && m.memory[addr] != value {
+		m.dirty[i] = true
+	}
+
 	m.memory[addr] = value
 }
+
+// Watch flags the bytes of a range changed by writes, like the video RAM, so that readers only convert those.
+// Every byte of the range starts flagged.
+func (m *Memory) Watch(start, size uint16) {
+	m.watchStart = start
+	m.dirty = make([]bool, size)
+
+	for i := range m.dirty {
+		m.dirty[i] = true
+	}
+}
+
+// TakeDirty reports whether a watched byte changed since the last call for it, and clears its flag.
+func (m *Memory) TakeDirty(addr uint16) bool {
+	i := int(addr - m.watchStart)
+	if i >= len(m.dirty) {
+		return false
+	}
+
+	dirty := m.dirty[i]
+	m.dirty[i] = false
+
+	return dirty
+}
+
+// Snapshot copies the memory content into s.
+func (m *Memory) Snapshot(s *Snapshot) {
+	*s = Snapshot(m.state)
+}
+
+// Restore brings back a content copied by Snapshot, the watched bytes it changes are flagged.
+func (m *Memory) Restore(s *Snapshot) {
+	for i := range m.dirty {
+		addr := m.watchStart + uint16(i)
+		if m.memory[addr] != s.memory[addr] {
+			m.dirty[i] = true
+		}
+	}
+
+	m.state = state(*s)
+}
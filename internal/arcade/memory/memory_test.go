@@ -0,0 +1,26 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Watch(t *testing.T) {
+	var m Memory
+
+	m.Watch(0x2400, 0x1C00)
+
+	assert.True(t, m.TakeDirty(0x2400))
+	assert.False(t, m.TakeDirty(0x2400))
+
+	m.Write(0x2400, 0)
+	assert.False(t, m.TakeDirty(0x2400), "writing the same value does not flag the byte")
+
+	m.Write(0x2400, 1)
+	assert.True(t, m.TakeDirty(0x2400))
+
+	m.Write(0x2000, 1)
+	assert.False(t, m.TakeDirty(0x2000), "bytes outside the range are not watched")
+	assert.False(t, m.TakeDirty(0x4000))
+}
@@ -0,0 +1,50 @@
+// Package netinput encodes the inputs of the frames sent over the network by netplay and spectate. Machines are
+// deterministic, so the machines of the peers run the same frames from the same inputs: the inputs of a frame are
+// a mask of the inputs of the game in name order.
+package netinput
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/cterence/goarcade/machine"
+)
+
+const (
+	// Version of the frame encoding, the netplay and spectate protocols are raised with it
+	PROTOCOL_VERSION = 1
+
+	// Inputs of a game, one bit each in the mask of a frame
+	MAX_INPUTS = 32
+)
+
+// Names returns the inputs of the game of a machine in name order, the order of the bits of the masks.
+func Names(m *machine.Machine) ([]string, error) {
+	names := slices.Sorted(maps.Keys(m.Inputs()))
+	if len(names) > MAX_INPUTS {
+		return nil, fmt.Errorf("game has %d inputs, at most %d can be sent over the network", len(names), MAX_INPUTS)
+	}
+
+	return names, nil
+}
+
+// Pressed returns the mask of the inputs pressed on a machine.
+func Pressed(m *machine.Machine, names []string) uint32 {
+	var mask uint32
+
+	for i, name := range names {
+		if m.Pressed(name) {
+			mask |= 1 << i
+		}
+	}
+
+	return mask
+}
+
+// Apply presses the inputs of a mask on a machine and releases the others, the names are the inputs of its game.
+func Apply(m *machine.Machine, names []string, mask uint32) {
+	for i, name := range names {
+		_ = m.SetInput(name, mask>>i&1 == 1)
+	}
+}
@@ -0,0 +1,31 @@
+package netinput
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/cterence/goarcade/machine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_Mask(t *testing.T) {
+	m := machine.New()
+	require.NoError(t, m.LoadProgram([]uint8{0xC3, 0x00, 0x00}))
+
+	names, err := Names(m)
+	require.NoError(t, err)
+	assert.IsNonDecreasing(t, names)
+
+	coin, fire := slices.Index(names, "coin"), slices.Index(names, "p1_fire")
+	mask := uint32(1)<<coin | uint32(1)<<fire
+
+	Apply(m, names, mask)
+	assert.True(t, m.Pressed("coin"))
+	assert.True(t, m.Pressed("p1_fire"))
+	assert.Equal(t, mask, Pressed(m, names))
+
+	Apply(m, names, 1<<coin)
+	assert.False(t, m.Pressed("p1_fire"))
+	assert.Equal(t, uint32(1)<<coin, Pressed(m, names))
+}
@@ -0,0 +1,162 @@
+package netplay
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+)
+
+const (
+	PROTOCOL_UDP = "udp"
+	PROTOCOL_TCP = "tcp"
+
+	// Messages received and not handled yet, UDP datagrams are dropped past it
+	RECEIVE_BUFFER   = 256
+	MAX_MESSAGE_SIZE = 2048
+)
+
+var Protocols = []string{PROTOCOL_UDP, PROTOCOL_TCP}
+
+// conn sends and receives the messages of a session, over TCP with a length prefix or over UDP as datagrams.
+// Messages are received by a goroutine, so that the game polls them without blocking.
+type conn struct {
+	write     func(msg []byte) error
+	closeConn func() error
+
+	in chan []byte
+	// Closed by close, stops the reader blocked on a full in
+	done      chan struct{}
+	closeOnce sync.Once
+	// Set when the reader stops, read once in is closed
+	err error
+}
+
+func newTCPConn(c net.Conn) *conn {
+	if tc, ok := c.(*net.TCPConn); ok {
+		// Inputs are small and sent every frame
+		_ = tc.SetNoDelay(true)
+	}
+
+	cn := &conn{
+		write: func(msg []byte) error {
+			_, err := c.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(msg))), msg...))
+
+			return err
+		},
+		closeConn: c.Close,
+		in:        make(chan []byte, RECEIVE_BUFFER),
+		done:      make(chan struct{}),
+	}
+
+	go func() {
+		r := bufio.NewReader(c)
+
+		for {
+			var size [2]byte
+			if _, err := io.ReadFull(r, size[:]); err != nil {
+				cn.stop(err)
+
+				return
+			}
+
+			msg := make([]byte, binary.BigEndian.Uint16(size[:]))
+			if _, err := io.ReadFull(r, msg); err != nil {
+				cn.stop(err)
+
+				return
+			}
+
+			select {
+			case cn.in <- msg:
+			case <-cn.done:
+				cn.stop(net.ErrClosed)
+
+				return
+			}
+		}
+	}()
+
+	return cn
+}
+
+// newUDPConn exchanges datagrams with a peer. Clients have a connected socket and no peer address, the host
+// only keeps the datagrams of its peer.
+func newUDPConn(c *net.UDPConn, peer *net.UDPAddr) *conn {
+	cn := &conn{
+		write: func(msg []byte) error {
+			if peer == nil {
+				_, err := c.Write(msg)
+
+				return err
+			}
+
+			_, err := c.WriteToUDP(msg, peer)
+
+			return err
+		},
+		closeConn: c.Close,
+		in:        make(chan []byte, RECEIVE_BUFFER),
+		done:      make(chan struct{}),
+	}
+
+	go func() {
+		buf := make([]byte, MAX_MESSAGE_SIZE)
+
+		for {
+			n, addr, err := c.ReadFromUDP(buf)
+
+			// Clients are refused until the host listens
+			if errors.Is(err, syscall.ECONNREFUSED) {
+				continue
+			}
+
+			if err != nil {
+				cn.stop(err)
+
+				return
+			}
+
+			if peer != nil && addr.AddrPort() != peer.AddrPort() {
+				continue
+			}
+
+			select {
+			case cn.in <- append([]byte(nil), buf[:n]...):
+			default:
+			}
+		}
+	}()
+
+	return cn
+}
+
+// stop records the error of the reader, after the messages it received.
+func (c *conn) stop(err error) {
+	c.err = err
+	close(c.in)
+}
+
+// close disconnects from the peer and stops the reader.
+func (c *conn) close() error {
+	var err error
+
+	c.closeOnce.Do(func() {
+		close(c.done)
+		err = c.closeConn()
+	})
+
+	return err
+}
+
+func (c *conn) send(msg []byte) error {
+	if err := c.write(msg); err != nil {
+		return fmt.Errorf("failed to send netplay message: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,569 @@
+// Package netplay plays a game on two machines over the network. Each peer sends its inputs of every frame,
+// and runs the frames without waiting for the inputs of the other peer: they are predicted, and the frames
+// run with wrong predictions are rolled back to a snapshot and run again when the inputs arrive.
+package netplay
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cterence/goarcade/internal/arcade/lib"
+	"github.com/cterence/goarcade/internal/arcade/netinput"
+	"github.com/cterence/goarcade/machine"
+)
+
+const (
+	// Frames between the press of an input and its frame, which hides the latency of the network
+	DEFAULT_INPUT_DELAY = 2
+	MAX_INPUT_DELAY     = 10
+	// Frames run with predicted inputs of the peer, the game waits for the peer past it
+	MAX_ROLLBACK = 8
+	// Frames of inputs kept, for the rollbacks and for the inputs the peer has not received yet
+	INPUT_FRAMES = 128
+
+	// Hellos are sent again until the host answers, over UDP they can be lost
+	HELLO_INTERVAL = 250 * time.Millisecond
+	TIMEOUT        = 5 * time.Second
+)
+
+const (
+	MSG_HELLO uint8 = iota + 1
+	MSG_WELCOME
+	MSG_REJECT
+	MSG_INPUTS
+	MSG_QUIT
+)
+
+var (
+	ErrPeerLeft = errors.New("netplay peer left the game")
+	ErrTimeout  = errors.New("netplay peer timed out")
+)
+
+// Stats counts the rollbacks of a session, and the frames the game waited for the peer.
+type Stats struct {
+	Rollbacks     int
+	FramesRerun   int
+	FramesStalled int
+}
+
+type Session struct {
+	m    *machine.Machine
+	conn *conn
+
+	// Player 1 hosts, the player 1 inputs of player 2 are sent as player 2 inputs
+	player int
+	delay  int
+	// Answer to the hellos sent again by the client, nil for the client
+	welcome []byte
+
+	// Inputs of the game in name order, and the index of each port bit and of its player 2 input
+	names []string
+	bits  map[[2]uint8]int
+	p2    []int
+	// Inputs pressed by the local player, sent for the frame delay frames ahead
+	pressed uint32
+
+	// Frames run
+	frame int
+	// Inputs of each frame, with the remote inputs used when it ran
+	local, remote, predicted [INPUT_FRAMES]uint32
+	// Frames with local and remote inputs, and with local inputs received by the peer
+	localEnd, remoteEnd, peerAck int
+	// First frame run with a wrong prediction, -1 when none
+	rollback  int
+	snapshots [MAX_ROLLBACK + 1]machine.Snapshot
+
+	received time.Time
+	stats    Stats
+}
+
+// Host powers the machine on and waits for a client on addr, the session is player 1.
+func Host(ctx context.Context, protocol, addr string, m *machine.Machine, delay int) (*Session, error) {
+	if delay < 0 || delay > MAX_INPUT_DELAY {
+		return nil, fmt.Errorf("input delay %d is out of range (0-%d)", delay, MAX_INPUT_DELAY)
+	}
+
+	hash, err := powerOn(m)
+	if err != nil {
+		return nil, err
+	}
+
+	cn, hello, err := accept(ctx, protocol, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkHello(hello, hash); err != nil {
+		_ = cn.send(append([]byte{MSG_REJECT}, err.Error()...))
+		_ = cn.close()
+
+		return nil, err
+	}
+
+	welcome := []byte{MSG_WELCOME, uint8(delay)}
+	if err := cn.send(welcome); err != nil {
+		_ = cn.close()
+
+		return nil, err
+	}
+
+	return newSession(m, cn, 1, delay, welcome)
+}
+
+// accept waits for the hello of a client.
+func accept(ctx context.Context, protocol, addr string) (*conn, []byte, error) {
+	switch protocol {
+	case PROTOCOL_TCP:
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Closing the listener stops the accept when ctx is done, the error is reported by the deferred close
+		closeLn := sync.OnceValue(ln.Close)
+		defer lib.DeferErr(closeLn)
+
+		stop := context.AfterFunc(ctx, func() { _ = closeLn() })
+		defer stop()
+
+		c, err := ln.Accept()
+		if err != nil {
+			return nil, nil, ctxErr(ctx, fmt.Errorf("failed to accept netplay client: %w", err))
+		}
+
+		cn := newTCPConn(c)
+
+		select {
+		case hello, ok := <-cn.in:
+			if ok {
+				return cn, hello, nil
+			}
+
+			return nil, nil, fmt.Errorf("failed to receive netplay hello: %w", cn.err)
+		case <-time.After(TIMEOUT):
+			_ = cn.close()
+
+			return nil, nil, ErrTimeout
+		}
+	case PROTOCOL_UDP:
+		udpAddr, err := net.ResolveUDPAddr("udp", addr)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		c, err := net.ListenUDP("udp", udpAddr)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Closing the socket stops the read when ctx is done, the error is returned with the read error
+		closeConn := sync.OnceValue(c.Close)
+		stop := context.AfterFunc(ctx, func() { _ = closeConn() })
+
+		buf := make([]byte, MAX_MESSAGE_SIZE)
+
+		n, peer, err := c.ReadFromUDP(buf)
+		if !stop() || err != nil {
+			return nil, nil, errors.Join(ctxErr(ctx, fmt.Errorf("failed to receive netplay hello: %w", err)), closeConn())
+		}
+
+		return newUDPConn(c, peer), buf[:n], nil
+	default:
+		return nil, nil, fmt.Errorf("netplay protocol %q is not udp or tcp", protocol)
+	}
+}
+
+// ctxErr returns the error of the context when it is done, which stopped the network operation.
+func ctxErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return err
+}
+
+// Connect powers the machine on and joins the host at addr, the session is player 2.
+func Connect(ctx context.Context, protocol, addr string, m *machine.Machine) (*Session, error) {
+	hash, err := powerOn(m)
+	if err != nil {
+		return nil, err
+	}
+
+	var cn *conn
+
+	switch protocol {
+	case PROTOCOL_TCP:
+		var d net.Dialer
+
+		c, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to netplay host: %w", err)
+		}
+
+		cn = newTCPConn(c)
+	case PROTOCOL_UDP:
+		udpAddr, err := net.ResolveUDPAddr("udp", addr)
+		if err != nil {
+			return nil, err
+		}
+
+		c, err := net.DialUDP("udp", nil, udpAddr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to netplay host: %w", err)
+		}
+
+		cn = newUDPConn(c, nil)
+	default:
+		return nil, fmt.Errorf("netplay protocol %q is not udp or tcp", protocol)
+	}
+
+	hello := append([]byte{MSG_HELLO, netinput.PROTOCOL_VERSION}, hash[:]...)
+
+	ticker := time.NewTicker(HELLO_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		if err := cn.send(hello); err != nil {
+			_ = cn.close()
+
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			_ = cn.close()
+
+			return nil, ctx.Err()
+		case msg, ok := <-cn.in:
+			if !ok {
+				return nil, fmt.Errorf("failed to join netplay host: %w", cn.err)
+			}
+
+			switch {
+			case len(msg) == 2 && msg[0] == MSG_WELCOME:
+				return newSession(m, cn, 2, int(msg[1]), nil)
+			case len(msg) > 0 && msg[0] == MSG_REJECT:
+				_ = cn.close()
+
+				return nil, fmt.Errorf("netplay host refused to play: %s", msg[1:])
+			}
+		case <-ticker.C:
+		}
+	}
+}
+
+// powerOn starts the game from power on, and returns the hash of the machine state which the peers compare
+// to check that they run the same game with the same DIP switches.
+func powerOn(m *machine.Machine) ([sha1.Size]byte, error) {
+	if err := m.PowerOn(); err != nil {
+		return [sha1.Size]byte{}, err
+	}
+
+	h := sha1.New()
+
+	if err := m.SaveState(h); err != nil {
+		return [sha1.Size]byte{}, err
+	}
+
+	return [sha1.Size]byte(h.Sum(nil)), nil
+}
+
+func checkHello(hello []byte, hash [sha1.Size]byte) error {
+	if len(hello) != 2+sha1.Size || hello[0] != MSG_HELLO {
+		return errors.New("invalid netplay hello")
+	}
+
+	if hello[1] != netinput.PROTOCOL_VERSION {
+		return fmt.Errorf("netplay protocol version %d is not %d", hello[1], netinput.PROTOCOL_VERSION)
+	}
+
+	if [sha1.Size]byte(hello[2:]) != hash {
+		return errors.New("the peers do not run the same game with the same DIP switches")
+	}
+
+	return nil
+}
+
+func newSession(m *machine.Machine, cn *conn, player, delay int, welcome []byte) (*Session, error) {
+	if delay > MAX_INPUT_DELAY {
+		_ = cn.close()
+
+		return nil, fmt.Errorf("input delay %d is out of range (0-%d)", delay, MAX_INPUT_DELAY)
+	}
+
+	names, err := netinput.Names(m)
+	if err != nil {
+		_ = cn.close()
+
+		return nil, err
+	}
+
+	inputs := m.Inputs()
+
+	s := &Session{
+		m:       m,
+		conn:    cn,
+		player:  player,
+		delay:   delay,
+		welcome: welcome,
+		names:   names,
+		bits:    map[[2]uint8]int{},
+		p2:      make([]int, len(names)),
+		// The inputs of the first frames are released
+		localEnd:  delay,
+		remoteEnd: delay,
+		peerAck:   delay,
+		rollback:  -1,
+		received:  time.Now(),
+	}
+
+	for i, name := range names {
+		in := inputs[name]
+		s.bits[[2]uint8{in.Port, in.Bit}] = i
+
+		s.p2[i] = i
+		if rest, ok := strings.CutPrefix(name, "p1_"); ok {
+			if j, found := slices.BinarySearch(names, "p2_"+rest); found {
+				s.p2[i] = j
+			}
+		}
+	}
+
+	return s, nil
+}
+
+// Player returns 1 for the host and 2 for the client.
+func (s *Session) Player() int {
+	return s.player
+}
+
+// Frame returns the frames run since power on.
+func (s *Session) Frame() int {
+	return s.frame
+}
+
+// Confirmed returns the frames run with the inputs of the peer, which are the same on both machines.
+func (s *Session) Confirmed() int {
+	return min(s.frame, s.remoteEnd)
+}
+
+func (s *Session) Stats() Stats {
+	return s.stats
+}
+
+// SendInput presses or releases the input of a port bit for the local player, from the next frame sent.
+// Player 2 presses the player 2 inputs with the player 1 controls.
+func (s *Session) SendInput(port, bit uint8, pressed bool) {
+	i, ok := s.bits[[2]uint8{port, bit}]
+	if !ok {
+		return
+	}
+
+	if s.player == 2 {
+		i = s.p2[i]
+	}
+
+	if pressed {
+		s.pressed |= 1 << i
+	} else {
+		s.pressed &^= 1 << i
+	}
+}
+
+func (s *Session) ReadPort(port uint8) uint8 {
+	return s.m.ReadPort(port)
+}
+
+// Poll receives the inputs of the peer, rolls back the frames run with wrong predictions, and sends the local
+// inputs. It is called between frames, also while the game is paused to keep the session alive.
+func (s *Session) Poll() error {
+	if err := s.receive(); err != nil {
+		return err
+	}
+
+	return s.sendInputs()
+}
+
+// Begin sets the inputs of the next frame, which the caller runs when it returns true. It returns false when
+// the game has to wait for the inputs of the peer.
+func (s *Session) Begin() (bool, error) {
+	if err := s.receive(); err != nil {
+		return false, err
+	}
+
+	if s.frame-s.remoteEnd >= MAX_ROLLBACK || s.localEnd-s.peerAck >= INPUT_FRAMES {
+		s.stats.FramesStalled++
+
+		return false, s.sendInputs()
+	}
+
+	s.local[s.localEnd%INPUT_FRAMES] = s.pressed
+	s.localEnd++
+
+	s.m.Snapshot(&s.snapshots[s.frame%len(s.snapshots)])
+	s.apply(s.frame)
+	s.frame++
+
+	return true, s.sendInputs()
+}
+
+// Close tells the peer that the game is over.
+func (s *Session) Close() error {
+	_ = s.conn.send([]byte{MSG_QUIT})
+
+	return s.conn.close()
+}
+
+// receive handles the messages of the peer, and rolls back to the first frame with a wrong prediction.
+func (s *Session) receive() error {
+	for {
+		select {
+		case msg, ok := <-s.conn.in:
+			if !ok {
+				return fmt.Errorf("netplay peer disconnected: %w", s.conn.err)
+			}
+
+			if err := s.handle(msg); err != nil {
+				return err
+			}
+
+			s.received = time.Now()
+
+			continue
+		default:
+		}
+
+		break
+	}
+
+	if time.Since(s.received) > TIMEOUT {
+		return ErrTimeout
+	}
+
+	if s.rollback >= 0 {
+		s.rollBack()
+	}
+
+	return nil
+}
+
+func (s *Session) handle(msg []byte) error {
+	if len(msg) == 0 {
+		return errors.New("empty netplay message")
+	}
+
+	switch msg[0] {
+	case MSG_HELLO:
+		// The client did not receive the welcome
+		if s.welcome != nil {
+			return s.conn.send(s.welcome)
+		}
+	case MSG_WELCOME:
+	case MSG_QUIT:
+		return ErrPeerLeft
+	case MSG_INPUTS:
+		return s.handleInputs(msg[1:])
+	default:
+		return fmt.Errorf("unknown netplay message %d", msg[0])
+	}
+
+	return nil
+}
+
+// handleInputs reads the frames of local inputs received by the peer, and the remote inputs from a frame.
+// Inputs received again are skipped, and inputs after a gap are sent again by the peer.
+func (s *Session) handleInputs(b []byte) error {
+	if len(b) < 10 {
+		return errors.New("invalid netplay inputs")
+	}
+
+	ack := int(binary.BigEndian.Uint32(b))
+	start := int(binary.BigEndian.Uint32(b[4:]))
+	count := int(binary.BigEndian.Uint16(b[8:]))
+
+	if len(b) != 10+4*count {
+		return errors.New("invalid netplay inputs")
+	}
+
+	s.peerAck = max(s.peerAck, min(ack, s.localEnd))
+
+	for i := range count {
+		frame := start + i
+
+		if frame < s.remoteEnd {
+			continue
+		}
+
+		// Inputs are kept for the frames which can be rolled back
+		if frame > s.remoteEnd || frame >= s.frame-MAX_ROLLBACK+INPUT_FRAMES {
+			break
+		}
+
+		inputs := binary.BigEndian.Uint32(b[10+4*i:])
+		s.remote[frame%INPUT_FRAMES] = inputs
+
+		if frame < s.frame && inputs != s.predicted[frame%INPUT_FRAMES] && (s.rollback < 0 || frame < s.rollback) {
+			s.rollback = frame
+		}
+
+		s.remoteEnd++
+	}
+
+	return nil
+}
+
+func (s *Session) sendInputs() error {
+	msg := []byte{MSG_INPUTS}
+	msg = binary.BigEndian.AppendUint32(msg, uint32(s.remoteEnd))
+	msg = binary.BigEndian.AppendUint32(msg, uint32(s.peerAck))
+	msg = binary.BigEndian.AppendUint16(msg, uint16(s.localEnd-s.peerAck))
+
+	for frame := s.peerAck; frame < s.localEnd; frame++ {
+		msg = binary.BigEndian.AppendUint32(msg, s.local[frame%INPUT_FRAMES])
+	}
+
+	return s.conn.send(msg)
+}
+
+// apply sets the inputs of a frame on the machine, the remote inputs not received yet are predicted to be
+// the last ones received.
+func (s *Session) apply(frame int) {
+	remote := s.remote[(s.remoteEnd-1+INPUT_FRAMES)%INPUT_FRAMES]
+	if frame < s.remoteEnd {
+		remote = s.remote[frame%INPUT_FRAMES]
+	}
+
+	s.predicted[frame%INPUT_FRAMES] = remote
+
+	netinput.Apply(s.m, s.names, s.local[frame%INPUT_FRAMES]|remote)
+}
+
+// rollBack runs the frames again from the first wrong prediction.
+func (s *Session) rollBack() {
+	from := s.rollback
+	s.m.Restore(&s.snapshots[from%len(s.snapshots)])
+
+	for frame := from; frame < s.frame; frame++ {
+		if frame > from {
+			s.m.Snapshot(&s.snapshots[frame%len(s.snapshots)])
+		}
+
+		s.apply(frame)
+		s.m.RunFrame()
+	}
+
+	// The sounds were played when the frames first ran
+	s.m.AudioEvents()
+
+	s.stats.Rollbacks++
+	s.stats.FramesRerun += s.frame - from
+	s.rollback = -1
+}
@@ -0,0 +1,222 @@
+package netplay
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cterence/goarcade/internal/gametest"
+	"github.com/cterence/goarcade/machine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const FRAMES = 120
+
+func newMachine(t *testing.T) *machine.Machine {
+	m := machine.New()
+	require.NoError(t, m.LoadProgram(gametest.InputsProgram))
+
+	return m
+}
+
+// freeAddr returns a loopback address with a port free for the protocol.
+func freeAddr(t *testing.T, protocol string) string {
+	if protocol == PROTOCOL_UDP {
+		c, err := net.ListenPacket("udp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer c.Close()
+
+		return c.LocalAddr().String()
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	return ln.Addr().String()
+}
+
+// connect retries until the host listens.
+func connect(ctx context.Context, protocol, addr string, m *machine.Machine) (*Session, error) {
+	for {
+		s, err := Connect(ctx, protocol, addr, m)
+		if !errors.Is(err, syscall.ECONNREFUSED) {
+			return s, err
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// Each player presses their fire input for a few frames at a different rate
+func fire(player, frame int) bool {
+	return frame/(3+player*2)%2 == 1
+}
+
+// play runs the frames of a session, waiting between frames to run at the pace of a slow peer, then polls
+// until both peers have the inputs of every frame.
+func play(t *testing.T, s *Session, m *machine.Machine, wait time.Duration) {
+	for s.Frame() < FRAMES {
+		s.SendInput(1, 4, fire(s.Player(), s.Frame()))
+
+		ready, err := s.Begin()
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		if !ready {
+			time.Sleep(time.Millisecond)
+
+			continue
+		}
+
+		m.RunFrame()
+		time.Sleep(wait)
+	}
+
+	for s.Confirmed() < FRAMES || s.peerAck < FRAMES {
+		if !assert.NoError(t, s.Poll()) {
+			return
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func Test_Session(t *testing.T) {
+	// The frames replayed on a single machine with the inputs of both players
+	reference := newMachine(t)
+	require.NoError(t, reference.PowerOn())
+
+	for frame := range FRAMES {
+		input := frame - DEFAULT_INPUT_DELAY
+		require.NoError(t, reference.SetInput("p1_fire", input >= 0 && fire(1, input)))
+		require.NoError(t, reference.SetInput("p2_fire", input >= 0 && fire(2, input)))
+		reference.RunFrame()
+	}
+
+	var want bytes.Buffer
+	require.NoError(t, reference.SaveState(&want))
+
+	for _, protocol := range Protocols {
+		t.Run(protocol, func(t *testing.T) {
+			addr := freeAddr(t, protocol)
+			hostMachine, clientMachine := newMachine(t), newMachine(t)
+
+			var (
+				host *Session
+				wg   sync.WaitGroup
+			)
+
+			wg.Go(func() {
+				var err error
+
+				host, err = Host(t.Context(), protocol, addr, hostMachine, DEFAULT_INPUT_DELAY)
+				assert.NoError(t, err)
+			})
+
+			client, err := connect(t.Context(), protocol, addr, clientMachine)
+			require.NoError(t, err)
+			defer client.Close()
+
+			wg.Wait()
+			require.NotNil(t, host)
+			defer host.Close()
+
+			assert.Equal(t, 1, host.Player())
+			assert.Equal(t, 2, client.Player())
+
+			// The host runs ahead of the client, and rolls back its frames on every change of the client inputs
+			wg.Go(func() { play(t, host, hostMachine, 0) })
+			wg.Go(func() { play(t, client, clientMachine, 2*time.Millisecond) })
+			wg.Wait()
+
+			assert.Positive(t, host.Stats().Rollbacks)
+
+			for _, m := range []*machine.Machine{hostMachine, clientMachine} {
+				var got bytes.Buffer
+				require.NoError(t, m.SaveState(&got))
+				assert.Equal(t, want.Bytes(), got.Bytes())
+			}
+
+			// The session ends with the game of the peer
+			require.NoError(t, client.Close())
+			assert.Eventually(t, func() bool { return host.Poll() != nil }, time.Second, time.Millisecond)
+		})
+	}
+
+	t.Run("different games", func(t *testing.T) {
+		addr := freeAddr(t, PROTOCOL_TCP)
+
+		other := machine.New()
+		require.NoError(t, other.LoadProgram(append(slices.Clone(gametest.InputsProgram), 0x76)))
+
+		ctx, cancel := context.WithTimeout(t.Context(), TIMEOUT)
+		defer cancel()
+
+		var wg sync.WaitGroup
+
+		wg.Go(func() {
+			_, err := Host(ctx, PROTOCOL_TCP, addr, newMachine(t), DEFAULT_INPUT_DELAY)
+			assert.EqualError(t, err, "the peers do not run the same game with the same DIP switches")
+		})
+
+		_, err := connect(ctx, PROTOCOL_TCP, addr, other)
+		assert.ErrorContains(t, err, "netplay host refused to play")
+
+		wg.Wait()
+	})
+}
+
+func Test_ConnClose(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	peer, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+
+	local, err := ln.Accept()
+	require.NoError(t, err)
+	require.NoError(t, ln.Close())
+
+	cn := newTCPConn(local)
+
+	// The messages not handled fill the queue of the reader
+	go func() {
+		for range RECEIVE_BUFFER + 1 {
+			if _, err := peer.Write([]byte{0, 1, MSG_QUIT}); err != nil {
+				return
+			}
+		}
+	}()
+
+	require.Eventually(t, func() bool { return len(cn.in) == RECEIVE_BUFFER }, 5*time.Second, time.Millisecond)
+
+	require.NoError(t, cn.close())
+	require.NoError(t, cn.close(), "closing again does nothing")
+
+	stopped := make(chan struct{})
+
+	go func() {
+		for range cn.in {
+		}
+
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the reader is still blocked")
+	}
+
+	assert.ErrorIs(t, cn.err, net.ErrClosed)
+	require.NoError(t, peer.Close())
+}
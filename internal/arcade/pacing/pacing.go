@@ -0,0 +1,224 @@
+package pacing
+
+import (
+	"slices"
+	"time"
+)
+
+// Mode is the timing source of the emulation.
+type Mode string
+
+const (
+	// High resolution clock, frames have absolute deadlines so that the timing does not drift
+	MODE_CLOCK Mode = "clock"
+	// Display vertical sync, the renderer blocks until the next refresh when it presents a frame
+	MODE_VSYNC Mode = "vsync"
+	// Audio playback, the emulation waits for the audio device to play a queue of silence
+	MODE_AUDIO Mode = "audio"
+)
+
+const (
+	// Frames run at most in one step to catch up with a late host, the others are skipped
+	MAX_CATCH_UP = 4
+	// Refresh rates this close to the frame rate show one frame per refresh, in percent
+	MAX_VSYNC_SKEW = 2
+	// Refresh intervals measured to estimate the refresh rate
+	REFRESH_SAMPLES = 15
+	// Silence queued ahead of the audio playback, in frames
+	AUDIO_LATENCY = 3
+	AUDIO_POLL    = time.Millisecond
+)
+
+var Modes = []Mode{MODE_CLOCK, MODE_VSYNC, MODE_AUDIO}
+
+// Audio is a stream of silence played by the audio device, which paces the emulation in audio mode.
+type Audio interface {
+	// Queued returns the playback time left in the stream.
+	Queued() time.Duration
+	QueueSilence(d time.Duration)
+}
+
+type Stats struct {
+	// Frames paced since the pacing started
+	Frames uint64
+	// Frames run without being shown or skipped to catch up with a late host
+	Dropped uint64
+	// Steps that started more than half a frame after their deadline
+	Late uint64
+}
+
+// Pacer waits for the frames of the emulation on a timing source, and counts the frames dropped and late
+// when the host is too slow.
+type Pacer struct {
+	mode   Mode
+	period time.Duration
+	audio  Audio
+
+	// Deadline of the next frame in clock mode, and of the next shown frame when unthrottled
+	next time.Time
+	// Previous step in vsync mode
+	last time.Time
+	// Last refresh intervals in vsync mode, and the frames due after them
+	intervals []time.Duration
+	pending   float64
+
+	stats Stats
+
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// New creates a pacer for frames at fps per second, audio is only used in audio mode.
+func New(mode Mode, fps float64, audio Audio) *Pacer {
+	return &Pacer{
+		mode:   mode,
+		period: time.Duration(float64(time.Second) / fps),
+		audio:  audio,
+		now:    time.Now,
+		sleep:  time.Sleep,
+	}
+}
+
+func (p *Pacer) Stats() Stats {
+	return p.stats
+}
+
+// Wait blocks until the next frame is due and returns the number of frames to run before showing the last one,
+// which is above 1 when the emulation catches up with a late host. In vsync mode the wait is the frame presentation
+// that follows, and the number of frames can be 0 when the display refreshes faster than the game.
+func (p *Pacer) Wait() int {
+	var frames int
+
+	switch p.mode {
+	case MODE_VSYNC:
+		frames = p.waitVSync()
+	case MODE_AUDIO:
+		frames = p.waitAudio()
+	default:
+		frames = p.waitClock()
+	}
+
+	p.stats.Frames += uint64(frames)
+
+	return frames
+}
+
+// Due reports without blocking whether a frame is due to be shown, for the unthrottled emulation.
+func (p *Pacer) Due() bool {
+	now := p.now()
+	if now.Before(p.next) {
+		return false
+	}
+
+	p.next = now.Add(p.period)
+
+	return true
+}
+
+// Idle waits for the next frame while the emulation is paused, without counting it,
+// and resyncs the timing so that the emulation does not catch up when it resumes.
+func (p *Pacer) Idle() {
+	now := p.now()
+
+	// The presentation waits for the refresh in vsync mode
+	if wait := p.next.Sub(now); wait > 0 && p.mode != MODE_VSYNC {
+		p.sleep(wait)
+		now = p.now()
+	}
+
+	p.next = now.Add(p.period)
+	p.last = time.Time{}
+	p.pending = 0
+}
+
+// waitClock sleeps until the deadline of the next frame, deadlines are spaced from the previous deadline
+// and not from the wake up time, so that sleep overshoots do not add up.
+func (p *Pacer) waitClock() int {
+	now := p.now()
+	if p.next.IsZero() {
+		p.next = now
+	}
+
+	if wait := p.next.Sub(now); wait > 0 {
+		p.sleep(wait)
+		now = p.now()
+	}
+
+	late := now.Sub(p.next)
+	frames := 1 + int(late/p.period)
+
+	p.next = p.next.Add(time.Duration(frames) * p.period)
+	if frames > MAX_CATCH_UP {
+		p.next = now.Add(p.period)
+	}
+
+	return p.catchUp(late, frames)
+}
+
+// waitVSync counts the frames due since the previous presentation. When the refresh rate is close to the frame rate,
+// a frame is shown on each refresh, slightly changing the game speed so that frames are never shown twice or skipped.
+func (p *Pacer) waitVSync() int {
+	now := p.now()
+	if p.last.IsZero() {
+		p.last = now
+
+		return 1
+	}
+
+	elapsed := now.Sub(p.last)
+	p.last = now
+
+	refresh := p.refresh(elapsed)
+	late := elapsed - refresh
+
+	if skew := (refresh - p.period).Abs(); skew*100 <= p.period*MAX_VSYNC_SKEW {
+		return p.catchUp(late, max(1, int((elapsed+refresh/2)/refresh)))
+	}
+
+	p.pending += float64(elapsed) / float64(p.period)
+	frames := int(p.pending)
+	p.pending -= float64(frames)
+
+	return p.catchUp(late, frames)
+}
+
+// refresh records a refresh interval and returns the median of the last intervals,
+// which ignores the refreshes missed by a late host.
+func (p *Pacer) refresh(interval time.Duration) time.Duration {
+	p.intervals = append(p.intervals, interval)
+	if len(p.intervals) > REFRESH_SAMPLES {
+		p.intervals = p.intervals[1:]
+	}
+
+	sorted := slices.Sorted(slices.Values(p.intervals))
+
+	return sorted[len(sorted)/2]
+}
+
+// waitAudio waits for the audio device to play the silence queued beyond the latency, then queues a frame of silence.
+// A late host lets the queue run dry, the next steps do not wait until it is filled again.
+func (p *Pacer) waitAudio() int {
+	for p.audio.Queued() > AUDIO_LATENCY*p.period {
+		p.sleep(AUDIO_POLL)
+	}
+
+	if p.audio.Queued() == 0 && p.stats.Frames > 0 {
+		p.stats.Late++
+	}
+
+	p.audio.QueueSilence(p.period)
+
+	return 1
+}
+
+// catchUp counts a step that started late, in which frames were due, and returns the frames to run.
+func (p *Pacer) catchUp(late time.Duration, frames int) int {
+	if late <= p.period/2 {
+		return frames
+	}
+
+	p.stats.Late++
+	p.stats.Dropped += uint64(max(frames-1, 0))
+
+	return min(frames, MAX_CATCH_UP)
+}
@@ -0,0 +1,137 @@
+package pacing
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const FPS = 50
+
+// fakeClock advances only when the pacer sleeps or when the emulation is made to take time.
+type fakeClock struct {
+	now time.Time
+}
+
+func newPacer(mode Mode, audio Audio) (*Pacer, *fakeClock) {
+	c := &fakeClock{now: time.Unix(0, 0)}
+
+	p := New(mode, FPS, audio)
+	p.now = func() time.Time { return c.now }
+	p.sleep = func(d time.Duration) { c.now = c.now.Add(d) }
+
+	return p, c
+}
+
+func Test_Clock(t *testing.T) {
+	p, c := newPacer(MODE_CLOCK, nil)
+
+	t.Run("deadlines do not drift", func(t *testing.T) {
+		for range FPS {
+			assert.Equal(t, 1, p.Wait())
+
+			c.now = c.now.Add(3 * time.Millisecond)
+		}
+
+		assert.Equal(t, time.Unix(1, 0), p.next)
+		assert.Equal(t, Stats{Frames: FPS}, p.Stats())
+	})
+
+	t.Run("late host catches up", func(t *testing.T) {
+		c.now = c.now.Add(60 * time.Millisecond)
+
+		assert.Equal(t, 3, p.Wait())
+		assert.Equal(t, Stats{Frames: FPS + 3, Dropped: 2, Late: 1}, p.Stats())
+	})
+
+	t.Run("frames beyond the catch up are skipped", func(t *testing.T) {
+		c.now = c.now.Add(time.Second)
+
+		assert.Equal(t, MAX_CATCH_UP, p.Wait())
+		assert.Equal(t, c.now.Add(p.period), p.next)
+		assert.Equal(t, uint64(2+FPS-1), p.Stats().Dropped)
+	})
+
+	t.Run("pause resyncs", func(t *testing.T) {
+		p.Idle()
+		c.now = c.now.Add(time.Second)
+		p.Idle()
+
+		before := p.Stats()
+
+		assert.Equal(t, 1, p.Wait())
+		assert.Equal(t, before.Late, p.Stats().Late)
+	})
+}
+
+func Test_VSync(t *testing.T) {
+	t.Run("close refresh rate shows a frame per refresh", func(t *testing.T) {
+		p, c := newPacer(MODE_VSYNC, nil)
+
+		for range FPS {
+			p.Wait()
+
+			c.now = c.now.Add(time.Second / 51)
+		}
+
+		assert.Equal(t, Stats{Frames: FPS}, p.Stats())
+
+		c.now = c.now.Add(2 * time.Second / 51)
+
+		assert.Equal(t, 3, p.Wait())
+		assert.Equal(t, Stats{Frames: FPS + 3, Dropped: 2, Late: 1}, p.Stats())
+	})
+
+	t.Run("faster refresh rate shows frames several times", func(t *testing.T) {
+		p, c := newPacer(MODE_VSYNC, nil)
+
+		frames := 0
+
+		for range 2*FPS + 1 {
+			frames += p.Wait()
+
+			c.now = c.now.Add(time.Second / 100)
+		}
+
+		assert.Equal(t, FPS+1, frames)
+		assert.Zero(t, p.Stats().Late)
+	})
+}
+
+type fakeAudio struct {
+	clock  *fakeClock
+	played time.Time
+	queued time.Duration
+}
+
+func (a *fakeAudio) Queued() time.Duration {
+	a.queued = max(a.queued-a.clock.now.Sub(a.played), 0)
+	a.played = a.clock.now
+
+	return a.queued
+}
+
+func (a *fakeAudio) QueueSilence(d time.Duration) {
+	a.queued += d
+}
+
+func Test_Audio(t *testing.T) {
+	audio := &fakeAudio{}
+	p, c := newPacer(MODE_AUDIO, audio)
+	audio.clock = c
+	audio.played = c.now
+
+	for range 2 * FPS {
+		assert.Equal(t, 1, p.Wait())
+	}
+
+	// The queue is filled first, then the emulation follows the playback
+	assert.Equal(t, time.Unix(2, 0).Add(-(AUDIO_LATENCY+1)*p.period), c.now)
+	assert.Zero(t, p.Stats().Late)
+
+	c.now = c.now.Add(time.Second)
+
+	p.Wait()
+	assert.Equal(t, uint64(1), p.Stats().Late)
+}
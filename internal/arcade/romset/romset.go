@@ -0,0 +1,255 @@
+package romset
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/cterence/goarcade/internal/arcade/config"
+	"github.com/cterence/goarcade/internal/arcade/lib"
+)
+
+var (
+	ErrMissingFile = errors.New("missing file")
+	ErrWrongSize   = errors.New("wrong size")
+	ErrBadDump     = errors.New("bad dump")
+	ErrUnknownSet  = errors.New("unknown rom set")
+)
+
+// Set is a game archive whose files can be checked against a config.ROMFile.
+type Set struct {
+	files []*zip.File
+}
+
+func Open(romBytes []uint8) (*Set, error) {
+	r, err := zip.NewReader(bytes.NewReader(romBytes), int64(len(romBytes)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open zip archive: %w", err)
+	}
+
+	return &Set{files: r.File}, nil
+}
+
+// AddParent makes the files of a parent archive available to the set, for MAME split sets whose clone archives
+// only contain the files that differ from the parent. Files of the set itself take precedence.
+func (s *Set) AddParent(parent *Set) {
+	s.files = append(s.files, parent.files...)
+}
+
+// AddParentArchives searches the archives of the game ancestors in a directory, for the files missing from the set.
+// Absent parent archives are skipped, as non-merged sets already contain the parent files.
+func (s *Set) AddParentArchives(c *config.Config, gameName, romDir string) error {
+	for _, parent := range c.Parents(gameName) {
+		parentBytes, err := os.ReadFile(filepath.Join(romDir, parent+".zip"))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+
+		if err != nil {
+			return fmt.Errorf("failed to read parent rom file: %w", err)
+		}
+
+		parentSet, err := Open(parentBytes)
+		if err != nil {
+			return err
+		}
+
+		s.AddParent(parentSet)
+	}
+
+	return nil
+}
+
+// find looks a file up by name, falling back to its CRC32 so renamed dumps are still found.
+func (s *Set) find(f config.ROMFile) *zip.File {
+	i := slices.IndexFunc(s.files, func(zf *zip.File) bool { return zf.Name == f.FileName })
+	if i == -1 && f.CRC32 != 0 {
+		i = slices.IndexFunc(s.files, func(zf *zip.File) bool { return zf.CRC32 == f.CRC32 })
+	}
+
+	if i == -1 {
+		return nil
+	}
+
+	return s.files[i]
+}
+
+// Check verifies a file without decompressing it, using the sizes and CRC32 stored in the zip directory.
+func (s *Set) Check(f config.ROMFile) error {
+	zf := s.find(f)
+	if zf == nil {
+		return fmt.Errorf("%w: %s", ErrMissingFile, f.FileName)
+	}
+
+	if zf.UncompressedSize64 != uint64(f.ExpectedSize) {
+		return fmt.Errorf("%w: %s (expected: %d bytes, actual: %d bytes)", ErrWrongSize, f.FileName, f.ExpectedSize, zf.UncompressedSize64)
+	}
+
+	if f.CRC32 != 0 && zf.CRC32 != f.CRC32 {
+		return fmt.Errorf("%w: %s (expected crc32: %08x, actual: %08x)", ErrBadDump, f.FileName, f.CRC32, zf.CRC32)
+	}
+
+	return nil
+}
+
+// ReadFile returns the verified content of a file.
+func (s *Set) ReadFile(f config.ROMFile) ([]uint8, error) {
+	if err := s.Check(f); err != nil {
+		return nil, err
+	}
+
+	zf := s.find(f)
+
+	r, err := zf.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file %s: %w", f.FileName, err)
+	}
+	defer lib.DeferErr(r.Close)
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", f.FileName, err)
+	}
+
+	if f.SHA1 != "" {
+		sum := sha1.Sum(b)
+		if actual := hex.EncodeToString(sum[:]); !strings.EqualFold(actual, f.SHA1) {
+			return nil, fmt.Errorf("%w: %s (expected sha1: %s, actual: %s)", ErrBadDump, f.FileName, strings.ToLower(f.SHA1), actual)
+		}
+	}
+
+	return b, nil
+}
+
+// Verify checks every file of a game spec and returns all problems found. Files with a SHA1 are read and
+// hashed, the others are only checked against the zip directory.
+func (s *Set) Verify(spec *config.GameSpec) error {
+	var errs []error
+
+	for _, f := range spec.Files() {
+		err := s.Check(f)
+		if err == nil && f.SHA1 != "" {
+			_, err = s.ReadFile(f)
+		}
+
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// withParentArchives returns a copy of the set with the archives of a game ancestors found in a directory.
+func (s *Set) withParentArchives(c *config.Config, gameName, romDir string) (*Set, error) {
+	set := &Set{files: slices.Clone(s.files)}
+
+	if err := set.AddParentArchives(c, gameName, romDir); err != nil {
+		return nil, err
+	}
+
+	return set, nil
+}
+
+// Identify returns the name of the game spec matching the archive contents, with the archives of the spec
+// ancestors found in romDir. When several specs match, the one with the most files wins.
+func Identify(c *config.Config, s *Set, romDir string) (string, error) {
+	names := make([]string, 0, len(c.GameSpecs))
+	for name := range c.GameSpecs {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var (
+		match      string
+		matchFiles int
+		ambiguous  bool
+	)
+
+	for _, name := range names {
+		spec, err := c.GameSpec(name)
+		if err != nil {
+			continue
+		}
+
+		files := spec.Files()
+		if len(files) == 0 {
+			continue
+		}
+
+		set, err := s.withParentArchives(c, name, romDir)
+		if err != nil || set.Verify(spec) != nil {
+			continue
+		}
+
+		switch {
+		case len(files) > matchFiles:
+			match, matchFiles, ambiguous = name, len(files), false
+		case len(files) == matchFiles:
+			ambiguous = true
+		}
+	}
+
+	if match == "" {
+		return "", ErrUnknownSet
+	}
+
+	if ambiguous {
+		return "", fmt.Errorf("%w: archive matches several game specs", ErrUnknownSet)
+	}
+
+	return match, nil
+}
+
+type Status string
+
+const (
+	STATUS_COMPLETE Status = "complete"
+	STATUS_MISSING  Status = "missing parts"
+	STATUS_BAD_DUMP Status = "wrong checksums"
+	STATUS_UNKNOWN  Status = "unknown"
+)
+
+// Audit finds the game spec of an archive, by name first then by content, and reports its status. The
+// archives of the game ancestors are searched in romDir for the files missing from the set.
+func Audit(c *config.Config, gameName string, s *Set, romDir string) (string, Status, error) {
+	spec, err := c.GameSpec(gameName)
+	if errors.Is(err, config.ErrNoSpec) {
+		name, err := Identify(c, s, romDir)
+		if err != nil {
+			return "", STATUS_UNKNOWN, err
+		}
+
+		return name, STATUS_COMPLETE, nil
+	}
+
+	if err != nil {
+		return gameName, STATUS_UNKNOWN, err
+	}
+
+	s, err = s.withParentArchives(c, gameName, romDir)
+	if err != nil {
+		return gameName, STATUS_UNKNOWN, err
+	}
+
+	err = s.Verify(spec)
+
+	switch {
+	case err == nil:
+		return gameName, STATUS_COMPLETE, nil
+	case errors.Is(err, ErrMissingFile):
+		return gameName, STATUS_MISSING, err
+	default:
+		return gameName, STATUS_BAD_DUMP, err
+	}
+}
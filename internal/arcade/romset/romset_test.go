@@ -0,0 +1,162 @@
+package romset
+
+import (
+	"bytes"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cterence/goarcade/internal/arcade/config"
+	"github.com/cterence/goarcade/internal/gametest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func romFile(name string, content []uint8) config.ROMFile {
+	return config.ROMFile{FileName: name, ExpectedSize: uint16(len(content)), CRC32: crc32.ChecksumIEEE(content)}
+}
+
+func Test_ReadFile(t *testing.T) {
+	good := bytes.Repeat([]uint8{0xAA}, 16)
+	set, err := Open(gametest.Archive(t, map[string][]uint8{"a.bin": good, "short.bin": good[:8]}))
+	require.NoError(t, err)
+
+	t.Run("valid", func(t *testing.T) {
+		b, err := set.ReadFile(romFile("a.bin", good))
+		require.NoError(t, err)
+		assert.Equal(t, good, b)
+	})
+
+	t.Run("renamed file found by crc", func(t *testing.T) {
+		_, err := set.ReadFile(romFile("renamed.bin", good))
+		assert.NoError(t, err)
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		_, err := set.ReadFile(config.ROMFile{FileName: "missing.bin", ExpectedSize: 16})
+		assert.ErrorIs(t, err, ErrMissingFile)
+	})
+
+	t.Run("wrong size", func(t *testing.T) {
+		_, err := set.ReadFile(config.ROMFile{FileName: "short.bin", ExpectedSize: 16})
+		assert.ErrorIs(t, err, ErrWrongSize)
+	})
+
+	t.Run("bad crc32", func(t *testing.T) {
+		f := romFile("a.bin", good)
+		f.CRC32++
+		_, err := set.ReadFile(f)
+		assert.ErrorIs(t, err, ErrBadDump)
+	})
+
+	t.Run("bad sha1", func(t *testing.T) {
+		f := romFile("a.bin", good)
+		f.SHA1 = "0000000000000000000000000000000000000000"
+		_, err := set.ReadFile(f)
+		assert.ErrorIs(t, err, ErrBadDump)
+	})
+}
+
+func Test_Identify(t *testing.T) {
+	h, g, clone := []uint8{1, 2}, []uint8{3, 4}, []uint8{5, 6}
+
+	c := &config.Config{GameSpecs: map[string]config.GameSpec{
+		"parent": {ROMParts: []config.ROMPart{{ROMFile: romFile("h", h)}, {ROMFile: romFile("g", g), StartAddr: 2}}},
+		"clone":  {ROMParts: []config.ROMPart{{ROMFile: romFile("c", clone)}, {ROMFile: romFile("g", g), StartAddr: 2}}},
+		"half":   {ROMParts: []config.ROMPart{{ROMFile: romFile("g", g)}}},
+	}}
+
+	set, err := Open(gametest.Archive(t, map[string][]uint8{"h": h, "g": g}))
+	require.NoError(t, err)
+
+	name, err := Identify(c, set, t.TempDir())
+	require.NoError(t, err)
+	assert.Equal(t, "parent", name)
+
+	set, err = Open(gametest.Archive(t, map[string][]uint8{"other": {9}}))
+	require.NoError(t, err)
+
+	_, err = Identify(c, set, t.TempDir())
+	assert.ErrorIs(t, err, ErrUnknownSet)
+
+	t.Run("clones with the files of their parent archive", func(t *testing.T) {
+		c := &config.Config{GameSpecs: map[string]config.GameSpec{
+			"parent": {ROMParts: []config.ROMPart{{ROMFile: romFile("h", h)}, {ROMFile: romFile("g", g), StartAddr: 2}}},
+			"clone":  {Parent: "parent", ROMParts: []config.ROMPart{{ROMFile: romFile("c", clone)}}},
+		}}
+
+		set, err := Open(gametest.Archive(t, map[string][]uint8{"c": clone}))
+		require.NoError(t, err)
+
+		romDir := t.TempDir()
+
+		_, err = Identify(c, set, romDir)
+		assert.ErrorIs(t, err, ErrUnknownSet)
+
+		require.NoError(t, os.WriteFile(filepath.Join(romDir, "parent.zip"), gametest.Archive(t, map[string][]uint8{"h": h, "g": g}), 0o644))
+
+		name, err := Identify(c, set, romDir)
+		require.NoError(t, err)
+		assert.Equal(t, "clone", name)
+	})
+}
+
+func Test_Audit(t *testing.T) {
+	good, other := []uint8{1, 2, 3, 4}, []uint8{5, 6, 7, 8}
+
+	withSHA1 := romFile("a", good)
+	withSHA1.SHA1 = "12dada1fff4d4787ade3333147202c3b443e376f"
+
+	c := &config.Config{GameSpecs: map[string]config.GameSpec{
+		"game":   {ROMParts: []config.ROMPart{{ROMFile: withSHA1}, {ROMFile: romFile("b", other), StartAddr: 4}}},
+		"single": {ROMParts: []config.ROMPart{{ROMFile: romFile("b", other)}}},
+	}}
+
+	tests := []struct {
+		name     string
+		gameName string
+		files    map[string][]uint8
+		wantName string
+		want     Status
+		wantErr  error
+	}{
+		{"complete", "game", map[string][]uint8{"a": good, "b": other}, "game", STATUS_COMPLETE, nil},
+		{"missing file", "game", map[string][]uint8{"a": good}, "game", STATUS_MISSING, ErrMissingFile},
+		{"wrong size", "game", map[string][]uint8{"a": good[:2], "b": other}, "game", STATUS_BAD_DUMP, ErrWrongSize},
+		{"identified by content", "renamed", map[string][]uint8{"b": other}, "single", STATUS_COMPLETE, nil},
+		{"unknown", "renamed", map[string][]uint8{"c": {9}}, "", STATUS_UNKNOWN, ErrUnknownSet},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set, err := Open(gametest.Archive(t, tt.files))
+			require.NoError(t, err)
+
+			name, status, err := Audit(c, tt.gameName, set, t.TempDir())
+			assert.Equal(t, tt.wantName, name)
+			assert.Equal(t, tt.want, status)
+
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+		})
+	}
+
+	// A bad dump with the CRC32 of the good one is only found by its SHA1
+	t.Run("bad sha1", func(t *testing.T) {
+		bad := romFile("a", good)
+		bad.SHA1 = "0000000000000000000000000000000000000000"
+
+		c := &config.Config{GameSpecs: map[string]config.GameSpec{"game": {ROMParts: []config.ROMPart{{ROMFile: bad}}}}}
+
+		set, err := Open(gametest.Archive(t, map[string][]uint8{"a": good}))
+		require.NoError(t, err)
+
+		_, status, err := Audit(c, "game", set, t.TempDir())
+		assert.Equal(t, STATUS_BAD_DUMP, status)
+		assert.ErrorIs(t, err, ErrBadDump)
+	})
+}
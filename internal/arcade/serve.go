@@ -0,0 +1,533 @@
+package arcade
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"log"
+	"maps"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cterence/goarcade/internal/arcade/lib"
+	"github.com/cterence/goarcade/internal/arcade/ws"
+	"github.com/cterence/goarcade/machine"
+)
+
+const (
+	// Time given to the running game to answer a request
+	COMMAND_TIMEOUT = 2 * time.Second
+	// Text messages queued for a stream client, they are dropped when it is this late
+	STREAM_BUFFER = 256
+	// Save states loaded by clients are much smaller, the memory of the machine is 64KB
+	MAX_STATE_SIZE = 1 << 20
+
+	FORMAT_RAW = "raw"
+	FORMAT_PNG = "png"
+)
+
+//go:embed web/index.html
+var indexHTML []byte
+
+var (
+	errNoGame      = errors.New("no game running")
+	errOrigin      = errors.New("origin not allowed")
+	errContentType = errors.New("content type must be application/json")
+)
+
+// server is the remote control of the games over HTTP. Requests are run by the game loop between frames,
+// so that the machine is only used by its goroutine.
+type server struct {
+	mux            *http.ServeMux
+	commands       chan command
+	soundListBytes [][]uint8
+
+	mu      sync.Mutex
+	streams map[*stream]bool
+}
+
+type command struct {
+	run    func(a *arcade) (any, error)
+	result chan commandResult
+}
+
+type commandResult struct {
+	value any
+	err   error
+}
+
+// stream is a WebSocket client receiving the frames and sounds. Only the latest frame waits for a slow client,
+// while text messages are queued.
+type stream struct {
+	conn   *ws.Conn
+	format string
+	// Frames are shared by the streams and not modified
+	frames chan []uint8
+	texts  chan []byte
+	done   chan struct{}
+}
+
+type status struct {
+	Game   string   `json:"game"`
+	Paused bool     `json:"paused"`
+	Speed  int      `json:"speed"`
+	Cycles uint64   `json:"cycles"`
+	Inputs []string `json:"inputs"`
+}
+
+type pauseRequest struct {
+	Paused bool `json:"paused"`
+}
+
+type inputRequest struct {
+	Input   string `json:"input"`
+	Pressed bool   `json:"pressed"`
+}
+
+type memory struct {
+	Addr uint16 `json:"addr"`
+	Data []int  `json:"data"`
+}
+
+type soundMessage struct {
+	Type   string `json:"type"`
+	Action string `json:"action"`
+	Sound  uint8  `json:"sound"`
+}
+
+var soundActions = map[machine.SoundAction]string{
+	machine.SOUND_PLAY:       "play",
+	machine.SOUND_LOOP_START: "loop_start",
+	machine.SOUND_LOOP_STOP:  "loop_stop",
+}
+
+func newServer(soundListBytes [][]uint8) *server {
+	s := &server{
+		mux:            http.NewServeMux(),
+		commands:       make(chan command),
+		soundListBytes: soundListBytes,
+		streams:        map[*stream]bool{},
+	}
+
+	s.mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write(indexHTML)
+	})
+	s.mux.HandleFunc("GET /api/status", s.handle(func(a *arcade, _ *http.Request) (any, error) {
+		return a.status(), nil
+	}))
+	s.mux.HandleFunc("POST /api/pause", sameOrigin(handleJSON(s, func(a *arcade, req pauseRequest) (any, error) {
+		a.ui.SetPaused(req.Paused)
+
+		return a.status(), nil
+	})))
+	s.mux.HandleFunc("POST /api/reset", sameOrigin(s.handle(func(a *arcade, _ *http.Request) (any, error) {
+		if a.remote != nil {
+			return nil, errRemote
+		}
+
+		a.Reset()
+
+		return a.status(), nil
+	})))
+	s.mux.HandleFunc("POST /api/input", sameOrigin(handleJSON(s, func(a *arcade, req inputRequest) (any, error) {
+		return nil, a.setInput(req.Input, req.Pressed)
+	})))
+	s.mux.HandleFunc("GET /api/memory", s.handle(func(a *arcade, r *http.Request) (any, error) {
+		addr, err := strconv.ParseUint(r.URL.Query().Get("addr"), 0, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid addr: %w", err)
+		}
+
+		length, err := strconv.ParseUint(r.URL.Query().Get("length"), 0, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid length: %w", err)
+		}
+
+		m := memory{Addr: uint16(addr), Data: make([]int, length)}
+		for i := range m.Data {
+			m.Data[i] = int(a.machine.Read(m.Addr + uint16(i)))
+		}
+
+		return m, nil
+	}))
+	s.mux.HandleFunc("PUT /api/memory", sameOrigin(handleJSON(s, func(a *arcade, m memory) (any, error) {
+		if a.remote != nil {
+			return nil, errRemote
+		}
+
+		for i, v := range m.Data {
+			if v < 0 || v > 0xFF {
+				return nil, fmt.Errorf("byte %d of data is out of range (0-255)", i)
+			}
+		}
+
+		for i, v := range m.Data {
+			a.machine.Write(m.Addr+uint16(i), uint8(v))
+		}
+
+		a.resync()
+
+		return nil, nil
+	})))
+	s.mux.HandleFunc("GET /api/state", s.handleState)
+	s.mux.HandleFunc("PUT /api/state", sameOrigin(s.handleLoadState))
+	s.mux.HandleFunc("GET /api/sounds/{id}", s.handleSound)
+	s.mux.HandleFunc("GET /ws", s.handleStream)
+
+	return s
+}
+
+// listen serves the remote control like the pprof server, until the process exits.
+func (s *server) listen(addr string) {
+	fmt.Printf("serving remote control on http://%s\n", addr)
+
+	go func() {
+		log.Println(http.ListenAndServe(addr, s.mux))
+	}()
+}
+
+// exec runs a command in the game loop and waits for its result.
+func (s *server) exec(run func(a *arcade) (any, error)) (any, error) {
+	c := command{run: run, result: make(chan commandResult, 1)}
+
+	select {
+	case s.commands <- c:
+	case <-time.After(COMMAND_TIMEOUT):
+		return nil, errNoGame
+	}
+
+	r := <-c.result
+
+	return r.value, r.err
+}
+
+// process runs the pending commands, it is called by the game loop.
+func (s *server) process(a *arcade) {
+	for {
+		select {
+		case c := <-s.commands:
+			value, err := c.run(a)
+			c.result <- commandResult{value: value, err: err}
+		default:
+			return
+		}
+	}
+}
+
+func (s *server) handle(run func(a *arcade, r *http.Request) (any, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		value, err := s.exec(func(a *arcade) (any, error) { return run(a, r) })
+		writeJSON(w, value, err)
+	}
+}
+
+// sameOrigin rejects the requests of pages served by other sites, which browsers send without asking the user.
+func sameOrigin(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !ws.SameOrigin(r) {
+			writeJSON(w, nil, errOrigin)
+
+			return
+		}
+
+		h(w, r)
+	}
+}
+
+// handleJSON decodes the request body before running the command. Other content types are rejected, browsers
+// send them from any site without a preflight request.
+func handleJSON[T any](s *server, run func(a *arcade, req T) (any, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if t, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || t != "application/json" {
+			writeJSON(w, nil, errContentType)
+
+			return
+		}
+
+		var req T
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, nil, fmt.Errorf("invalid request: %w", err))
+
+			return
+		}
+
+		value, err := s.exec(func(a *arcade) (any, error) { return run(a, req) })
+		writeJSON(w, value, err)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, value any, err error) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err != nil {
+		code := http.StatusBadRequest
+
+		switch {
+		case errors.Is(err, errNoGame):
+			code = http.StatusServiceUnavailable
+		case errors.Is(err, errOrigin):
+			code = http.StatusForbidden
+		case errors.Is(err, errContentType):
+			code = http.StatusUnsupportedMediaType
+		}
+
+		w.WriteHeader(code)
+
+		value = map[string]string{"error": err.Error()}
+	}
+
+	if value == nil {
+		value = map[string]bool{"ok": true}
+	}
+
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+func (s *server) handleState(w http.ResponseWriter, _ *http.Request) {
+	value, err := s.exec(func(a *arcade) (any, error) {
+		var b bytes.Buffer
+
+		err := a.machine.SaveState(&b)
+
+		return b.Bytes(), err
+	})
+	if err != nil {
+		writeJSON(w, nil, err)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, _ = w.Write(value.([]uint8))
+}
+
+// handleLoadState reads the state before running the command, so that the game loop does not wait for the client.
+func (s *server) handleLoadState(w http.ResponseWriter, r *http.Request) {
+	state, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MAX_STATE_SIZE))
+	if err != nil {
+		writeJSON(w, nil, fmt.Errorf("invalid state: %w", err))
+
+		return
+	}
+
+	_, err = s.exec(func(a *arcade) (any, error) {
+		if a.remote != nil {
+			return nil, errRemote
+		}
+
+		if err := a.machine.LoadState(bytes.NewReader(state)); err != nil {
+			return nil, err
+		}
+
+		a.resync()
+
+		return nil, nil
+	})
+	writeJSON(w, nil, err)
+}
+
+// handleSound serves the WAV files, for the web page.
+func (s *server) handleSound(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 0 || id >= len(s.soundListBytes) || len(s.soundListBytes[id]) == 0 {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "audio/wav")
+	_, _ = w.Write(s.soundListBytes[id])
+}
+
+// handleStream sends the frames as binary messages, raw (one byte per pixel, rows of the upright screen) or PNG,
+// and the sounds as JSON text messages. Clients send inputs as JSON text messages.
+func (s *server) handleStream(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = FORMAT_PNG
+	}
+
+	if format != FORMAT_PNG && format != FORMAT_RAW {
+		http.Error(w, "format must be png or raw", http.StatusBadRequest)
+
+		return
+	}
+
+	conn, err := ws.Upgrade(w, r)
+	if err != nil {
+		return
+	}
+	defer lib.DeferErr(conn.Close)
+
+	st := &stream{
+		conn:   conn,
+		format: format,
+		frames: make(chan []uint8, 1),
+		texts:  make(chan []byte, STREAM_BUFFER),
+		done:   make(chan struct{}),
+	}
+
+	s.mu.Lock()
+	s.streams[st] = true
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.streams, st)
+		s.mu.Unlock()
+	}()
+
+	var wg sync.WaitGroup
+
+	wg.Go(st.write)
+
+	for {
+		op, data, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+
+		if op != ws.OP_TEXT {
+			continue
+		}
+
+		var req inputRequest
+
+		err = json.Unmarshal(data, &req)
+		if err == nil {
+			_, err = s.exec(func(a *arcade) (any, error) { return nil, a.setInput(req.Input, req.Pressed) })
+		}
+
+		if err != nil {
+			msg, _ := json.Marshal(map[string]string{"type": "error", "error": err.Error()})
+			st.sendText(msg)
+		}
+	}
+
+	close(st.done)
+	wg.Wait()
+}
+
+// write sends the frames and text messages of the stream until the client is gone.
+func (st *stream) write() {
+	for {
+		var (
+			op   uint8
+			data []byte
+		)
+
+		select {
+		case <-st.done:
+			return
+		case data = <-st.texts:
+			op = ws.OP_TEXT
+		case frame := <-st.frames:
+			op, data = ws.OP_BINARY, frame
+
+			if st.format == FORMAT_PNG {
+				var b bytes.Buffer
+
+				img := &image.Gray{Pix: frame, Stride: machine.WIDTH, Rect: image.Rect(0, 0, machine.WIDTH, machine.HEIGHT)}
+				if err := png.Encode(&b, img); err != nil {
+					continue
+				}
+
+				data = b.Bytes()
+			}
+		}
+
+		// The reader stops on the closed connection
+		if err := st.conn.WriteMessage(op, data); err != nil {
+			if err := st.conn.Close(); err != nil {
+				log.Printf("failed to close stream: %s", err)
+			}
+
+			return
+		}
+	}
+}
+
+// sendFrame replaces the frame waiting for the client, if any.
+func (st *stream) sendFrame(frame []uint8) {
+	select {
+	case <-st.frames:
+	default:
+	}
+
+	st.frames <- frame
+}
+
+// sendText queues a text message, dropping it when the client is too late.
+func (st *stream) sendText(msg []byte) {
+	select {
+	case st.texts <- msg:
+	default:
+	}
+}
+
+// publishFrame sends the screen to the streams, it is called by the game loop after each frame.
+func (s *server) publishFrame(m *machine.Machine) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.streams) == 0 {
+		return
+	}
+
+	frame := slices.Clone(m.Frame().Pix)
+
+	for st := range maps.Keys(s.streams) {
+		st.sendFrame(frame)
+	}
+}
+
+func (s *server) publishSound(e machine.AudioEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.streams) == 0 {
+		return
+	}
+
+	msg, _ := json.Marshal(soundMessage{Type: "sound", Action: soundActions[e.Action], Sound: e.Sound})
+
+	for st := range maps.Keys(s.streams) {
+		st.sendText(msg)
+	}
+}
+
+func (a *arcade) status() status {
+	st := status{Paused: a.ui.Paused, Speed: a.currentSpeed(), Cycles: a.machine.Cycles()}
+
+	if g := a.machine.Game(); g != nil {
+		st.Game = g.Name
+	}
+
+	st.Inputs = slices.Sorted(maps.Keys(a.machine.Inputs()))
+
+	return st
+}
+
+// setInput presses or releases an input like the keyboard does, through the netplay session or the spectated game
+// when there is one, so that the peers stay in sync.
+func (a *arcade) setInput(name string, pressed bool) error {
+	in, ok := a.ui.Inputs[name]
+	if !ok {
+		return fmt.Errorf("unknown input %s", name)
+	}
+
+	a.ui.CPU.SendInput(in.Port, in.Bit, pressed)
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package arcade
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cterence/goarcade/internal/arcade/config"
+	"github.com/cterence/goarcade/internal/arcade/ui"
+	"github.com/cterence/goarcade/machine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRemote records the inputs sent to the peers of a netplay session.
+type fakeRemote struct {
+	sent chan [2]uint8
+}
+
+func (r *fakeRemote) Poll() error {
+	return nil
+}
+
+func (r *fakeRemote) Begin() (bool, error) {
+	return true, nil
+}
+
+func (r *fakeRemote) SendInput(port, bit uint8, pressed bool) {
+	r.sent <- [2]uint8{port, bit}
+}
+
+func (r *fakeRemote) ReadPort(port uint8) uint8 {
+	return 0
+}
+
+// newRemoteServer serves the remote control of a netplay game, its commands are run until the test ends.
+func newRemoteServer(t *testing.T) (*httptest.Server, *arcade, *fakeRemote) {
+	m := machine.New()
+	require.NoError(t, m.LoadProgram([]uint8{0xC3, 0x00, 0x00}))
+
+	r := &fakeRemote{sent: make(chan [2]uint8, 1)}
+	a := &arcade{machine: m, ui: &ui.UI{Inputs: config.DefaultInputs, CPU: r}, remote: r, speed: DEFAULT_SPEED}
+	s := newServer(nil)
+
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(time.Millisecond):
+				s.process(a)
+			}
+		}
+	}()
+
+	srv := httptest.NewServer(s.mux)
+	t.Cleanup(srv.Close)
+
+	return srv, a, r
+}
+
+// request sends a JSON body with the headers given as name and value pairs, and returns the status code.
+func request(t *testing.T, method, url, body string, header ...string) int {
+	req, err := http.NewRequestWithContext(t.Context(), method, url, strings.NewReader(body))
+	require.NoError(t, err)
+
+	req.Header.Set("Content-Type", "application/json")
+
+	for i := 0; i < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, res.Body.Close())
+
+	return res.StatusCode
+}
+
+func Test_ServeNetplay(t *testing.T) {
+	srv, a, r := newRemoteServer(t)
+
+	var state bytes.Buffer
+	require.NoError(t, a.machine.SaveState(&state))
+
+	t.Run("inputs go to the peers", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, request(t, http.MethodPost, srv.URL+"/api/input", `{"input": "coin", "pressed": true}`))
+		assert.Equal(t, [2]uint8{1, 0}, <-r.sent)
+		assert.False(t, a.machine.Pressed("coin"), "the session sets the inputs of the frames")
+	})
+
+	t.Run("memory, states and resets are rejected", func(t *testing.T) {
+		assert.Equal(t, http.StatusBadRequest, request(t, http.MethodPut, srv.URL+"/api/memory", `{"addr": 8192, "data": [1]}`))
+		assert.Equal(t, http.StatusBadRequest, request(t, http.MethodPost, srv.URL+"/api/reset", ""))
+		assert.Equal(t, http.StatusBadRequest, request(t, http.MethodPut, srv.URL+"/api/state", state.String()))
+		assert.Equal(t, uint8(0), a.machine.Read(machine.RAM_START))
+	})
+}
+
+func Test_ServeOrigin(t *testing.T) {
+	srv, _, r := newRemoteServer(t)
+
+	t.Run("other sites are rejected", func(t *testing.T) {
+		assert.Equal(t, http.StatusUnsupportedMediaType, request(t, http.MethodPost, srv.URL+"/api/input", `{"input": "coin", "pressed": true}`, "Content-Type", "text/plain"))
+		assert.Equal(t, http.StatusForbidden, request(t, http.MethodPost, srv.URL+"/api/input", `{"input": "coin", "pressed": true}`, "Origin", "http://example.com"))
+		assert.Equal(t, http.StatusForbidden, request(t, http.MethodPost, srv.URL+"/api/reset", "", "Origin", "http://example.com"))
+		assert.Equal(t, http.StatusForbidden, request(t, http.MethodPut, srv.URL+"/api/memory", `{"addr": 8192, "data": [1]}`, "Origin", "http://example.com"))
+		assert.Empty(t, r.sent)
+	})
+
+	t.Run("the host is accepted", func(t *testing.T) {
+		assert.Equal(t, http.StatusOK, request(t, http.MethodPost, srv.URL+"/api/input", `{"input": "coin", "pressed": true}`, "Origin", srv.URL))
+		assert.Equal(t, [2]uint8{1, 0}, <-r.sent)
+	})
+}
@@ -0,0 +1,90 @@
+package settings
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/goccy/go-yaml"
+)
+
+// Settings are the user preferences and history kept between runs, apart from the game specs config.
+type Settings struct {
+	LastPlayed map[string]time.Time `yaml:"lastPlayed"`
+	Window     Window               `yaml:"window"`
+
+	// File the settings are saved to
+	path string
+}
+
+// Window is the placement of the emulator window, restored on the next run. The size is unset until a window is closed,
+// it is the size of the window showing a portrait screen.
+type Window struct {
+	X          int32 `yaml:"x"`
+	Y          int32 `yaml:"y"`
+	Width      int32 `yaml:"width"`
+	Height     int32 `yaml:"height"`
+	Fullscreen bool  `yaml:"fullscreen"`
+}
+
+// Path returns the settings file path in the user config directory.
+func Path() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find user config directory: %w", err)
+	}
+
+	return filepath.Join(dir, "goarcade", "settings.yaml"), nil
+}
+
+// Load reads the settings file, a missing file gives empty settings.
+func Load() (*Settings, error) {
+	path, err := Path()
+	if err != nil {
+		return nil, err
+	}
+
+	var s Settings
+
+	b, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read settings file: %w", err)
+	}
+
+	if err := yaml.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse settings file %s: %w", path, err)
+	}
+
+	s.path = path
+
+	if s.LastPlayed == nil {
+		s.LastPlayed = make(map[string]time.Time)
+	}
+
+	return &s, nil
+}
+
+func (s *Settings) Save() error {
+	b, err := yaml.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to encode settings: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create settings directory: %w", err)
+	}
+
+	if err := os.WriteFile(s.path, b, 0o644); err != nil {
+		return fmt.Errorf("failed to write settings file: %w", err)
+	}
+
+	return nil
+}
+
+// Played records that a game was started now.
+func (s *Settings) Played(gameName string) {
+	s.LastPlayed[gameName] = time.Now()
+}
@@ -0,0 +1,26 @@
+package settings
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_SaveLoad(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+
+	s, err := Load()
+	require.NoError(t, err)
+	assert.Empty(t, s.LastPlayed)
+
+	s.Played("invaders")
+	s.Window = Window{X: 10, Y: 20, Width: 672, Height: 768}
+	require.NoError(t, s.Save())
+
+	loaded, err := Load()
+	require.NoError(t, err)
+	assert.True(t, s.LastPlayed["invaders"].Equal(loaded.LastPlayed["invaders"]))
+	assert.Equal(t, s.Window, loaded.Window)
+}
@@ -0,0 +1,200 @@
+package spectate
+
+import (
+	"encoding/gob"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/cterence/goarcade/internal/arcade/lib"
+	"github.com/cterence/goarcade/internal/arcade/netinput"
+	"github.com/cterence/goarcade/machine"
+)
+
+// Server streams the frames recorded from a game to its viewers.
+type Server struct {
+	ln    net.Listener
+	names []string
+
+	mu    sync.Mutex
+	frame int
+	// Last state and the frames since, sent first to the viewers joining
+	backlog []Message
+	// Set when the game changed outside of its inputs, the next frame sends a state
+	resync  bool
+	viewers map[*viewer]bool
+	closed  bool
+}
+
+type viewer struct {
+	conn net.Conn
+	// Closes conn once, from its writer or when it does not keep up
+	close func() error
+	out   chan Message
+}
+
+// Listen accepts viewers on addr for the game of the machine, the stream starts with the next frame recorded.
+func Listen(addr string, m *machine.Machine) (*Server, error) {
+	names, err := netinput.Names(m)
+	if err != nil {
+		return nil, err
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		ln:      ln,
+		names:   names,
+		resync:  true,
+		viewers: map[*viewer]bool{},
+	}
+
+	go s.accept()
+
+	return s, nil
+}
+
+// Addr returns the address viewers connect to.
+func (s *Server) Addr() net.Addr {
+	return s.ln.Addr()
+}
+
+func (s *Server) accept() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		v := &viewer{
+			conn:  conn,
+			close: sync.OnceValue(conn.Close),
+			out:   make(chan Message, VIEWER_BUFFER),
+		}
+
+		s.mu.Lock()
+
+		if s.closed {
+			s.mu.Unlock()
+			lib.DeferErr(conn.Close)
+
+			return
+		}
+
+		// The backlog is shorter than the buffer
+		for _, msg := range s.backlog {
+			v.out <- msg
+		}
+
+		s.viewers[v] = true
+		s.mu.Unlock()
+
+		go s.serve(v)
+	}
+}
+
+func (s *Server) serve(v *viewer) {
+	defer lib.DeferErr(v.close)
+	defer s.drop(v)
+
+	enc := gob.NewEncoder(v.conn)
+
+	for msg := range v.out {
+		if err := enc.Encode(msg); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) drop(v *viewer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.remove(v)
+}
+
+// remove stops sending messages to a viewer, its writer stops after the queued ones.
+func (s *Server) remove(v *viewer) {
+	if s.viewers[v] {
+		delete(s.viewers, v)
+		close(v.out)
+	}
+}
+
+// Record sends the inputs of the frame about to run, after a state of the machine when it changed outside of
+// its inputs. A state is kept every SNAPSHOT_INTERVAL frames for the viewers joining late.
+func (s *Server) Record(m *machine.Machine) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.resync || s.frame%SNAPSHOT_INTERVAL == 0 {
+		st, err := newState(m, s.names)
+		if err != nil {
+			return fmt.Errorf("failed to record spectated state: %w", err)
+		}
+
+		msg := Message{Frame: s.frame, State: st}
+		s.backlog = append(s.backlog[:0], msg)
+
+		// Viewers already have the periodic states
+		if s.resync {
+			s.send(msg)
+			s.resync = false
+		}
+	}
+
+	msg := Message{Frame: s.frame, Inputs: netinput.Pressed(m, s.names)}
+	s.backlog = append(s.backlog, msg)
+	s.send(msg)
+	s.frame++
+
+	return nil
+}
+
+// send queues a message for every viewer, the viewers which do not keep up are disconnected.
+func (s *Server) send(msg Message) {
+	for v := range s.viewers {
+		select {
+		case v.out <- msg:
+		default:
+			s.remove(v)
+			// Stops its writer, which reports the error
+			_ = v.close()
+		}
+	}
+}
+
+// Resync sends a state with the next frame, after the game changed outside of its inputs.
+func (s *Server) Resync() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.resync = true
+}
+
+// Viewers returns the number of viewers connected.
+func (s *Server) Viewers() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.viewers)
+}
+
+// Close stops accepting viewers, they are disconnected after the frames recorded.
+func (s *Server) Close() error {
+	err := s.ln.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+
+	for v := range s.viewers {
+		s.remove(v)
+	}
+
+	return err
+}
@@ -0,0 +1,105 @@
+// Package spectate streams a game to viewers which replay it on their own machine. The stream starts with a
+// state of the machine followed by the inputs of every frame: machines are deterministic, so the viewers run
+// the same frames as the game they watch without receiving its video.
+package spectate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/cterence/goarcade/internal/arcade/netinput"
+	"github.com/cterence/goarcade/machine"
+)
+
+const (
+	// Frames between the states kept for the viewers joining late, which replay the frames since the last one
+	SNAPSHOT_INTERVAL = 600
+	// Messages queued for a viewer, slower viewers are disconnected
+	VIEWER_BUFFER = 2 * SNAPSHOT_INTERVAL
+	// Frames a viewer lets queue before running them at once, to stay close to the live game
+	MAX_LAG = 6
+)
+
+var ErrEnded = errors.New("spectated game ended")
+
+// Message is the inputs of a frame, or a state loaded before the frame.
+type Message struct {
+	Frame int
+	// Inputs pressed, a mask of the input names of the state
+	Inputs uint32
+	State  *State
+}
+
+// State starts the stream of a viewer. It is sent again when the game changes outside of its inputs: after a
+// reset, a state load or a DIP switch change.
+type State struct {
+	Version int
+	Game    string
+	// Input names in order
+	Inputs []string
+	// DIP switch settings as name=label
+	DIPSwitches []string
+	// Save state of the machine
+	Machine []uint8
+}
+
+func gameName(m *machine.Machine) string {
+	if g := m.Game(); g != nil {
+		return g.Name
+	}
+
+	return ""
+}
+
+func newState(m *machine.Machine, names []string) (*State, error) {
+	var b bytes.Buffer
+
+	if err := m.SaveState(&b); err != nil {
+		return nil, err
+	}
+
+	dips := make([]string, 0, len(m.DIPSwitches()))
+	for _, d := range m.DIPSwitches() {
+		dips = append(dips, d.Name+"="+m.DIPSwitchSetting(d.Name))
+	}
+
+	return &State{
+		Version:     netinput.PROTOCOL_VERSION,
+		Game:        gameName(m),
+		Inputs:      names,
+		DIPSwitches: dips,
+		Machine:     b.Bytes(),
+	}, nil
+}
+
+// load sets the DIP switches and loads the state on a machine running the same game.
+func (s *State) load(m *machine.Machine) error {
+	if s.Version != netinput.PROTOCOL_VERSION {
+		return fmt.Errorf("spectate protocol version %d is not %d", s.Version, netinput.PROTOCOL_VERSION)
+	}
+
+	if game := gameName(m); s.Game != game {
+		return fmt.Errorf("spectated game %q is not %q", s.Game, game)
+	}
+
+	names, err := netinput.Names(m)
+	if err != nil {
+		return err
+	}
+
+	if !slices.Equal(names, s.Inputs) {
+		return fmt.Errorf("spectated game inputs %v are not %v", s.Inputs, names)
+	}
+
+	for _, d := range s.DIPSwitches {
+		name, label, _ := strings.Cut(d, "=")
+		if err := m.SetDIPSwitch(name, label); err != nil {
+			return err
+		}
+	}
+
+	return m.LoadState(bytes.NewReader(s.Machine))
+}
@@ -0,0 +1,148 @@
+package spectate
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/cterence/goarcade/internal/gametest"
+	"github.com/cterence/goarcade/machine"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newMachine(t *testing.T) *machine.Machine {
+	m := machine.New()
+	require.NoError(t, m.LoadProgram(gametest.InputsProgram))
+
+	return m
+}
+
+func record(t *testing.T, s *Server, m *machine.Machine, from, to int) {
+	for f := from; f < to; f++ {
+		require.NoError(t, m.SetInput("coin", f%3 == 0))
+		require.NoError(t, m.SetInput("p1_fire", f%7 < 2))
+		require.NoError(t, s.Record(m))
+		m.RunFrame()
+	}
+}
+
+// watch runs the frames of a viewer until the game ends.
+func watch(t *testing.T, v *Viewer) {
+	for {
+		if err := v.Poll(); err != nil {
+			assert.ErrorIs(t, err, ErrEnded)
+
+			return
+		}
+
+		ok, err := v.Begin()
+		require.NoError(t, err)
+
+		if !ok {
+			time.Sleep(time.Millisecond)
+
+			continue
+		}
+
+		v.m.RunFrame()
+	}
+}
+
+func saveState(t *testing.T, m *machine.Machine) []uint8 {
+	var b bytes.Buffer
+	require.NoError(t, m.SaveState(&b))
+
+	return b.Bytes()
+}
+
+func Test_Spectate(t *testing.T) {
+	const FRAMES = SNAPSHOT_INTERVAL + 60
+
+	host := newMachine(t)
+
+	s, err := Listen("127.0.0.1:0", host)
+	require.NoError(t, err)
+
+	record(t, s, host, 0, 10)
+
+	early, err := Watch(t.Context(), s.Addr().String(), newMachine(t))
+	require.NoError(t, err)
+	defer early.Close()
+
+	record(t, s, host, 10, 300)
+
+	// The viewers load the state of the game after the reset
+	host.Reset()
+	s.Resync()
+
+	record(t, s, host, 300, FRAMES)
+
+	late, err := Watch(t.Context(), s.Addr().String(), newMachine(t))
+	require.NoError(t, err)
+	defer late.Close()
+
+	assert.Equal(t, SNAPSHOT_INTERVAL, late.Frame())
+	assert.Equal(t, 2, s.Viewers())
+
+	t.Run("games are not the program", func(t *testing.T) {
+		archive, config := gametest.Game(t, gametest.InputsProgram, "")
+
+		m := machine.New()
+		require.NoError(t, m.Load(archive, config, "game.zip"))
+
+		_, err := Watch(t.Context(), s.Addr().String(), m)
+		assert.EqualError(t, err, `spectated game "" is not "game"`)
+	})
+
+	require.NoError(t, s.Close())
+
+	want := saveState(t, host)
+
+	for _, v := range []*Viewer{early, late} {
+		watch(t, v)
+
+		assert.Equal(t, FRAMES, v.Frame())
+		assert.Equal(t, want, saveState(t, v.m))
+	}
+
+	assert.ErrorIs(t, early.Poll(), ErrEnded)
+}
+
+func Test_ViewerClose(t *testing.T) {
+	host := newMachine(t)
+
+	s, err := Listen("127.0.0.1:0", host)
+	require.NoError(t, err)
+
+	record(t, s, host, 0, 10)
+
+	v, err := Watch(t.Context(), s.Addr().String(), newMachine(t))
+	require.NoError(t, err)
+
+	// The frames not run fill the queue of the reader
+	record(t, s, host, 10, VIEWER_BUFFER+SNAPSHOT_INTERVAL)
+	require.Eventually(t, func() bool { return len(v.in) == VIEWER_BUFFER }, 5*time.Second, time.Millisecond)
+
+	require.NoError(t, v.Close())
+	require.NoError(t, v.Close(), "closing again does nothing")
+
+	stopped := make(chan struct{})
+
+	go func() {
+		for range v.in {
+		}
+
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the reader is still blocked")
+	}
+
+	assert.ErrorIs(t, v.err, net.ErrClosed)
+	require.NoError(t, s.Close())
+}
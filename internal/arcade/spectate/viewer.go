@@ -0,0 +1,231 @@
+package spectate
+
+import (
+	"bufio"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/cterence/goarcade/internal/arcade/netinput"
+	"github.com/cterence/goarcade/machine"
+)
+
+// Viewer replays a game streamed by a server on its machine. Its inputs are ignored.
+type Viewer struct {
+	m    *machine.Machine
+	conn net.Conn
+
+	in chan Message
+	// Closed by Close, stops the reader blocked on a full in
+	done      chan struct{}
+	closeOnce sync.Once
+	// Set when the reader stops, read once in is closed
+	err error
+	// Set once the messages received before the reader stopped are run
+	ended error
+
+	// Messages received and not run yet, with the number of frames among them
+	queue  []Message
+	queued int
+
+	names []string
+	// Next frame to run
+	frame int
+	// Frames run at once to catch up with the game
+	skipped int
+}
+
+// Watch connects to the server at addr and loads the state the stream starts with on the machine, which has
+// to be loaded with the same game.
+func Watch(ctx context.Context, addr string, m *machine.Machine) (*Viewer, error) {
+	var d net.Dialer
+
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to spectated game: %w", err)
+	}
+
+	v := &Viewer{
+		m:    m,
+		conn: conn,
+		in:   make(chan Message, VIEWER_BUFFER),
+		done: make(chan struct{}),
+	}
+
+	go v.read()
+
+	var msg Message
+
+	select {
+	case <-ctx.Done():
+		return nil, errors.Join(ctx.Err(), v.Close())
+	case received, ok := <-v.in:
+		if !ok {
+			return nil, errors.Join(fmt.Errorf("failed to receive spectated state: %w", v.err), v.Close())
+		}
+
+		msg = received
+	}
+
+	if msg.State == nil {
+		return nil, errors.Join(errors.New("spectated stream does not start with a state"), v.Close())
+	}
+
+	if err := v.load(msg); err != nil {
+		return nil, errors.Join(err, v.Close())
+	}
+
+	return v, nil
+}
+
+func (v *Viewer) read() {
+	defer close(v.in)
+
+	dec := gob.NewDecoder(bufio.NewReader(v.conn))
+
+	for {
+		var msg Message
+
+		if err := dec.Decode(&msg); err != nil {
+			v.err = err
+
+			return
+		}
+
+		select {
+		case v.in <- msg:
+		case <-v.done:
+			v.err = net.ErrClosed
+
+			return
+		}
+	}
+}
+
+func (v *Viewer) load(msg Message) error {
+	if err := msg.State.load(v.m); err != nil {
+		return err
+	}
+
+	v.names = msg.State.Inputs
+	v.frame = msg.Frame
+
+	return nil
+}
+
+// receive queues the messages received, without blocking.
+func (v *Viewer) receive() {
+	for v.ended == nil {
+		select {
+		case msg, ok := <-v.in:
+			if !ok {
+				v.ended = ErrEnded
+				if !errors.Is(v.err, io.EOF) {
+					v.ended = fmt.Errorf("failed to receive spectated game: %w", v.err)
+				}
+
+				return
+			}
+
+			v.queue = append(v.queue, msg)
+			if msg.State == nil {
+				v.queued++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// Poll receives the stream, it returns ErrEnded once every frame of a game which ended was run.
+func (v *Viewer) Poll() error {
+	v.receive()
+
+	if v.ended != nil && v.queued == 0 {
+		return v.ended
+	}
+
+	return nil
+}
+
+// Begin sets the inputs of the next frame, it returns false when the frame was not received yet. Frames
+// queued past MAX_LAG are run at once without their sounds.
+func (v *Viewer) Begin() (bool, error) {
+	v.receive()
+
+	for v.queued > MAX_LAG {
+		if err := v.next(); err != nil {
+			return false, err
+		}
+
+		v.m.RunFrame()
+		v.m.AudioEvents()
+		v.skipped++
+	}
+
+	if v.queued == 0 {
+		return false, nil
+	}
+
+	return true, v.next()
+}
+
+// next loads the states queued before the next frame and sets its inputs.
+func (v *Viewer) next() error {
+	for {
+		msg := v.queue[0]
+		v.queue = v.queue[1:]
+
+		if msg.State != nil {
+			if err := v.load(msg); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if msg.Frame != v.frame {
+			return fmt.Errorf("spectated frame %d received instead of %d", msg.Frame, v.frame)
+		}
+
+		netinput.Apply(v.m, v.names, msg.Inputs)
+
+		v.queued--
+		v.frame++
+
+		return nil
+	}
+}
+
+// Frame returns the next frame to run.
+func (v *Viewer) Frame() int {
+	return v.frame
+}
+
+// Skipped returns the frames run at once to catch up with the game.
+func (v *Viewer) Skipped() int {
+	return v.skipped
+}
+
+// SendInput ignores the inputs of the player, viewers only watch.
+func (v *Viewer) SendInput(port, bit uint8, pressed bool) {}
+
+func (v *Viewer) ReadPort(port uint8) uint8 {
+	return v.m.ReadPort(port)
+}
+
+// Close disconnects from the server and stops the reader.
+func (v *Viewer) Close() error {
+	var err error
+
+	v.closeOnce.Do(func() {
+		close(v.done)
+		err = v.conn.Close()
+	})
+
+	return err
+}
@@ -0,0 +1,222 @@
+package arcade
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/cterence/goarcade/internal/arcade/netplay"
+	"github.com/cterence/goarcade/internal/arcade/pacing"
+	"github.com/cterence/goarcade/internal/arcade/spectate"
+	"github.com/cterence/goarcade/machine"
+)
+
+const (
+	MIN_SPEED     = 25
+	MAX_SPEED     = 1000
+	DEFAULT_SPEED = 100
+)
+
+// Speeds stepped through by the speed actions, in percent
+var SPEEDS = []int{25, 50, 75, 100, 150, 200, 300, 500, 1000}
+
+// loop runs the game by frames until the CPU halts or the context is canceled. Each step of the pacer runs as many
+// frames as the speed allows, or as many as possible when unthrottled, then shows the last one. Netplay and
+// spectated frames also wait for their inputs from the network.
+func (a *arcade) loop(ctx context.Context) error {
+	a.pacer = a.newPacer()
+
+	if a.debug {
+		defer a.printPacingStats()
+	}
+
+	for a.machine.Running() {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if a.server != nil {
+			a.server.process(a)
+		}
+
+		if a.remote != nil {
+			if err := a.remote.Poll(); err != nil {
+				return err
+			}
+		}
+
+		show := true
+		frames := 0
+
+		switch {
+		case a.ui.Paused:
+			a.pacer.Idle()
+
+			frames, a.advance, a.credit = a.advance, 0, 0
+		case a.unthrottle:
+			show = a.pacer.Due()
+			frames = 1
+		default:
+			frames = a.creditFrames(a.pacer.Wait())
+		}
+
+		for range frames {
+			if a.remote != nil {
+				ready, err := a.remote.Begin()
+				if err != nil {
+					return err
+				}
+
+				// Waiting for the inputs of the peer or of the spectated game
+				if !ready {
+					break
+				}
+			}
+
+			if a.spectators != nil {
+				if err := a.spectators.Record(a.machine); err != nil {
+					return err
+				}
+			}
+
+			a.runFrame()
+		}
+
+		if show && !a.headless {
+			a.ui.Step()
+		}
+	}
+
+	return nil
+}
+
+// newPacer paces the game on the requested timing source, or on the clock when it is not available.
+func (a *arcade) newPacer() *pacing.Pacer {
+	mode := a.sync
+
+	switch {
+	case mode != pacing.MODE_CLOCK && a.headless:
+		fmt.Fprintf(os.Stderr, "warning: no %s sync when headless, using the clock\n", mode)
+
+		mode = pacing.MODE_CLOCK
+	case mode == pacing.MODE_VSYNC && !a.ui.VSync:
+		fmt.Fprintln(os.Stderr, "warning: vsync is not available, using the clock")
+
+		mode = pacing.MODE_CLOCK
+	case mode == pacing.MODE_AUDIO && !a.apu.Clocked():
+		fmt.Fprintln(os.Stderr, "warning: audio is disabled, using the clock")
+
+		mode = pacing.MODE_CLOCK
+	}
+
+	return pacing.New(mode, machine.FPS, a.apu)
+}
+
+// PacingStats returns the frames dropped and late since the game started.
+func (a *arcade) PacingStats() pacing.Stats {
+	return a.pacer.Stats()
+}
+
+func (a *arcade) printPacingStats() {
+	s := a.pacer.Stats()
+	fmt.Fprintf(os.Stderr, "pacing: %d frames, %d dropped, %d late\n", s.Frames, s.Dropped, s.Late)
+
+	switch r := a.remote.(type) {
+	case *netplay.Session:
+		n := r.Stats()
+		fmt.Fprintf(os.Stderr, "netplay: %d rollbacks, %d frames rerun, %d frames stalled\n", n.Rollbacks, n.FramesRerun, n.FramesStalled)
+	case *spectate.Viewer:
+		fmt.Fprintf(os.Stderr, "spectate: %d frames, %d run at once to catch up\n", r.Frame(), r.Skipped())
+	}
+}
+
+// runFrame runs both halves of a frame, the UI draws the half of the screen and the APU plays the sounds of each.
+// The finished frame is sent to the streams of the remote control.
+func (a *arcade) runFrame() {
+	for range 2 {
+		a.machine.RunHalfFrame()
+
+		if !a.headless {
+			a.ui.DrawHalfFrame()
+		}
+
+		a.playSounds()
+	}
+
+	if a.server != nil {
+		a.server.publishFrame(a.machine)
+	}
+}
+
+// playSounds plays the sounds started and stopped by the game since the last call, and sends them to the streams.
+func (a *arcade) playSounds() {
+	for _, e := range a.machine.AudioEvents() {
+		if a.server != nil {
+			a.server.publishSound(e)
+		}
+
+		switch e.Action {
+		case machine.SOUND_PLAY:
+			a.apu.PlaySound(e.Sound)
+		case machine.SOUND_LOOP_START:
+			a.apu.StartSoundLoop(e.Sound)
+		case machine.SOUND_LOOP_STOP:
+			a.apu.StopSoundLoop(e.Sound)
+		}
+	}
+}
+
+// creditFrames returns the frames to run for the frames elapsed at the hardware speed, the part of a frame left is
+// kept for the next step.
+func (a *arcade) creditFrames(elapsed int) int {
+	a.credit += elapsed * a.currentSpeed()
+	frames := a.credit / DEFAULT_SPEED
+	a.credit %= DEFAULT_SPEED
+
+	return frames
+}
+
+func (a *arcade) currentSpeed() int {
+	if a.fastForward {
+		return MAX_SPEED
+	}
+
+	return a.speed
+}
+
+// Speed returns the emulation speed in percent.
+func (a *arcade) Speed() int {
+	return a.speed
+}
+
+// ChangeSpeed steps the emulation speed up or down through SPEEDS, and returns the new speed.
+func (a *arcade) ChangeSpeed(delta int) int {
+	i, found := slices.BinarySearch(SPEEDS, a.speed)
+	if !found && delta > 0 {
+		i--
+	}
+
+	a.speed = SPEEDS[min(max(i+delta, 0), len(SPEEDS)-1)]
+
+	return a.speed
+}
+
+// FastForward runs the game at MAX_SPEED while set.
+func (a *arcade) FastForward(on bool) {
+	a.fastForward = on
+}
+
+// AdvanceFrame runs one frame while paused.
+func (a *arcade) AdvanceFrame() {
+	a.advance++
+}
+
+// CheckSpeed returns an error when a speed in percent is out of the MIN_SPEED-MAX_SPEED range.
+func CheckSpeed(speed int) error {
+	if speed < MIN_SPEED || speed > MAX_SPEED {
+		return fmt.Errorf("speed %d%% is out of range (%d-%d)", speed, MIN_SPEED, MAX_SPEED)
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package arcade
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ChangeSpeed(t *testing.T) {
+	tests := []struct {
+		name  string
+		speed int
+		delta int
+		want  int
+	}{
+		{"up", 100, 1, 150},
+		{"down", 100, -1, 75},
+		{"clamped to the fastest", MAX_SPEED, 1, MAX_SPEED},
+		{"clamped to the slowest", MIN_SPEED, -1, MIN_SPEED},
+		{"several steps clamped", 200, 10, MAX_SPEED},
+		{"up from a speed between steps", 120, 1, 150},
+		{"down from a speed between steps", 120, -1, 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &arcade{speed: tt.speed}
+
+			assert.Equal(t, tt.want, a.ChangeSpeed(tt.delta))
+			assert.Equal(t, tt.want, a.Speed())
+		})
+	}
+}
+
+func Test_CreditFrames(t *testing.T) {
+	tests := []struct {
+		name  string
+		speed int
+		// Frames run for each frame elapsed
+		want []int
+	}{
+		{"hardware speed", 100, []int{1, 1, 1, 1}},
+		{"quarter speed", 25, []int{0, 0, 0, 1, 0, 0, 0, 1}},
+		{"three quarters speed", 75, []int{0, 1, 1, 1, 0, 1, 1, 1}},
+		{"one and a half speed", 150, []int{1, 2, 1, 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &arcade{speed: tt.speed}
+
+			frames := make([]int, 0, len(tt.want))
+			for range tt.want {
+				frames = append(frames, a.creditFrames(1))
+			}
+
+			assert.Equal(t, tt.want, frames)
+		})
+	}
+
+	t.Run("fast forward", func(t *testing.T) {
+		a := &arcade{speed: 50}
+		a.FastForward(true)
+
+		assert.Equal(t, MAX_SPEED/DEFAULT_SPEED, a.creditFrames(1))
+
+		a.FastForward(false)
+
+		assert.Equal(t, 0, a.creditFrames(1))
+		assert.Equal(t, 1, a.creditFrames(1))
+	})
+
+	t.Run("late steps", func(t *testing.T) {
+		a := &arcade{speed: 75}
+
+		assert.Equal(t, 2, a.creditFrames(3))
+		assert.Equal(t, 25, a.credit)
+	})
+}
+
+func Test_CheckSpeed(t *testing.T) {
+	assert.NoError(t, CheckSpeed(MIN_SPEED))
+	assert.NoError(t, CheckSpeed(MAX_SPEED))
+	assert.EqualError(t, CheckSpeed(0), "speed 0% is out of range (25-1000)")
+	assert.EqualError(t, CheckSpeed(-100), "speed -100% is out of range (25-1000)")
+	assert.EqualError(t, CheckSpeed(MAX_SPEED+1), "speed 1001% is out of range (25-1000)")
+}
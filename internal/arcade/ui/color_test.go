@@ -0,0 +1,96 @@
+package ui
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/cterence/goarcade/internal/arcade/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_MultiplyColor(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b uint32
+		want uint32
+	}{
+		{"white leaves the color", 0xFF12AB34, COLOR_WHITE, 0xFF12AB34},
+		{"black hides the color", 0xFF12AB34, COLOR_BLACK, COLOR_BLACK},
+		{"channels are multiplied", 0xFFFF8000, 0xFF80FFFF, 0xFF808000},
+		{"alpha is opaque", 0x00FFFFFF, 0x00FFFFFF, COLOR_WHITE},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, multiplyColor(tt.a, tt.b))
+		})
+	}
+}
+
+func Test_OverlayImageColor(t *testing.T) {
+	// Two pixels wide image scaled to the screen, offset to check the bounds are used
+	img := image.NewNRGBA(image.Rect(10, 10, 12, 11))
+	img.Set(10, 10, color.NRGBA{R: 0xFF, A: 0xFF})
+	img.Set(11, 10, color.NRGBA{G: 0xFF, A: 0x80})
+
+	assert.Equal(t, uint32(0xFFFF0000), overlayImageColor(img, 0, 0))
+	assert.Equal(t, uint32(0xFFFF0000), overlayImageColor(img, WIDTH/2-1, HEIGHT-1))
+	// Half transparent green over white
+	assert.Equal(t, uint32(0xFF7FFF7F), overlayImageColor(img, WIDTH/2, 0))
+
+	transparent := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+	assert.Equal(t, COLOR_WHITE, overlayImageColor(transparent, 0, 0))
+}
+
+func Test_ComputeColorLUT(t *testing.T) {
+	img := image.NewUniform(color.NRGBA{B: 0xFF, A: 0xFF})
+	overlays := []config.ColorOverlay{
+		{XMin: 10, XMax: 20, YMin: 30, YMax: 40, Color: 0xFF00FF00},
+		{XMin: 0, XMax: 0, YMin: 30, YMax: 40, Color: 0xFFFF0000},
+	}
+
+	t.Run("no overlay", func(t *testing.T) {
+		ui := &UI{}
+		ui.computeColorLUT()
+
+		assert.Equal(t, COLOR_WHITE, ui.colors[0][0])
+		assert.Equal(t, COLOR_WHITE, ui.colors[WIDTH-1][HEIGHT-1])
+	})
+
+	t.Run("rectangles over the image", func(t *testing.T) {
+		ui := &UI{ColorOverlays: overlays, ColorOverlayImage: img}
+		ui.computeColorLUT()
+
+		assert.Equal(t, uint32(0xFF0000FF), ui.colors[0][0])
+		// The first matching rectangle wins, a 0/0 min/max covers the whole axis
+		assert.Equal(t, uint32(0xFF00FF00), ui.colors[15][35])
+		assert.Equal(t, uint32(0xFFFF0000), ui.colors[WIDTH-1][35])
+		assert.Equal(t, uint32(0xFF0000FF), ui.colors[15][41])
+	})
+}
+
+func Test_GetColorPROM(t *testing.T) {
+	// Every color PROM entry lights red and green
+	prom := make([]uint8, 0x800)
+	for i := range prom {
+		prom[i] = 0x05
+	}
+
+	const YELLOW uint32 = 0xFFFFFF00
+
+	t.Run("rectangle overlays are ignored", func(t *testing.T) {
+		ui := &UI{ColorPROM: prom, ColorOverlays: []config.ColorOverlay{{Color: 0xFF0000FF}}}
+		ui.computeColorLUT()
+
+		assert.Equal(t, YELLOW, ui.getColor(0, 0))
+		assert.Equal(t, YELLOW, ui.getColor(WIDTH-1, HEIGHT-1))
+	})
+
+	t.Run("overlay image tints the colors", func(t *testing.T) {
+		ui := &UI{ColorPROM: prom, ColorOverlayImage: image.NewUniform(color.NRGBA{G: 0xFF, A: 0xFF})}
+		ui.computeColorLUT()
+
+		assert.Equal(t, uint32(0xFF00FF00), ui.getColor(0, 0))
+	})
+}
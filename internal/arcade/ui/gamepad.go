@@ -0,0 +1,195 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/Zyko0/go-sdl3/sdl"
+	"github.com/cterence/goarcade/internal/arcade/config"
+)
+
+type gamepad struct {
+	id  sdl.JoystickID
+	pad *sdl.Gamepad
+	// 1 for the first connected gamepad, 2 for the second...
+	player int
+	// Axis directions currently past the deadzone
+	axes map[string]bool
+}
+
+type axisBinding struct {
+	negative string
+	positive string
+}
+
+// initGamepadBindings resolves the gamepad control names of the bindings, axes are suffixed with their direction (leftx-).
+func (ui *UI) initGamepadBindings() {
+	ui.padButtons = make(map[sdl.GamepadButton]string)
+	ui.padAxes = make(map[sdl.GamepadAxis]axisBinding)
+
+	if ui.gamepads == nil {
+		ui.gamepads = make(map[sdl.JoystickID]*gamepad)
+	}
+
+	for control, action := range ui.GamepadBindings {
+		if action == "" {
+			continue
+		}
+
+		if name, ok := strings.CutSuffix(control, "-"); ok {
+			ui.bindAxis(name, control, action, false)
+
+			continue
+		}
+
+		if name, ok := strings.CutSuffix(control, "+"); ok {
+			ui.bindAxis(name, control, action, true)
+
+			continue
+		}
+
+		button := sdl.GetGamepadButtonFromString(control)
+		if button == sdl.GAMEPAD_BUTTON_INVALID {
+			fmt.Fprintln(os.Stderr, "warning: unknown gamepad button in gamepad bindings: "+control)
+
+			continue
+		}
+
+		ui.padButtons[button] = action
+	}
+}
+
+func (ui *UI) bindAxis(name, control, action string, positive bool) {
+	axis := sdl.GetGamepadAxisFromString(name)
+	if axis == sdl.GAMEPAD_AXIS_INVALID {
+		fmt.Fprintln(os.Stderr, "warning: unknown gamepad axis in gamepad bindings: "+control)
+
+		return
+	}
+
+	b := ui.padAxes[axis]
+
+	if positive {
+		b.positive = action
+	} else {
+		b.negative = action
+	}
+
+	ui.padAxes[axis] = b
+}
+
+// addGamepad opens a hotplugged gamepad and gives it the first free player slot.
+func (ui *UI) addGamepad(id sdl.JoystickID) {
+	if _, ok := ui.gamepads[id]; ok {
+		return
+	}
+
+	pad, err := sdl.OpenGamepad(id)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to open gamepad:", err.Error())
+
+		return
+	}
+
+	players := make([]int, 0, len(ui.gamepads))
+	for _, g := range ui.gamepads {
+		players = append(players, g.player)
+	}
+
+	player := 1
+	for slices.Contains(players, player) {
+		player++
+	}
+
+	ui.gamepads[id] = &gamepad{id: id, pad: pad, player: player, axes: make(map[string]bool)}
+
+	fmt.Fprintf(os.Stderr, "gamepad connected: player %d\n", player)
+}
+
+func (ui *UI) removeGamepad(id sdl.JoystickID) {
+	g, ok := ui.gamepads[id]
+	if !ok {
+		return
+	}
+
+	// Release held buttons and directions so that the player does not keep moving
+	ui.releaseGamepad(id)
+
+	g.pad.Close()
+	delete(ui.gamepads, id)
+
+	fmt.Fprintf(os.Stderr, "gamepad disconnected: player %d\n", g.player)
+}
+
+func (ui *UI) handleGamepadButton(e *sdl.GamepadButtonEvent) {
+	g, ok := ui.gamepads[e.Which]
+	if !ok {
+		return
+	}
+
+	action, bound := ui.padButtons[sdl.GamepadButton(e.Button)]
+	src := inputSource{gamepad: e.Which, control: fmt.Sprintf("button %d", e.Button)}
+
+	if ui.menuOpen() {
+		if e.Down {
+			ui.handleMenuButton(sdl.GamepadButton(e.Button))
+		} else if bound {
+			ui.releaseInput(src, config.PlayerInput(ui.Inputs, g.player, action))
+		}
+
+		return
+	}
+
+	if bound {
+		ui.handleAction(src, config.PlayerInput(ui.Inputs, g.player, action), e.Down)
+	}
+}
+
+func (ui *UI) handleGamepadAxis(e *sdl.GamepadAxisEvent) {
+	g, ok := ui.gamepads[e.Which]
+	if !ok {
+		return
+	}
+
+	b, ok := ui.padAxes[sdl.GamepadAxis(e.Axis)]
+	if !ok {
+		return
+	}
+
+	deadzone := int32(ui.GamepadDeadzone)
+	value := int32(e.Value)
+
+	if ui.menuOpen() {
+		// Held directions are released so that they do not resume the game held
+		if value >= -deadzone {
+			ui.setAxisDirection(g, b.negative, false)
+		}
+
+		if value <= deadzone {
+			ui.setAxisDirection(g, b.positive, false)
+		}
+
+		return
+	}
+
+	ui.setAxisDirection(g, b.negative, value < -deadzone)
+	ui.setAxisDirection(g, b.positive, value > deadzone)
+}
+
+func (ui *UI) setAxisDirection(g *gamepad, action string, pressed bool) {
+	if action == "" || g.axes[action] == pressed {
+		return
+	}
+
+	g.axes[action] = pressed
+	ui.handleAction(inputSource{gamepad: g.id, control: "axis " + action}, config.PlayerInput(ui.Inputs, g.player, action), pressed)
+}
+
+func (ui *UI) closeGamepads() {
+	for id, g := range ui.gamepads {
+		g.pad.Close()
+		delete(ui.gamepads, id)
+	}
+}
@@ -0,0 +1,79 @@
+package ui
+
+import (
+	"testing"
+
+	"github.com/cterence/goarcade/internal/arcade/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// ports records the inputs sent to the CPU.
+type ports struct {
+	levels map[[2]uint8]bool
+	sent   int
+}
+
+func (p *ports) SendInput(port, bit uint8, pressed bool) {
+	p.levels[[2]uint8{port, bit}] = pressed
+	p.sent++
+}
+
+func (p *ports) ReadPort(port uint8) uint8 {
+	return 0
+}
+
+func newInputUI() (*UI, *ports) {
+	p := &ports{levels: map[[2]uint8]bool{}}
+	ui := &UI{
+		CPU:     p,
+		Inputs:  map[string]config.Input{"p1_fire": {Port: 1, Bit: 4}},
+		pressed: map[string]map[inputSource]bool{},
+	}
+
+	return ui, p
+}
+
+func Test_HoldInput(t *testing.T) {
+	key := inputSource{control: "key 32"}
+	button := inputSource{gamepad: 1, control: "button 0"}
+	fire := [2]uint8{1, 4}
+
+	t.Run("held while any source holds it", func(t *testing.T) {
+		ui, p := newInputUI()
+
+		ui.handleAction(key, "p1_fire", true)
+		ui.handleAction(button, "p1_fire", true)
+		assert.True(t, p.levels[fire])
+
+		ui.handleAction(key, "p1_fire", false)
+		assert.True(t, p.levels[fire])
+		assert.Contains(t, ui.pressed, "p1_fire")
+
+		ui.handleAction(button, "p1_fire", false)
+		assert.False(t, p.levels[fire])
+		assert.Empty(t, ui.pressed)
+		assert.Equal(t, 2, p.sent)
+	})
+
+	t.Run("releases of sources not holding it are ignored", func(t *testing.T) {
+		ui, p := newInputUI()
+
+		ui.handleAction(key, "p1_fire", true)
+		ui.handleAction(button, "p1_fire", false)
+		assert.True(t, p.levels[fire])
+	})
+
+	t.Run("unplugged gamepads release their inputs", func(t *testing.T) {
+		ui, p := newInputUI()
+
+		ui.handleAction(button, "p1_fire", true)
+		ui.handleAction(inputSource{gamepad: 2, control: "button 0"}, "p1_fire", true)
+
+		ui.releaseGamepad(1)
+		assert.True(t, p.levels[fire])
+
+		ui.releaseGamepad(2)
+		assert.False(t, p.levels[fire])
+		assert.Empty(t, ui.pressed)
+	})
+}
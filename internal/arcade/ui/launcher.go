@@ -0,0 +1,93 @@
+package ui
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/cterence/goarcade/internal/arcade/config"
+)
+
+// LauncherGame is a game archive listed by the launcher.
+type LauncherGame struct {
+	ROMPath    string
+	Name       string
+	Status     string
+	LastPlayed time.Time
+}
+
+// Launcher shows a menu of games until one is selected and returns its archive path,
+// or an empty path when the window is closed or the context is canceled.
+func (ui *UI) Launcher(ctx context.Context, games []LauncherGame, selected string) string {
+	ui.Display = config.Display{}
+	ui.Video = nil
+	ui.Init()
+
+	ui.FromLauncher = true
+	ui.inLauncher = true
+	ui.launchedROM = ""
+	ui.closed = false
+
+	defer func() {
+		ui.inLauncher = false
+		ui.menus = nil
+	}()
+
+	page := &menu{title: "select a game", items: func() []menuItem { return ui.launcherMenu(games) }}
+	page.selected = max(slices.IndexFunc(games, func(g LauncherGame) bool { return g.ROMPath == selected }), 0)
+
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / max(ui.TargetFPS, 1)))
+	defer ticker.Stop()
+
+	for ui.launchedROM == "" && !ui.closed {
+		// The launcher page is the only page, going back from it keeps it open
+		if !ui.menuOpen() {
+			ui.menus = []*menu{page}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ""
+		case <-ticker.C:
+		}
+
+		ui.handleEvents()
+		ui.present(false)
+	}
+
+	return ui.launchedROM
+}
+
+func (ui *UI) launcherMenu(games []LauncherGame) []menuItem {
+	items := make([]menuItem, 0, len(games)+1)
+
+	if len(games) == 0 {
+		items = append(items, menuItem{label: "no game found in rom directory"})
+	}
+
+	now := time.Now()
+
+	for _, g := range games {
+		items = append(items, menuItem{
+			label:      fmt.Sprintf("%-10s %-15s %s", g.Name, g.Status, playedLabel(g.LastPlayed, now)),
+			selectFunc: func() { ui.launchedROM = g.ROMPath },
+		})
+	}
+
+	return append(items, menuItem{label: "quit", selectFunc: func() { ui.closed = true }})
+}
+
+// playedLabel describes when a game was last played in a few characters.
+func playedLabel(t, now time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+
+	days := int(now.Sub(t).Hours() / 24)
+	if days == 0 {
+		return "today"
+	}
+
+	return fmt.Sprintf("%dd ago", days)
+}
@@ -0,0 +1,336 @@
+package ui
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/Zyko0/go-sdl3/sdl"
+	"github.com/cterence/goarcade/internal/arcade/config"
+)
+
+const (
+	MENU_TOP        = 24
+	MENU_ROW_HEIGHT = CHAR_HEIGHT + 3
+	VOLUME_STEP     = 10
+
+	COLOR_MENU_SELECTED uint32 = 0xFFFFFF00
+)
+
+// menu is a page of the pause menu, its items are rebuilt on each frame so that labels follow the emulator state.
+type menu struct {
+	title    string
+	items    func() []menuItem
+	selected int
+}
+
+type menuItem struct {
+	label string
+	// Run with enter or the south gamepad button
+	selectFunc func()
+	// Run with -1 or 1 with left or right
+	changeFunc func(delta int)
+}
+
+func (ui *UI) menuOpen() bool {
+	return len(ui.menus) > 0
+}
+
+// openMenu pauses the game and shows the main menu.
+func (ui *UI) openMenu() {
+	if ui.menuOpen() {
+		return
+	}
+
+	ui.pausedBeforeMenu = ui.Paused
+	ui.SetPaused(true)
+	ui.menus = []*menu{{title: "goarcade", items: ui.mainMenu}}
+}
+
+// closeMenu closes every menu page and restores the pause state from before the menu was opened.
+func (ui *UI) closeMenu() {
+	ui.menus = nil
+	ui.remapping = ""
+	ui.SetPaused(ui.pausedBeforeMenu)
+}
+
+func (ui *UI) pushMenu(title string, items func() []menuItem) {
+	ui.menus = append(ui.menus, &menu{title: title, items: items})
+}
+
+// backMenu goes back to the previous menu page, or closes the menu from the main page.
+func (ui *UI) backMenu() {
+	if len(ui.menus) <= 1 {
+		ui.closeMenu()
+
+		return
+	}
+
+	ui.menus = ui.menus[:len(ui.menus)-1]
+}
+
+func (ui *UI) mainMenu() []menuItem {
+	items := []menuItem{
+		{label: "resume", selectFunc: ui.closeMenu},
+		{label: "reset", selectFunc: func() {
+			ui.Arcade.Reset()
+			ui.closeMenu()
+		}},
+		{
+			label: fmt.Sprintf("save state: slot %d", ui.saveSlot),
+			selectFunc: func() {
+				if err := ui.Arcade.SaveState(ui.saveSlot); err != nil {
+					ui.Notify("failed to save state: " + err.Error())
+				}
+			},
+			changeFunc: ui.changeSaveSlot,
+		},
+		{
+			label: fmt.Sprintf("load state: slot %d", ui.saveSlot),
+			selectFunc: func() {
+				if err := ui.Arcade.LoadState(ui.saveSlot); err != nil {
+					ui.Notify("failed to load state: " + err.Error())
+
+					return
+				}
+
+				ui.closeMenu()
+			},
+			changeFunc: ui.changeSaveSlot,
+		},
+	}
+
+	if len(ui.DIPSwitches) > 0 {
+		items = append(items, menuItem{label: "dip switches", selectFunc: func() { ui.pushMenu("dip switches", ui.dipMenu) }})
+	}
+
+	items = append(items,
+		menuItem{
+			label:      fmt.Sprintf("volume: %d%%", ui.APU.Volume()),
+			changeFunc: func(delta int) { ui.APU.SetVolume(ui.APU.Volume() + delta*VOLUME_STEP) },
+		},
+		menuItem{
+			label:      fmt.Sprintf("speed: %d%%", ui.Arcade.Speed()),
+			changeFunc: func(delta int) { ui.Arcade.ChangeSpeed(delta) },
+		},
+		menuItem{label: "video", selectFunc: func() { ui.pushMenu("video", ui.videoMenu) }},
+		menuItem{label: "controls", selectFunc: func() { ui.pushMenu("controls", ui.controlsMenu) }},
+	)
+
+	if ui.FromLauncher {
+		items = append(items, menuItem{label: "quit to launcher", selectFunc: ui.Arcade.Exit})
+	}
+
+	return append(items, menuItem{label: "quit", selectFunc: ui.Arcade.Shutdown})
+}
+
+func (ui *UI) changeSaveSlot(delta int) {
+	ui.saveSlot = (ui.saveSlot + delta + SAVE_SLOTS) % SAVE_SLOTS
+}
+
+func (ui *UI) dipMenu() []menuItem {
+	items := make([]menuItem, 0, len(ui.DIPSwitches)+1)
+
+	for _, d := range ui.DIPSwitches {
+		change := func(delta int) {
+			labels := d.Labels()
+			i := slices.Index(labels, ui.Arcade.DIPSwitchSetting(d.Name))
+
+			if err := ui.Arcade.SetDIPSwitch(d.Name, labels[(i+delta+len(labels))%len(labels)]); err != nil {
+				ui.Notify("failed to set dip switch: " + err.Error())
+			}
+		}
+
+		items = append(items, menuItem{
+			label:      d.Name + ": " + ui.Arcade.DIPSwitchSetting(d.Name),
+			selectFunc: func() { change(1) },
+			changeFunc: change,
+		})
+	}
+
+	return append(items, menuItem{label: "back", selectFunc: ui.backMenu})
+}
+
+func (ui *UI) videoMenu() []menuItem {
+	toggleFullscreen := func() { ui.setFullscreen(!ui.fullscreen) }
+	toggleOSD := func() { ui.osdHidden = !ui.osdHidden }
+	toggleCocktail := func() { ui.Cocktail = !ui.Cocktail }
+	toggleAspect := func() { ui.setMonitorAspect(!ui.MonitorAspect) }
+
+	items := []menuItem{
+		{label: "fullscreen: " + onOff(ui.fullscreen), selectFunc: toggleFullscreen, changeFunc: func(int) { toggleFullscreen() }},
+		{label: "monitor aspect: " + onOff(ui.MonitorAspect), selectFunc: toggleAspect, changeFunc: func(int) { toggleAspect() }},
+		{label: "osd: " + onOff(!ui.osdHidden), selectFunc: toggleOSD, changeFunc: func(int) { toggleOSD() }},
+	}
+
+	if ui.Display.CocktailFlip != nil {
+		items = append(items, menuItem{label: "cocktail: " + onOff(ui.Cocktail), selectFunc: toggleCocktail, changeFunc: func(int) { toggleCocktail() }})
+	}
+
+	return append(items, menuItem{label: "back", selectFunc: ui.backMenu})
+}
+
+// controlsMenu lists the logical inputs then the actions with their keys, selecting one waits for its new key.
+func (ui *UI) controlsMenu() []menuItem {
+	names := append(slices.Sorted(maps.Keys(ui.Inputs)), config.Actions...)
+	items := make([]menuItem, 0, len(names)+1)
+
+	for _, name := range names {
+		keys := "press a key"
+		if ui.remapping != name {
+			keys = strings.Join(ui.boundKeys(name), ", ")
+		}
+
+		items = append(items, menuItem{
+			label:      name + ": " + keys,
+			selectFunc: func() { ui.remapping = name },
+		})
+	}
+
+	return append(items, menuItem{label: "back", selectFunc: ui.backMenu})
+}
+
+// boundKeys returns the sorted names of the keys bound to an input or action.
+func (ui *UI) boundKeys(action string) []string {
+	var keys []string
+
+	for name, a := range ui.KeyBindings {
+		if a == action {
+			keys = append(keys, name)
+		}
+	}
+
+	slices.Sort(keys)
+
+	return keys
+}
+
+// remapKey binds a key to the input or action being remapped, in place of its previous keys.
+func (ui *UI) remapKey(key sdl.Keycode) {
+	action := ui.remapping
+	ui.remapping = ""
+
+	if key == sdl.K_ESCAPE {
+		return
+	}
+
+	ui.KeyBindings = maps.Clone(ui.KeyBindings)
+	maps.DeleteFunc(ui.KeyBindings, func(_, a string) bool { return a == action })
+	ui.KeyBindings[key.KeyName()] = action
+
+	ui.initKeyBindings()
+}
+
+// handleMenuKey navigates the menu with the arrow keys, enter, and escape or backspace to go back.
+func (ui *UI) handleMenuKey(key sdl.Keycode) {
+	if ui.remapping != "" {
+		ui.remapKey(key)
+
+		return
+	}
+
+	switch key {
+	case sdl.K_UP:
+		ui.moveMenu(-1)
+	case sdl.K_DOWN:
+		ui.moveMenu(1)
+	case sdl.K_LEFT:
+		ui.changeMenuItem(-1)
+	case sdl.K_RIGHT:
+		ui.changeMenuItem(1)
+	case sdl.K_RETURN:
+		ui.selectMenuItem()
+	case sdl.K_ESCAPE, sdl.K_BACKSPACE:
+		ui.backMenu()
+	}
+}
+
+// handleMenuButton navigates the menu with the gamepad d-pad, south to select, east to go back,
+// and the button bound to the menu action closes it.
+func (ui *UI) handleMenuButton(button sdl.GamepadButton) {
+	if ui.remapping != "" {
+		// Keys can only be remapped with a keyboard
+		ui.remapping = ""
+
+		return
+	}
+
+	if ui.padButtons[button] == config.ACTION_MENU {
+		ui.closeMenu()
+
+		return
+	}
+
+	switch button {
+	case sdl.GAMEPAD_BUTTON_DPAD_UP:
+		ui.moveMenu(-1)
+	case sdl.GAMEPAD_BUTTON_DPAD_DOWN:
+		ui.moveMenu(1)
+	case sdl.GAMEPAD_BUTTON_DPAD_LEFT:
+		ui.changeMenuItem(-1)
+	case sdl.GAMEPAD_BUTTON_DPAD_RIGHT:
+		ui.changeMenuItem(1)
+	case sdl.GAMEPAD_BUTTON_SOUTH, sdl.GAMEPAD_BUTTON_START:
+		ui.selectMenuItem()
+	case sdl.GAMEPAD_BUTTON_EAST, sdl.GAMEPAD_BUTTON_BACK:
+		ui.backMenu()
+	}
+}
+
+func (ui *UI) moveMenu(delta int) {
+	m := ui.menus[len(ui.menus)-1]
+	items := m.items()
+	m.selected = (m.selected + delta + len(items)) % len(items)
+}
+
+func (ui *UI) currentMenuItem() menuItem {
+	m := ui.menus[len(ui.menus)-1]
+	items := m.items()
+	m.selected = min(m.selected, len(items)-1)
+
+	return items[m.selected]
+}
+
+func (ui *UI) selectMenuItem() {
+	if item := ui.currentMenuItem(); item.selectFunc != nil {
+		item.selectFunc()
+	}
+}
+
+func (ui *UI) changeMenuItem(delta int) {
+	if item := ui.currentMenuItem(); item.changeFunc != nil {
+		item.changeFunc(delta)
+	}
+}
+
+// menuTexts lays out the current menu page, scrolled to keep the selected item visible.
+func (ui *UI) menuTexts() []osdText {
+	m := ui.menus[len(ui.menus)-1]
+	items := m.items()
+	m.selected = min(m.selected, len(items)-1)
+
+	texts := []osdText{{x: 1, y: MENU_TOP, text: strings.ToUpper(m.title), color: COLOR_OSD_TEXT}}
+
+	rows := (ui.height - MENU_TOP - 2*MENU_ROW_HEIGHT) / MENU_ROW_HEIGHT
+	first := min(max(m.selected-rows/2, 0), max(len(items)-rows, 0))
+
+	for i := first; i < min(first+rows, len(items)); i++ {
+		text, color := "  "+items[i].label, COLOR_OSD_TEXT
+		if i == m.selected {
+			text, color = "> "+items[i].label, COLOR_MENU_SELECTED
+		}
+
+		texts = append(texts, osdText{x: 1, y: MENU_TOP + (i-first+2)*MENU_ROW_HEIGHT, text: text, color: color})
+	}
+
+	return texts
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+
+	return "off"
+}
@@ -0,0 +1,142 @@
+package ui
+
+import (
+	"strings"
+
+	"github.com/cterence/goarcade/internal/arcade/config"
+)
+
+// Unit vectors of the directions, y goes down
+var directions = map[string][2]int{"left": {-1, 0}, "right": {1, 0}, "up": {0, -1}, "down": {0, 1}}
+
+// orientation turns the game frame, drawn for a vertical monitor, into the displayed frame.
+type orientation struct {
+	// Clockwise rotation in degrees, the flips mirror the rotated frame
+	rotation int
+	flipX    bool
+	flipY    bool
+}
+
+// FrameSize returns the size of the displayed frame with a display config.
+func FrameSize(d config.Display) (int, int) {
+	return newOrientation(d, false).size()
+}
+
+func newOrientation(d config.Display, cocktailFlip bool) orientation {
+	o := orientation{rotation: int(d.Rotation) % 360, flipX: d.FlipX, flipY: d.FlipY}
+
+	// The screen is upside down for the player sitting on the other side of a cocktail cabinet
+	if cocktailFlip {
+		o.rotation = (o.rotation + 180) % 360
+	}
+
+	return o
+}
+
+func (o orientation) size() (int, int) {
+	if o.rotation%180 != 0 {
+		return HEIGHT, WIDTH
+	}
+
+	return WIDTH, HEIGHT
+}
+
+// position returns the position in the displayed frame of a game frame pixel.
+func (o orientation) position(x, y int) (int, int) {
+	width, height := o.size()
+
+	switch o.rotation {
+	case 90:
+		x, y = HEIGHT-1-y, x
+	case 180:
+		x, y = WIDTH-1-x, HEIGHT-1-y
+	case 270:
+		x, y = y, WIDTH-1-x
+	}
+
+	if o.flipX {
+		x = width - 1 - x
+	}
+
+	if o.flipY {
+		y = height - 1 - y
+	}
+
+	return x, y
+}
+
+// direction returns the game direction of a direction pressed on the displayed frame, so that controls follow the screen.
+func (o orientation) direction(dir string) string {
+	v := directions[dir]
+	dx, dy := v[0], v[1]
+
+	// Undo the flips, then the rotation
+	if o.flipX {
+		dx = -dx
+	}
+
+	if o.flipY {
+		dy = -dy
+	}
+
+	for range o.rotation / 90 {
+		dx, dy = dy, -dx
+	}
+
+	switch {
+	case dx < 0:
+		return "left"
+	case dx > 0:
+		return "right"
+	case dy < 0:
+		return "up"
+	default:
+		return "down"
+	}
+}
+
+// orientInput replaces the direction suffix of a logical input (p1_left) by the direction it has in the game.
+func (ui *UI) orientInput(action string) string {
+	if ui.orientation == (orientation{}) || !config.DirectionalInput(ui.Inputs, action) {
+		return action
+	}
+
+	i := strings.LastIndex(action, "_")
+
+	return action[:i+1] + ui.orientation.direction(action[i+1:])
+}
+
+// updateOrientation follows the cocktail flip bit, and rebuilds the pixel positions when the orientation changes.
+func (ui *UI) updateOrientation() {
+	flip := false
+	if f := ui.Display.CocktailFlip; f != nil && ui.Cocktail {
+		flip = ui.CPU.ReadPort(f.Port)>>f.Bit&1 == 1
+	}
+
+	o := newOrientation(ui.Display, flip)
+	if o == ui.screenOrientation && ui.positions != nil {
+		return
+	}
+
+	ui.screenOrientation = o
+	ui.positions = make([]int, WIDTH*HEIGHT)
+	ui.redraw = [2]bool{true, true}
+
+	width, _ := o.size()
+
+	for y := range HEIGHT {
+		for x := range WIDTH {
+			dx, dy := o.position(x, y)
+			ui.positions[y*WIDTH+x] = (dy*width + dx) * PIXEL_BYTES
+		}
+	}
+}
+
+// orientedFrame returns the displayed frame, which is the game framebuffer itself when the screen is not turned.
+func (ui *UI) orientedFrame() []uint8 {
+	if ui.screenOrientation == (orientation{}) {
+		return ui.framebuffer[:]
+	}
+
+	return ui.displayFrame[:]
+}
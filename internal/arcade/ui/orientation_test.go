@@ -0,0 +1,73 @@
+package ui
+
+import (
+	"testing"
+
+	"github.com/cterence/goarcade/internal/arcade/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_Orientation(t *testing.T) {
+	tests := []struct {
+		name string
+		o    orientation
+		// Displayed position of the top left pixel of the game frame
+		origin [2]int
+		// Game direction of right pressed on the displayed frame
+		right string
+	}{
+		{"upright", orientation{}, [2]int{0, 0}, "right"},
+		{"90", orientation{rotation: 90}, [2]int{HEIGHT - 1, 0}, "up"},
+		{"180", orientation{rotation: 180}, [2]int{WIDTH - 1, HEIGHT - 1}, "left"},
+		{"270", orientation{rotation: 270}, [2]int{0, WIDTH - 1}, "down"},
+		{"flip x", orientation{flipX: true}, [2]int{WIDTH - 1, 0}, "left"},
+		{"90 flip x", orientation{rotation: 90, flipX: true}, [2]int{0, 0}, "down"},
+		{"180 flip x", orientation{rotation: 180, flipX: true}, [2]int{0, HEIGHT - 1}, "right"},
+		{"270 flip x", orientation{rotation: 270, flipX: true}, [2]int{HEIGHT - 1, WIDTH - 1}, "up"},
+		{"flip y", orientation{flipY: true}, [2]int{0, HEIGHT - 1}, "right"},
+		{"90 flip y", orientation{rotation: 90, flipY: true}, [2]int{HEIGHT - 1, WIDTH - 1}, "up"},
+		{"180 flip y", orientation{rotation: 180, flipY: true}, [2]int{WIDTH - 1, 0}, "left"},
+		{"270 flip y", orientation{rotation: 270, flipY: true}, [2]int{0, 0}, "down"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x, y := tt.o.position(0, 0)
+			assert.Equal(t, tt.origin, [2]int{x, y})
+			assert.Equal(t, tt.right, tt.o.direction("right"))
+
+			// Every pixel lands in the displayed frame
+			width, height := tt.o.size()
+			x, y = tt.o.position(WIDTH-1, HEIGHT-1)
+			assert.Equal(t, [2]int{width - 1 - tt.origin[0], height - 1 - tt.origin[1]}, [2]int{x, y})
+
+			// Moving in the game direction of a pressed direction moves the same way on the displayed frame
+			for dir, want := range directions {
+				v := directions[tt.o.direction(dir)]
+				x0, y0 := tt.o.position(100, 100)
+				x1, y1 := tt.o.position(100+v[0], 100+v[1])
+
+				assert.Equal(t, want, [2]int{x1 - x0, y1 - y0}, dir)
+			}
+		})
+	}
+}
+
+func Test_OrientInput(t *testing.T) {
+	ui := &UI{
+		Inputs: map[string]config.Input{
+			"p1_left":  {Port: 1, Bit: 5},
+			"p1_right": {Port: 1, Bit: 6},
+			"p1_fire":  {Port: 1, Bit: 4},
+		},
+	}
+
+	assert.Equal(t, "p1_right", ui.orientInput("p1_right"), "upright screens keep the inputs")
+
+	ui.orientation = orientation{rotation: 90}
+
+	assert.Equal(t, "p1_up", ui.orientInput("p1_right"))
+	assert.Equal(t, "p1_right", ui.orientInput("p1_down"))
+	assert.Equal(t, "p1_fire", ui.orientInput("p1_fire"))
+	assert.Equal(t, "p2_right", ui.orientInput("p2_right"), "inputs without directions of the game are kept")
+}
@@ -0,0 +1,175 @@
+package ui
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Zyko0/go-sdl3/sdl"
+)
+
+const (
+	TOAST_DURATION = 2 * time.Second
+	MAX_TOASTS     = 4
+	SAVE_SLOTS     = 10
+
+	COLOR_OSD_TEXT       uint32 = 0xFFFFFFFF
+	COLOR_OSD_BACKGROUND uint32 = 0xA0000000
+)
+
+// osd is the on-screen display, drawn in its own texture over the game so that the game framebuffer never contains it.
+type osd struct {
+	texture *sdl.Texture
+	canvas  canvas
+	// Texts currently drawn in pixels, the texture is only updated when they change
+	texts []osdText
+
+	toasts []toast
+
+	frames   int
+	fpsStart time.Time
+	fps      float64
+}
+
+type osdText struct {
+	x, y  int
+	text  string
+	color uint32
+}
+
+type toast struct {
+	text    string
+	expires time.Time
+}
+
+// initOSD creates the OSD texture at the displayed frame size, so that text is not stretched when the screen is turned.
+func (ui *UI) initOSD() {
+	if ui.osd.texture != nil && ui.osd.canvas.width == ui.width && ui.osd.canvas.height == ui.height {
+		return
+	}
+
+	if ui.osd.texture != nil {
+		ui.osd.texture.Destroy()
+	}
+
+	var err error
+
+	ui.osd.texture, err = ui.renderer.CreateTexture(sdl.PIXELFORMAT_ARGB8888, sdl.TEXTUREACCESS_STREAMING, ui.width, ui.height)
+	if err != nil {
+		panic("failed to create osd texture: " + err.Error())
+	}
+
+	if err := ui.osd.texture.SetScaleMode(sdl.SCALEMODE_NEAREST); err != nil {
+		panic("failed to set osd texture scale mode: " + err.Error())
+	}
+
+	if err := ui.osd.texture.SetBlendMode(sdl.BLENDMODE_BLEND); err != nil {
+		panic("failed to set osd texture blend mode: " + err.Error())
+	}
+
+	ui.osd.canvas = canvas{pixels: make([]uint8, ui.width*ui.height*PIXEL_BYTES), width: ui.width, height: ui.height}
+	ui.osd.texts = nil
+	ui.osd.fpsStart = time.Now()
+}
+
+// Notify shows a message on screen for a few seconds, and prints it on stderr for the terminal.
+func (ui *UI) Notify(msg string) {
+	fmt.Fprintln(os.Stderr, msg)
+
+	ui.osd.toasts = append(ui.osd.toasts, toast{text: msg, expires: time.Now().Add(TOAST_DURATION)})
+	if len(ui.osd.toasts) > MAX_TOASTS {
+		ui.osd.toasts = ui.osd.toasts[len(ui.osd.toasts)-MAX_TOASTS:]
+	}
+}
+
+// countFrame updates the measured frame rate, once per emulated frame.
+func (ui *UI) countFrame() {
+	ui.osd.frames++
+
+	if elapsed := time.Since(ui.osd.fpsStart); elapsed >= time.Second {
+		ui.osd.fps = float64(ui.osd.frames) / elapsed.Seconds()
+		ui.osd.frames = 0
+		ui.osd.fpsStart = time.Now()
+	}
+}
+
+// osdTexts lays out the toasts and, unless the OSD is hidden, the frame rate, save slot and pressed inputs.
+func (ui *UI) osdTexts() []osdText {
+	var texts []osdText
+
+	now := time.Now()
+	ui.osd.toasts = slices.DeleteFunc(ui.osd.toasts, func(t toast) bool { return now.After(t.expires) })
+
+	// Toasts are stacked from the bottom, the newest last
+	y := ui.height - 1 - len(ui.osd.toasts)*(CHAR_HEIGHT+2)
+	for _, t := range ui.osd.toasts {
+		texts = append(texts, osdText{x: 1, y: y, text: t.text, color: COLOR_OSD_TEXT})
+		y += CHAR_HEIGHT + 2
+	}
+
+	if ui.menuOpen() {
+		texts = append(texts, ui.menuTexts()...)
+	}
+
+	if ui.osdHidden || ui.inLauncher {
+		return texts
+	}
+
+	status := fmt.Sprintf("%.0f FPS %.0f%%", ui.osd.fps, ui.osd.fps*100/max(ui.TargetFPS, 1))
+	if p := ui.Arcade.PacingStats(); p.Dropped > 0 || p.Late > 0 {
+		status += fmt.Sprintf(" DROP %d LATE %d", p.Dropped, p.Late)
+	}
+
+	if ui.Paused {
+		status = "PAUSED"
+	}
+
+	slot := fmt.Sprintf("SLOT %d", ui.saveSlot)
+
+	texts = append(texts,
+		osdText{x: 1, y: 1, text: status, color: COLOR_OSD_TEXT},
+		osdText{x: ui.width - 1 - textWidth(slot), y: 1, text: slot, color: COLOR_OSD_TEXT},
+	)
+
+	pressed := slices.Sorted(maps.Keys(ui.pressed))
+	if len(pressed) > 0 {
+		texts = append(texts, osdText{x: 1, y: CHAR_HEIGHT + 3, text: strings.Join(pressed, " "), color: COLOR_OSD_TEXT})
+	}
+
+	return texts
+}
+
+func textWidth(text string) int {
+	return len([]rune(text))*CHAR_WIDTH + 1
+}
+
+// renderOSD draws the OSD texture over the game texture, the renderer must not have been presented yet.
+func (ui *UI) renderOSD() {
+	texts := ui.osdTexts()
+	if len(texts) == 0 {
+		ui.osd.texts = nil
+
+		return
+	}
+
+	if !slices.Equal(texts, ui.osd.texts) {
+		clear(ui.osd.canvas.pixels)
+
+		for _, t := range texts {
+			ui.osd.canvas.drawText(t.x, t.y, t.text, t.color)
+		}
+
+		if err := ui.osd.texture.Update(nil, ui.osd.canvas.pixels, int32(ui.width*PIXEL_BYTES)); err != nil {
+			panic("failed to update osd texture: " + err.Error())
+		}
+
+		ui.osd.texts = texts
+	}
+
+	if err := ui.renderer.RenderTexture(ui.osd.texture, nil, nil); err != nil {
+		panic("failed to render osd texture: " + err.Error())
+	}
+}
@@ -1,31 +1,49 @@
 package ui
 
 import (
-	"encoding/binary"
 	"fmt"
+	"image"
+	"os"
+	"slices"
+	"strings"
 
 	"github.com/Zyko0/go-sdl3/sdl"
 	"github.com/cterence/goarcade/internal/arcade/config"
+	"github.com/cterence/goarcade/internal/arcade/pacing"
+	"github.com/cterence/goarcade/internal/arcade/settings"
+	"github.com/cterence/goarcade/internal/arcade/video"
+	"github.com/cterence/goarcade/machine"
 )
 
 type bus interface {
 	Read(addr uint16) uint8
+	TakeDirty(addr uint16) bool
 }
 
 type cpu interface {
-	RequestInterrupt(id uint8)
 	SendInput(port uint8, bit uint8, value bool)
+	ReadPort(port uint8) uint8
 }
 
 type apu interface {
 	TogglePauseAudio(paused bool)
+	Volume() int
+	SetVolume(volume int)
 }
 
 type arcade interface {
 	Reset()
-	SaveState() error
-	LoadState() error
+	SaveState(slot int) error
+	LoadState(slot int) error
 	Shutdown()
+	Exit()
+	DIPSwitchSetting(name string) string
+	SetDIPSwitch(name, label string) error
+	Speed() int
+	ChangeSpeed(delta int) int
+	FastForward(on bool)
+	AdvanceFrame()
+	PacingStats() pacing.Stats
 }
 
 type UI struct {
@@ -37,24 +55,90 @@ type UI struct {
 	window   *sdl.Window
 	renderer *sdl.Renderer
 	texture  *sdl.Texture
-	surface  *sdl.Surface
-
-	ColorOverlays []config.ColorOverlay
-	ColorPROM     []uint8
+	// Post-processed game frame with its artwork, rendered instead of the game texture
+	videoTexture *sdl.Texture
+
+	ColorOverlays     []config.ColorOverlay
+	ColorOverlayImage image.Image
+	ColorPROM         []uint8
+	Inputs            map[string]config.Input
+	KeyBindings       map[string]string
+	GamepadBindings   map[string]string
+	GamepadDeadzone   uint16
+	DIPSwitches       []config.DIPSwitch
+	// CRT effects and artwork of the game, nil to render the game frame as is
+	Video *video.Pipeline
+
+	keys       map[sdl.Keycode]string
+	padButtons map[sdl.GamepadButton]string
+	padAxes    map[sdl.GamepadAxis]axisBinding
+	gamepads   map[sdl.JoystickID]*gamepad
+
+	// Index of the DIP switch changed by the dip_change action
+	selectedDIP int
+
+	osd osd
+	// Hides the frame rate, save slot and input display, toasts are always shown
+	osdHidden bool
+	saveSlot  int
+	// Logical inputs currently pressed with the keys and gamepad controls holding them
+	pressed map[string]map[inputSource]bool
+	// Frame rate of the emulated hardware, the OSD shows the speed relative to it
+	TargetFPS float64
+	// Presents frames on the display vertical sync, cleared when the renderer does not support it
+	VSync bool
+
+	// Pause menu pages, the last one is shown
+	menus            []*menu
+	pausedBeforeMenu bool
+	// Input or action waiting for its new key in the controls menu
+	remapping  string
+	fullscreen bool
+
+	// Window size multiplier of the screen, SCALE when unset
+	Scale int
+	// Shows the screen at the 4:3 aspect of the arcade monitor instead of square pixels
+	MonitorAspect bool
+	// Window placement of the previous session, restored when the window is created
+	Placement settings.Window
+
+	// Set when the game was started from the launcher, the menu can go back to it
+	FromLauncher bool
+	inLauncher   bool
+	launchedROM  string
+	// Set when the window is closed
+	closed bool
 
 	colors      [WIDTH][HEIGHT]uint32
 	framebuffer [WIDTH * HEIGHT * PIXEL_BYTES]uint8
+	// Halves of the frame to draw from every VRAM byte, after the colors or the orientation changed
+	redraw [2]bool
+	// Set when the framebuffer changed since the texture was updated
+	textureStale bool
+	// Set when a whole frame was drawn since the frame was shown
+	frameDone bool
+
+	// Screen orientation of the game, and the displayed frame when it is turned
+	Display  config.Display
+	Cocktail bool
+	// Orientation followed by the controls, without the cocktail flip
+	orientation       orientation
+	screenOrientation orientation
+	// Offset in the displayed frame of each game frame pixel
+	positions     []int
+	displayFrame  [WIDTH * HEIGHT * PIXEL_BYTES]uint8
+	width, height int
 
 	Paused     bool
 	startYDraw int
 }
 
 const (
-	VRAM_START uint16 = 0x2400
-	VRAM_SIZE  uint16 = 0x1C00
+	VRAM_START = machine.VRAM_START
+	VRAM_SIZE  = machine.VRAM_SIZE
 
-	WIDTH       = 224
-	HEIGHT      = 256
+	WIDTH       = machine.WIDTH
+	HEIGHT      = machine.HEIGHT
 	PIXEL_BYTES = 4
 	SCALE       = 3
 
@@ -66,21 +150,34 @@ func (ui *UI) Init() {
 	ui.Paused = false
 	ui.startYDraw = 0
 	ui.computeColorLUT()
+	ui.redraw = [2]bool{true, true}
+	ui.textureStale = true
 
-	err := sdl.Init(sdl.INIT_VIDEO)
+	err := sdl.Init(sdl.INIT_VIDEO | sdl.INIT_GAMEPAD)
 	if err != nil {
 		panic("failed to init sdl: " + err.Error())
 	}
 
+	ui.orientation = newOrientation(ui.Display, false)
+	ui.positions = nil
+
+	width, height := ui.orientation.size()
+	resized := width != ui.width || height != ui.height
+	ui.width, ui.height = width, height
+
 	if ui.window == nil && ui.renderer == nil {
-		ui.window, ui.renderer, err = sdl.CreateWindowAndRenderer("goarcade", WIDTH*SCALE, HEIGHT*SCALE, sdl.WINDOW_RESIZABLE)
-		if err != nil {
-			panic("failed to create window and renderer: " + err.Error())
-		}
+		ui.createWindow()
+	} else if resized {
+		ui.resizeWindow()
+	}
+
+	if ui.texture != nil && resized {
+		ui.texture.Destroy()
+		ui.texture = nil
 	}
 
 	if ui.texture == nil {
-		ui.texture, err = ui.renderer.CreateTexture(sdl.PIXELFORMAT_ARGB8888, sdl.TEXTUREACCESS_STREAMING, WIDTH, HEIGHT)
+		ui.texture, err = ui.renderer.CreateTexture(sdl.PIXELFORMAT_ARGB8888, sdl.TEXTUREACCESS_STREAMING, ui.width, ui.height)
 		if err != nil {
 			panic("failed to create texture: " + err.Error())
 		}
@@ -90,70 +187,133 @@ func (ui *UI) Init() {
 		}
 	}
 
-	if ui.surface == nil {
-		ui.surface, err = sdl.CreateSurface(WIDTH, HEIGHT, sdl.PIXELFORMAT_ARGB8888)
-		if err != nil {
-			panic("failed to create surface: " + err.Error())
+	ui.initVideo()
+	ui.initOSD()
+	ui.updatePresentation()
+
+	ui.pressed = make(map[string]map[inputSource]bool)
+	ui.initKeyBindings()
+	ui.initGamepadBindings()
+}
+
+// initKeyBindings resolves the key names of the key bindings.
+func (ui *UI) initKeyBindings() {
+	ui.keys = make(map[sdl.Keycode]string, len(ui.KeyBindings))
+
+	for name, action := range ui.KeyBindings {
+		key := sdl.GetKeyFromName(name)
+		if key == sdl.K_UNKNOWN {
+			fmt.Fprintln(os.Stderr, "warning: unknown key in key bindings: "+name)
+
+			continue
+		}
+
+		if action != "" {
+			ui.keys[key] = action
 		}
 	}
 }
 
 func (ui *UI) Close() {
-	ui.surface.Destroy()
+	ui.closeGamepads()
+	ui.osd.texture.Destroy()
+
+	if ui.videoTexture != nil {
+		ui.videoTexture.Destroy()
+	}
+
 	ui.texture.Destroy()
 	ui.renderer.Destroy()
 	ui.window.Destroy()
 }
 
+// Step shows the last drawn frame and handles the events, once per host frame.
 func (ui *UI) Step() {
-	ui.drawVRAM()
+	frame := ui.orientedFrame()
+
+	if ui.textureStale {
+		if err := ui.texture.Update(nil, frame, int32(ui.width*PIXEL_BYTES)); err != nil {
+			panic("failed to update texture: " + err.Error())
+		}
+
+		ui.textureStale = false
+	}
+
+	// Effects like persistence work on whole frames
+	if ui.Video != nil && ui.frameDone {
+		if err := ui.videoTexture.Update(nil, ui.Video.Process(frame), int32(ui.Video.Pitch())); err != nil {
+			panic("failed to update video texture: " + err.Error())
+		}
+	}
+
+	ui.frameDone = false
+
+	ui.present(true)
 	ui.handleEvents()
 }
 
-func (ui *UI) drawVRAM() {
-	y := ui.startYDraw
+// DrawHalfFrame draws the next half of the frame from the VRAM, the emulation requests its interrupt.
+// Several half frames can be drawn before the frame is shown, when the emulation runs faster than the host.
+func (ui *UI) DrawHalfFrame() {
+	ui.updateOrientation()
 
-	// Draw half the frame so that the UI requests half and full VBLANK interrupts at the correct CPU timing
-	for y < ui.startYDraw+HEIGHT/2 {
-		row := ui.framebuffer[y*int(ui.surface.Pitch) : y*int(ui.surface.Pitch)+WIDTH*PIXEL_BYTES]
-		for x := range WIDTH {
-			addr := VRAM_START + uint16(x*(HEIGHT/8)) + uint16((HEIGHT-y-1)/8)
-			vramPixels := ui.Bus.Read(addr)
-			vramPixel := (vramPixels >> (7 - y%8)) & 1
-			color := COLOR_BLACK
-
-			if vramPixel == 1 {
-				color = ui.getColor(x, y)
-			}
+	if ui.renderVRAM(ui.startYDraw, ui.startYDraw+HEIGHT/2) {
+		ui.textureStale = true
+	}
 
-			binary.LittleEndian.PutUint32(row[x*PIXEL_BYTES:], color)
-		}
+	ui.startYDraw = (ui.startYDraw + HEIGHT/2) % HEIGHT
+	if ui.startYDraw == 0 {
+		ui.countFrame()
 
-		if y == (HEIGHT/2)-1 && !ui.Paused {
-			ui.CPU.RequestInterrupt(1)
-		}
+		ui.frameDone = true
+	}
+}
 
-		if y == HEIGHT-1 && !ui.Paused {
-			ui.CPU.RequestInterrupt(2)
-		}
+// initVideo creates the texture of the post-processed frames at the output size of the game pipeline.
+func (ui *UI) initVideo() {
+	if ui.videoTexture != nil {
+		ui.videoTexture.Destroy()
+		ui.videoTexture = nil
+	}
 
-		y++
+	if ui.Video == nil {
+		return
 	}
 
-	ui.startYDraw = y % HEIGHT
+	width, height := ui.Video.Size()
+
+	var err error
 
-	if err := ui.texture.Update(nil, ui.framebuffer[:], ui.surface.Pitch); err != nil {
-		panic("failed to update texture: " + err.Error())
+	ui.videoTexture, err = ui.renderer.CreateTexture(sdl.PIXELFORMAT_ARGB8888, sdl.TEXTUREACCESS_STREAMING, width, height)
+	if err != nil {
+		panic("failed to create video texture: " + err.Error())
+	}
+
+	// Scanlines and artwork are drawn at the output resolution, smooth them when the window does not match it
+	if err := ui.videoTexture.SetScaleMode(sdl.SCALEMODE_LINEAR); err != nil {
+		panic("failed to set video texture scale mode: " + err.Error())
 	}
+}
 
+// present renders the game texture unless it is hidden, then the OSD over it.
+func (ui *UI) present(showGame bool) {
 	if err := ui.renderer.Clear(); err != nil {
 		panic("failed to clear renderer: " + err.Error())
 	}
 
-	if err := ui.renderer.RenderTexture(ui.texture, nil, nil); err != nil {
-		panic("failed to render texture: " + err.Error())
+	if showGame {
+		texture := ui.texture
+		if ui.videoTexture != nil {
+			texture = ui.videoTexture
+		}
+
+		if err := ui.renderer.RenderTexture(texture, nil, nil); err != nil {
+			panic("failed to render texture: " + err.Error())
+		}
 	}
 
+	ui.renderOSD()
+
 	if err := ui.renderer.Present(); err != nil {
 		panic("failed to present UI: " + err.Error())
 	}
@@ -165,71 +325,240 @@ func (ui *UI) handleEvents() {
 	for sdl.PollEvent(&event) {
 		switch event.Type {
 		case sdl.EVENT_QUIT, sdl.EVENT_WINDOW_DESTROYED:
-			ui.Arcade.Shutdown()
+			ui.closed = true
+
+			if !ui.inLauncher {
+				ui.Arcade.Shutdown()
+			}
 
 		case sdl.EVENT_KEY_DOWN, sdl.EVENT_KEY_UP:
+			e := event.KeyboardEvent()
 			pressed := event.Type == sdl.EVENT_KEY_DOWN
 
-			switch event.KeyboardEvent().Key {
-			case sdl.K_R: // Reset
-				if !pressed {
-					ui.Arcade.Reset()
-				}
-			case sdl.K_P: // Pause
-				if !pressed {
-					ui.Paused = !ui.Paused
-					ui.APU.TogglePauseAudio(ui.Paused)
-
-					if ui.Paused {
-						fmt.Println("arcade paused")
-					} else {
-						fmt.Println("arcade resumed")
-					}
-				}
-			case sdl.K_9:
-				if !pressed {
-					err := ui.Arcade.LoadState()
-					if err != nil {
-						fmt.Println("failed to save state:", err.Error())
-					}
-				}
-			case sdl.K_0:
-				if !pressed {
-					err := ui.Arcade.SaveState()
-					if err != nil {
-						fmt.Println("failed to save state:", err.Error())
-					}
+			src := inputSource{control: fmt.Sprintf("key %d", e.Key)}
+
+			if ui.menuOpen() {
+				if pressed {
+					ui.handleMenuKey(e.Key)
+				} else {
+					ui.releaseInput(src, ui.keys[e.Key])
 				}
 
-			// Menu
-			case sdl.K_5: // Add coin
-				ui.CPU.SendInput(1, 0, pressed)
-			case sdl.K_1: // Select 1 player
-				ui.CPU.SendInput(1, 2, pressed)
-			case sdl.K_2: // Select 2 players
-				ui.CPU.SendInput(1, 1, pressed)
-
-			// Player controls
-			case sdl.K_LEFT: // Left
-				ui.CPU.SendInput(1, 5, pressed)
-				ui.CPU.SendInput(2, 5, pressed)
-			case sdl.K_RIGHT: // Right
-				ui.CPU.SendInput(1, 6, pressed)
-				ui.CPU.SendInput(2, 6, pressed)
-			case sdl.K_LCTRL: // Shoot
-				ui.CPU.SendInput(1, 4, pressed)
-				ui.CPU.SendInput(2, 4, pressed)
+				continue
+			}
+
+			if action, ok := ui.keys[e.Key]; ok && !e.Repeat {
+				ui.handleAction(src, action, pressed)
 			}
+
+		case sdl.EVENT_GAMEPAD_ADDED:
+			ui.addGamepad(event.GamepadDeviceEvent().Which)
+		case sdl.EVENT_GAMEPAD_REMOVED:
+			ui.removeGamepad(event.GamepadDeviceEvent().Which)
+		case sdl.EVENT_GAMEPAD_BUTTON_DOWN, sdl.EVENT_GAMEPAD_BUTTON_UP:
+			ui.handleGamepadButton(event.GamepadButtonEvent())
+		case sdl.EVENT_GAMEPAD_AXIS_MOTION:
+			ui.handleGamepadAxis(event.GamepadAxisEvent())
 		}
 	}
 }
 
+// handleAction runs emulator actions on release, and forwards logical inputs pressed by a source to their port bit.
+func (ui *UI) handleAction(src inputSource, action string, pressed bool) {
+	switch action {
+	case config.ACTION_MENU:
+		// On press so that the release does not reach the menu
+		if pressed {
+			ui.openMenu()
+		}
+	case config.ACTION_RESET:
+		if !pressed {
+			ui.Arcade.Reset()
+		}
+	case config.ACTION_PAUSE:
+		if !pressed {
+			ui.SetPaused(!ui.Paused)
+
+			if ui.Paused {
+				ui.Notify("arcade paused")
+			} else {
+				ui.Notify("arcade resumed")
+			}
+		}
+	case config.ACTION_LOAD_STATE:
+		if !pressed {
+			err := ui.Arcade.LoadState(ui.saveSlot)
+			if err != nil {
+				ui.Notify("failed to load state: " + err.Error())
+			}
+		}
+	case config.ACTION_SAVE_STATE:
+		if !pressed {
+			err := ui.Arcade.SaveState(ui.saveSlot)
+			if err != nil {
+				ui.Notify("failed to save state: " + err.Error())
+			}
+		}
+	case config.ACTION_SAVE_SLOT:
+		if !pressed {
+			ui.saveSlot = (ui.saveSlot + 1) % SAVE_SLOTS
+			ui.Notify(fmt.Sprintf("save slot %d", ui.saveSlot))
+		}
+	case config.ACTION_FULLSCREEN:
+		if !pressed {
+			ui.setFullscreen(!ui.fullscreen)
+		}
+	case config.ACTION_SPEED_UP, config.ACTION_SPEED_DOWN:
+		if !pressed {
+			delta := 1
+			if action == config.ACTION_SPEED_DOWN {
+				delta = -1
+			}
+
+			ui.Notify(fmt.Sprintf("speed %d%%", ui.Arcade.ChangeSpeed(delta)))
+		}
+	case config.ACTION_FAST_FORWARD:
+		ui.Arcade.FastForward(pressed)
+	case config.ACTION_FRAME_ADVANCE:
+		if !pressed {
+			if !ui.Paused {
+				ui.SetPaused(true)
+			}
+
+			ui.Arcade.AdvanceFrame()
+		}
+	case config.ACTION_TOGGLE_OSD:
+		if !pressed {
+			ui.osdHidden = !ui.osdHidden
+		}
+	case config.ACTION_DIP_SELECT:
+		if !pressed && len(ui.DIPSwitches) > 0 {
+			ui.selectedDIP = (ui.selectedDIP + 1) % len(ui.DIPSwitches)
+			ui.printDIPSwitch()
+		}
+	case config.ACTION_DIP_CHANGE:
+		if !pressed && len(ui.DIPSwitches) > 0 {
+			ui.changeDIPSwitch()
+		}
+	default:
+		ui.holdInput(src, ui.orientInput(action), pressed)
+	}
+}
+
+// inputSource is a key or a gamepad control, the keyboard has no gamepad.
+type inputSource struct {
+	gamepad sdl.JoystickID
+	control string
+}
+
+// holdInput presses a logical input for a source. It is released once every source holding it released it, so
+// that a key and a gamepad button bound to the same input do not release it for each other.
+func (ui *UI) holdInput(src inputSource, action string, pressed bool) {
+	in, ok := ui.Inputs[action]
+	if !ok {
+		return
+	}
+
+	sources := ui.pressed[action]
+
+	if pressed {
+		if len(sources) == 0 {
+			sources = make(map[inputSource]bool)
+			ui.pressed[action] = sources
+
+			ui.CPU.SendInput(in.Port, in.Bit, true)
+		}
+
+		sources[src] = true
+
+		return
+	}
+
+	if !sources[src] {
+		return
+	}
+
+	delete(sources, src)
+
+	if len(sources) == 0 {
+		delete(ui.pressed, action)
+
+		ui.CPU.SendInput(in.Port, in.Bit, false)
+	}
+}
+
+// releaseInput releases a logical input or fast forward while the menu is open, so that they are not stuck
+// when held as it opened.
+func (ui *UI) releaseInput(src inputSource, action string) {
+	if _, ok := ui.Inputs[action]; (ok || action == config.ACTION_FAST_FORWARD) && !ui.inLauncher {
+		ui.handleAction(src, action, false)
+	}
+}
+
+// releaseGamepad releases the inputs held by the controls of a gamepad.
+func (ui *UI) releaseGamepad(id sdl.JoystickID) {
+	for action, sources := range ui.pressed {
+		for src := range sources {
+			if src.gamepad == id {
+				ui.holdInput(src, action, false)
+			}
+		}
+	}
+}
+
+// SetPaused pauses or resumes the game and its sounds.
+func (ui *UI) SetPaused(paused bool) {
+	ui.Paused = paused
+	ui.APU.TogglePauseAudio(paused)
+}
+
+func (ui *UI) setFullscreen(fullscreen bool) {
+	if err := ui.window.SetFullscreen(fullscreen); err != nil {
+		ui.Notify("failed to set fullscreen: " + err.Error())
+
+		return
+	}
+
+	ui.fullscreen = fullscreen
+}
+
+func (ui *UI) printDIPSwitch() {
+	d := ui.DIPSwitches[ui.selectedDIP]
+	ui.Notify(fmt.Sprintf("dip switch %s: %s (%s)", d.Name, ui.Arcade.DIPSwitchSetting(d.Name), strings.Join(d.Labels(), "/")))
+}
+
+// changeDIPSwitch moves the selected DIP switch to its next setting.
+func (ui *UI) changeDIPSwitch() {
+	d := ui.DIPSwitches[ui.selectedDIP]
+	labels := d.Labels()
+	next := labels[(slices.Index(labels, ui.Arcade.DIPSwitchSetting(d.Name))+1)%len(labels)]
+
+	if err := ui.Arcade.SetDIPSwitch(d.Name, next); err != nil {
+		ui.Notify("failed to set dip switch: " + err.Error())
+
+		return
+	}
+
+	ui.printDIPSwitch()
+}
+
+// computeColorLUT rasterizes the overlay image and the rectangle overlays over it into the color of each pixel.
+// Color PROMs take precedence on the rectangle overlays, only the overlay image tints their colors.
 func (ui *UI) computeColorLUT() {
+	overlays := ui.ColorOverlays
+	if len(ui.ColorPROM) > 0 {
+		overlays = nil
+	}
+
 	for x := range WIDTH {
 		for y := range HEIGHT {
 			color := COLOR_WHITE
 
-			for _, cm := range ui.ColorOverlays {
+			if ui.ColorOverlayImage != nil {
+				color = overlayImageColor(ui.ColorOverlayImage, x, y)
+			}
+
+			for _, cm := range overlays {
 				xMatch := (cm.XMin == 0 && cm.XMax == 0) || (x >= int(cm.XMin) && x <= int(cm.XMax))
 
 				yMatch := (cm.YMin == 0 && cm.YMax == 0) || (y >= int(cm.YMin) && y <= int(cm.YMax))
@@ -245,6 +574,23 @@ func (ui *UI) computeColorLUT() {
 	}
 }
 
+// overlayImageColor samples the overlay image at the nearest pixel of a screen pixel, transparent parts leave it white.
+func overlayImageColor(img image.Image, x, y int) uint32 {
+	b := img.Bounds()
+	r, g, bl, a := img.At(b.Min.X+x*b.Dx()/WIDTH, b.Min.Y+y*b.Dy()/HEIGHT).RGBA()
+	// Channels are alpha-premultiplied, add the white showing through
+	channel := func(v uint32) uint32 { return (v + 0xFFFF - a) >> 8 }
+
+	return COLOR_BLACK | channel(r)<<16 | channel(g)<<8 | channel(bl)
+}
+
+// multiplyColor tints a color with an overlay color.
+func multiplyColor(a, b uint32) uint32 {
+	channel := func(shift int) uint32 { return (a >> shift & 0xFF) * (b >> shift & 0xFF) / 0xFF << shift }
+
+	return COLOR_BLACK | channel(16) | channel(8) | channel(0)
+}
+
 func (ui *UI) getColor(x, y int) uint32 {
 	if len(ui.ColorPROM) == 0 {
 		return ui.colors[x][y]
@@ -271,5 +617,10 @@ func (ui *UI) getColor(x, y int) uint32 {
 		g = 0xFF
 	}
 
-	return 0xFF000000 | (r << 16) | (g << 8) | b
+	color := COLOR_BLACK | (r << 16) | (g << 8) | b
+	if ui.ColorOverlayImage == nil {
+		return color
+	}
+
+	return multiplyColor(color, ui.colors[x][y])
 }
@@ -0,0 +1,50 @@
+package ui
+
+import "encoding/binary"
+
+// renderVRAM converts the VRAM bytes of the frame rows from yStart to yEnd that changed since they were last drawn,
+// and reports whether any did. Rows must be aligned on VRAM bytes.
+func (ui *UI) renderVRAM(yStart, yEnd int) bool {
+	half := yStart / (HEIGHT / 2)
+	redraw := ui.redraw[half]
+	ui.redraw[half] = false
+
+	changed := redraw
+
+	// The monitor is rotated: each VRAM row is a frame column, drawn from the bottom
+	for x := range WIDTH {
+		for b := (HEIGHT - yEnd) / 8; b < (HEIGHT-yStart)/8; b++ {
+			addr := VRAM_START + uint16(x*(HEIGHT/8)+b)
+			if !ui.Bus.TakeDirty(addr) && !redraw {
+				continue
+			}
+
+			ui.drawVRAMByte(x, b, ui.Bus.Read(addr))
+
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// drawVRAMByte draws the 8 pixels of a VRAM byte, from the frame bottom for its low bit.
+func (ui *UI) drawVRAMByte(x, b int, pixels uint8) {
+	oriented := ui.screenOrientation != (orientation{})
+
+	for bit := range 8 {
+		y := HEIGHT - 1 - b*8 - bit
+		color := COLOR_BLACK
+
+		if pixels>>bit&1 == 1 {
+			color = ui.getColor(x, y)
+		}
+
+		i := y*WIDTH + x
+		binary.LittleEndian.PutUint32(ui.framebuffer[i*PIXEL_BYTES:], color)
+
+		if oriented {
+			binary.LittleEndian.PutUint32(ui.displayFrame[ui.positions[i]:], color)
+		}
+	}
+}
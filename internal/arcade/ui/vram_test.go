@@ -0,0 +1,86 @@
+package ui
+
+import (
+	"math/rand/v2"
+	"testing"
+
+	"github.com/cterence/goarcade/internal/arcade/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func newVRAMUI() (*UI, *memory.Memory) {
+	m := &memory.Memory{}
+	m.Watch(VRAM_START, VRAM_SIZE)
+
+	ui := &UI{Bus: m}
+	ui.computeColorLUT()
+	ui.redraw = [2]bool{true, true}
+
+	return ui, m
+}
+
+func renderFrame(ui *UI) {
+	ui.renderVRAM(0, HEIGHT/2)
+	ui.renderVRAM(HEIGHT/2, HEIGHT)
+}
+
+func Test_RenderVRAM(t *testing.T) {
+	ui, m := newVRAMUI()
+	renderFrame(ui)
+
+	r := rand.New(rand.NewPCG(1, 2))
+
+	for range 10 {
+		for range 100 {
+			m.Write(VRAM_START+uint16(r.IntN(int(VRAM_SIZE))), uint8(r.UintN(256)))
+		}
+
+		renderFrame(ui)
+
+		// A UI drawing every byte of the same VRAM gives the same frame
+		full := &UI{Bus: m}
+		full.computeColorLUT()
+		full.redraw = [2]bool{true, true}
+		renderFrame(full)
+
+		assert.Equal(t, full.framebuffer, ui.framebuffer)
+	}
+
+	assert.False(t, ui.renderVRAM(0, HEIGHT/2), "a frame without writes has no changes")
+}
+
+func Test_RenderVRAMPixel(t *testing.T) {
+	ui, m := newVRAMUI()
+
+	// Low bit of the first byte is the bottom left pixel of the frame
+	m.Write(VRAM_START, 0x01)
+	renderFrame(ui)
+
+	assert.Equal(t, []uint8{0xFF, 0xFF, 0xFF, 0xFF}, ui.framebuffer[(HEIGHT-1)*WIDTH*PIXEL_BYTES:][:PIXEL_BYTES])
+	assert.Equal(t, []uint8{0x00, 0x00, 0x00, 0xFF}, ui.framebuffer[(HEIGHT-2)*WIDTH*PIXEL_BYTES:][:PIXEL_BYTES])
+}
+
+func BenchmarkRenderVRAM(b *testing.B) {
+	b.Run("static", func(b *testing.B) {
+		ui, _ := newVRAMUI()
+
+		for b.Loop() {
+			renderFrame(ui)
+		}
+	})
+
+	b.Run("busy", func(b *testing.B) {
+		ui, m := newVRAMUI()
+		value := uint8(0)
+
+		for b.Loop() {
+			value++
+
+			for addr := range VRAM_SIZE {
+				m.Write(VRAM_START+addr, value)
+			}
+
+			renderFrame(ui)
+		}
+	})
+}
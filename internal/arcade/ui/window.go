@@ -0,0 +1,138 @@
+package ui
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+
+	"github.com/Zyko0/go-sdl3/sdl"
+	"github.com/cterence/goarcade/internal/arcade/settings"
+)
+
+// createWindow creates the window at its saved placement, or at the scaled screen size when it has none
+// or when a scale is requested.
+func (ui *UI) createWindow() {
+	width, height := ui.windowSize()
+
+	var err error
+
+	ui.window, ui.renderer, err = sdl.CreateWindowAndRenderer("goarcade", width, height, sdl.WINDOW_RESIZABLE)
+	if err != nil {
+		panic("failed to create window and renderer: " + err.Error())
+	}
+
+	if ui.VSync {
+		if err := ui.renderer.SetVSync(1); err != nil {
+			fmt.Fprintln(os.Stderr, "warning: failed to enable vsync: "+err.Error())
+
+			ui.VSync = false
+		}
+	}
+
+	if p := ui.Placement; p.Width > 0 && p.Height > 0 {
+		if err := ui.window.SetPosition(p.X, p.Y); err != nil {
+			panic("failed to set window position: " + err.Error())
+		}
+
+		if ui.Scale == 0 {
+			if err := ui.window.SetSize(ui.portraitSize(p.Width, p.Height)); err != nil {
+				panic("failed to set window size: " + err.Error())
+			}
+		}
+
+		if p.Fullscreen {
+			ui.setFullscreen(true)
+		}
+	}
+}
+
+// resizeWindow fits the window to the scaled screen, when a game turns it.
+func (ui *UI) resizeWindow() {
+	if ui.fullscreen {
+		return
+	}
+
+	width, height := ui.windowSize()
+
+	if err := ui.window.SetSize(int32(width), int32(height)); err != nil {
+		panic("failed to resize window: " + err.Error())
+	}
+}
+
+func (ui *UI) windowSize() (int, int) {
+	width, height := ui.screenSize(ui.width, ui.height)
+	scale := cmp.Or(ui.Scale, SCALE)
+
+	return width * scale, height * scale
+}
+
+// screenSize returns the size of a frame on the monitor, narrowed or widened to the 4:3 aspect in monitor aspect mode.
+func (ui *UI) screenSize(width, height int) (int, int) {
+	if !ui.MonitorAspect {
+		return width, height
+	}
+
+	if width < height {
+		return height * 3 / 4, height
+	}
+
+	return height * 4 / 3, height
+}
+
+// updatePresentation scales the rendered textures to the window with letterboxing. Pixels are scaled by integers
+// unless the screen is shown at the monitor aspect or framed by a bezel.
+func (ui *UI) updatePresentation() {
+	width, height, mode := ui.width, ui.height, sdl.LOGICAL_PRESENTATION_INTEGER_SCALE
+
+	if ui.Video != nil {
+		width, height = ui.Video.Size()
+	}
+
+	switch {
+	case ui.Video != nil && ui.Video.Framed():
+		mode = sdl.LOGICAL_PRESENTATION_LETTERBOX
+	case ui.MonitorAspect:
+		width, height = ui.screenSize(width, height)
+		mode = sdl.LOGICAL_PRESENTATION_LETTERBOX
+	}
+
+	if err := ui.renderer.SetLogicalPresentation(width, height, mode); err != nil {
+		panic("failed to set logical presentation: " + err.Error())
+	}
+}
+
+func (ui *UI) setMonitorAspect(monitorAspect bool) {
+	ui.MonitorAspect = monitorAspect
+	ui.updatePresentation()
+	ui.resizeWindow()
+}
+
+// WindowPlacement returns the current window placement to save it, the saved size is kept while in fullscreen.
+func (ui *UI) WindowPlacement() settings.Window {
+	p := ui.Placement
+	p.Fullscreen = ui.fullscreen
+
+	if ui.window == nil || ui.fullscreen {
+		return p
+	}
+
+	if x, y, err := ui.window.Position(); err == nil {
+		p.X, p.Y = x, y
+	}
+
+	if width, height, err := ui.window.Size(); err == nil {
+		p.Width, p.Height = ui.portraitSize(width, height)
+	}
+
+	return p
+}
+
+// portraitSize turns a window size between a landscape screen and the portrait screen of the game frame, in both
+// directions. Window sizes are saved for a portrait screen so that they fit the games turned to landscape.
+func (ui *UI) portraitSize(width, height int32) (int32, int32) {
+	if ui.width > ui.height {
+		return height, width
+	}
+
+	return width, height
+}
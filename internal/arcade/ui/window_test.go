@@ -0,0 +1,44 @@
+package ui
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_ScreenSize(t *testing.T) {
+	tests := []struct {
+		name          string
+		monitorAspect bool
+		width, height int
+		want          [2]int
+	}{
+		{"square pixels", false, WIDTH, HEIGHT, [2]int{WIDTH, HEIGHT}},
+		{"portrait monitor", true, WIDTH, HEIGHT, [2]int{HEIGHT * 3 / 4, HEIGHT}},
+		{"landscape monitor", true, HEIGHT, WIDTH, [2]int{WIDTH * 4 / 3, WIDTH}},
+		{"artwork", true, 400, 300, [2]int{400, 300}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ui := &UI{MonitorAspect: tt.monitorAspect}
+			width, height := ui.screenSize(tt.width, tt.height)
+
+			assert.Equal(t, tt.want, [2]int{width, height})
+		})
+	}
+}
+
+func Test_PortraitSize(t *testing.T) {
+	ui := &UI{width: WIDTH, height: HEIGHT}
+	width, height := ui.portraitSize(672, 768)
+	assert.Equal(t, [2]int32{672, 768}, [2]int32{width, height})
+
+	// A size saved with a turned screen fits the portrait screens, and back
+	turned := &UI{width: HEIGHT, height: WIDTH}
+	width, height = turned.portraitSize(768, 672)
+	assert.Equal(t, [2]int32{672, 768}, [2]int32{width, height})
+
+	width, height = turned.portraitSize(width, height)
+	assert.Equal(t, [2]int32{768, 672}, [2]int32{width, height})
+}
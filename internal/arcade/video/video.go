@@ -0,0 +1,304 @@
+package video
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/cterence/goarcade/internal/arcade/config"
+)
+
+const (
+	PIXEL_BYTES = 4
+	// Game pixels are scaled so that scanlines have a gap between them
+	SCANLINE_SCALE = 3
+
+	COLOR_BLACK uint32 = 0xFF000000
+)
+
+// Pipeline post-processes game frames on the CPU and composes them with the artwork, in ARGB8888 pixels.
+type Pipeline struct {
+	effects config.Video
+
+	// Game frame size
+	width, height int
+	// Scanlines are the frame rows, columns otherwise
+	horizontal bool
+	// Output frame size, with the position and integer scale of the game screen in it
+	outWidth, outHeight int
+	screenX, screenY    int
+	scale               int
+
+	gammaLUT [256]uint8
+	// Background pixels at the game frame size, nil without background
+	background []uint32
+	// Game frame after persistence, faded into the next frame
+	phosphor []uint32
+	frame    []uint32
+	glow     []uint32
+	out      []uint8
+	// Bezel pixels over the game screen, blended on each frame
+	bezelOver []bezelPixel
+}
+
+type bezelPixel struct {
+	offset int
+	color  color.NRGBA
+}
+
+// Enabled reports whether a video config needs the pipeline.
+func Enabled(v config.Video) bool {
+	return v != config.Video{}
+}
+
+// New creates a pipeline for game frames of width x height pixels, background and bezel may be nil.
+// Without bezel the output is the game frame, scaled when scanlines are enabled.
+// The CRT scanlines are the frame rows when horizontal is set, as on a monitor that is not turned on its side.
+func New(effects config.Video, width, height int, horizontal bool, background, bezel image.Image) (*Pipeline, error) {
+	p := &Pipeline{
+		effects:    effects,
+		width:      width,
+		height:     height,
+		horizontal: horizontal,
+		scale:      1,
+		phosphor:   make([]uint32, width*height),
+		frame:      make([]uint32, width*height),
+		glow:       make([]uint32, width*height),
+	}
+
+	if effects.Scanlines > 0 {
+		p.scale = SCANLINE_SCALE
+	}
+
+	p.outWidth, p.outHeight = width*p.scale, height*p.scale
+
+	if bezel != nil {
+		s := effects.Screen
+		p.outWidth, p.outHeight = bezel.Bounds().Dx(), bezel.Bounds().Dy()
+		p.scale = max(1, min(int(s.Width)/width, int(s.Height)/height))
+		p.screenX = int(s.X) + (int(s.Width)-width*p.scale)/2
+		p.screenY = int(s.Y) + (int(s.Height)-height*p.scale)/2
+
+		if p.screenX < 0 || p.screenY < 0 || p.screenX+width*p.scale > p.outWidth || p.screenY+height*p.scale > p.outHeight {
+			return nil, fmt.Errorf("screen of %dx%d pixels at %d,%d does not fit in the %dx%d bezel", width*p.scale, height*p.scale, p.screenX, p.screenY, p.outWidth, p.outHeight)
+		}
+	}
+
+	p.out = make([]uint8, p.outWidth*p.outHeight*PIXEL_BYTES)
+
+	for i := range p.outWidth * p.outHeight {
+		binary.LittleEndian.PutUint32(p.out[i*PIXEL_BYTES:], COLOR_BLACK)
+	}
+
+	if bezel != nil {
+		p.drawBezel(bezel)
+	}
+
+	if background != nil {
+		p.background = scaleImage(background, width, height)
+	}
+
+	for v := range p.gammaLUT {
+		p.gammaLUT[v] = uint8(v)
+
+		if effects.Gamma > 0 {
+			p.gammaLUT[v] = uint8(math.Round(255 * math.Pow(float64(v)/255, 1/effects.Gamma)))
+		}
+	}
+
+	return p, nil
+}
+
+// Size returns the output frame size.
+func (p *Pipeline) Size() (int, int) {
+	return p.outWidth, p.outHeight
+}
+
+// Framed reports whether the output is a bezel around the game screen.
+func (p *Pipeline) Framed() bool {
+	return p.effects.Bezel != ""
+}
+
+// Pitch returns the length of an output frame row in bytes.
+func (p *Pipeline) Pitch() int {
+	return p.outWidth * PIXEL_BYTES
+}
+
+// Process post-processes a game frame and returns the output frame, which is reused by the next call.
+func (p *Pipeline) Process(gameFrame []uint8) []uint8 {
+	for i := range p.frame {
+		c := binary.LittleEndian.Uint32(gameFrame[i*PIXEL_BYTES:])
+
+		if p.effects.Persistence > 0 {
+			c = maxColor(c, scaleColor(p.phosphor[i], p.effects.Persistence))
+			p.phosphor[i] = c
+		}
+
+		p.frame[i] = c
+	}
+
+	if p.effects.Glow > 0 {
+		p.applyGlow()
+	}
+
+	for i, c := range p.frame {
+		if p.background != nil {
+			c = addColor(c, p.background[i])
+		}
+
+		p.frame[i] = p.gamma(c)
+	}
+
+	p.drawScreen()
+
+	for _, b := range p.bezelOver {
+		game := binary.LittleEndian.Uint32(p.out[b.offset:])
+		binary.LittleEndian.PutUint32(p.out[b.offset:], blend(game, b.color))
+	}
+
+	return p.out
+}
+
+// applyGlow bleeds a part of the 4 neighbors of each pixel on it.
+func (p *Pipeline) applyGlow() {
+	for y := range p.height {
+		for x := range p.width {
+			var neighbors [4]uint32
+
+			if x > 0 {
+				neighbors[0] = p.frame[y*p.width+x-1]
+			}
+
+			if x < p.width-1 {
+				neighbors[1] = p.frame[y*p.width+x+1]
+			}
+
+			if y > 0 {
+				neighbors[2] = p.frame[(y-1)*p.width+x]
+			}
+
+			if y < p.height-1 {
+				neighbors[3] = p.frame[(y+1)*p.width+x]
+			}
+
+			p.glow[y*p.width+x] = addColor(p.frame[y*p.width+x], scaleColor(averageColor(neighbors[:]), p.effects.Glow))
+		}
+	}
+
+	p.frame, p.glow = p.glow, p.frame
+}
+
+// drawScreen scales the game frame into the output, the gap between scanlines is the last output row
+// or column of each game row or column.
+func (p *Pipeline) drawScreen() {
+	gap := 1 - p.effects.Scanlines
+
+	for y := range p.height {
+		for sy := range p.scale {
+			row := p.out[((p.screenY+y*p.scale+sy)*p.outWidth+p.screenX)*PIXEL_BYTES:]
+			rowGap := p.horizontal && p.scale > 1 && sy == p.scale-1
+
+			for x := range p.width {
+				c := p.frame[y*p.width+x]
+				if rowGap {
+					c = scaleColor(c, gap)
+				}
+
+				for sx := range p.scale {
+					if !p.horizontal && p.scale > 1 && sx == p.scale-1 {
+						c = scaleColor(c, gap)
+					}
+
+					binary.LittleEndian.PutUint32(row[(x*p.scale+sx)*PIXEL_BYTES:], c)
+				}
+			}
+		}
+	}
+}
+
+// drawBezel draws the bezel in the output, and keeps its pixels over the game screen to blend them on each frame.
+func (p *Pipeline) drawBezel(bezel image.Image) {
+	b := bezel.Bounds()
+
+	for y := range p.outHeight {
+		for x := range p.outWidth {
+			c := color.NRGBAModel.Convert(bezel.At(b.Min.X+x, b.Min.Y+y)).(color.NRGBA)
+			offset := (y*p.outWidth + x) * PIXEL_BYTES
+
+			inScreen := x >= p.screenX && x < p.screenX+p.width*p.scale && y >= p.screenY && y < p.screenY+p.height*p.scale
+			if inScreen && c.A > 0 {
+				p.bezelOver = append(p.bezelOver, bezelPixel{offset: offset, color: c})
+			}
+
+			binary.LittleEndian.PutUint32(p.out[offset:], blend(COLOR_BLACK, c))
+		}
+	}
+}
+
+func (p *Pipeline) gamma(c uint32) uint32 {
+	return COLOR_BLACK | uint32(p.gammaLUT[c>>16&0xFF])<<16 | uint32(p.gammaLUT[c>>8&0xFF])<<8 | uint32(p.gammaLUT[c&0xFF])
+}
+
+// scaleImage samples an image at the nearest pixels to a width x height frame.
+func scaleImage(img image.Image, width, height int) []uint32 {
+	b := img.Bounds()
+	pixels := make([]uint32, width*height)
+
+	for y := range height {
+		for x := range width {
+			r, g, bl, _ := img.At(b.Min.X+x*b.Dx()/width, b.Min.Y+y*b.Dy()/height).RGBA()
+			pixels[y*width+x] = COLOR_BLACK | (r>>8)<<16 | (g>>8)<<8 | bl>>8
+		}
+	}
+
+	return pixels
+}
+
+// mapChannels applies f to the red, green and blue channels of colors, the result is opaque.
+func mapChannels(a, b uint32, f func(a, b uint32) uint32) uint32 {
+	c := COLOR_BLACK
+
+	for shift := 0; shift < 24; shift += 8 {
+		c |= min(f(a>>shift&0xFF, b>>shift&0xFF), 0xFF) << shift
+	}
+
+	return c
+}
+
+func maxColor(a, b uint32) uint32 {
+	return mapChannels(a, b, func(a, b uint32) uint32 { return max(a, b) })
+}
+
+func addColor(a, b uint32) uint32 {
+	return mapChannels(a, b, func(a, b uint32) uint32 { return a + b })
+}
+
+func scaleColor(c uint32, factor float64) uint32 {
+	f := uint32(factor * 256)
+
+	return mapChannels(c, 0, func(a, _ uint32) uint32 { return a * f >> 8 })
+}
+
+func averageColor(colors []uint32) uint32 {
+	var r, g, b uint32
+
+	for _, c := range colors {
+		r += c >> 16 & 0xFF
+		g += c >> 8 & 0xFF
+		b += c & 0xFF
+	}
+
+	n := uint32(len(colors))
+
+	return COLOR_BLACK | r/n<<16 | g/n<<8 | b/n
+}
+
+// blend draws a non-premultiplied color over an opaque color.
+func blend(under uint32, over color.NRGBA) uint32 {
+	a := uint32(over.A)
+	channel := func(u, o uint32) uint32 { return (o*a + u*(0xFF-a)) / 0xFF }
+
+	return COLOR_BLACK | channel(under>>16&0xFF, uint32(over.R))<<16 | channel(under>>8&0xFF, uint32(over.G))<<8 | channel(under&0xFF, uint32(over.B))
+}
@@ -0,0 +1,70 @@
+package video
+
+import (
+	"encoding/binary"
+	"image"
+	"testing"
+
+	"github.com/cterence/goarcade/internal/arcade/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const COLOR_WHITE uint32 = 0xFFFFFFFF
+
+func frame(colors ...uint32) []uint8 {
+	b := make([]uint8, len(colors)*PIXEL_BYTES)
+	for i, c := range colors {
+		binary.LittleEndian.PutUint32(b[i*PIXEL_BYTES:], c)
+	}
+
+	return b
+}
+
+func pixel(out []uint8, i int) uint32 {
+	return binary.LittleEndian.Uint32(out[i*PIXEL_BYTES:])
+}
+
+func Test_Gamma(t *testing.T) {
+	p, err := New(config.Video{Gamma: 1}, 2, 1, false, nil, nil)
+	require.NoError(t, err)
+
+	out := p.Process(frame(0xFF804020, COLOR_WHITE))
+	assert.Equal(t, frame(0xFF804020, COLOR_WHITE), out)
+}
+
+func Test_Scanlines(t *testing.T) {
+	p, err := New(config.Video{Scanlines: 1}, 1, 1, false, nil, nil)
+	require.NoError(t, err)
+
+	width, height := p.Size()
+	assert.Equal(t, []int{SCANLINE_SCALE, SCANLINE_SCALE}, []int{width, height})
+
+	out := p.Process(frame(COLOR_WHITE))
+
+	for y := range height {
+		assert.Equal(t, COLOR_WHITE, pixel(out, y*width))
+		assert.Equal(t, COLOR_BLACK, pixel(out, y*width+width-1))
+	}
+
+	p, err = New(config.Video{Scanlines: 1}, 1, 1, true, nil, nil)
+	require.NoError(t, err)
+
+	out = p.Process(frame(COLOR_WHITE))
+	assert.Equal(t, COLOR_WHITE, pixel(out, width-1))
+	assert.Equal(t, COLOR_BLACK, pixel(out, (height-1)*width))
+}
+
+func Test_Persistence(t *testing.T) {
+	p, err := New(config.Video{Persistence: 0.5}, 1, 1, false, nil, nil)
+	require.NoError(t, err)
+
+	p.Process(frame(COLOR_WHITE))
+	assert.Equal(t, uint32(0xFF7F7F7F), pixel(p.Process(frame(COLOR_BLACK)), 0))
+	assert.Equal(t, uint32(0xFF3F3F3F), pixel(p.Process(frame(COLOR_BLACK)), 0))
+}
+
+func Test_BezelScreenOutside(t *testing.T) {
+	_, err := New(config.Video{Bezel: "bezel.png", Screen: config.Screen{X: 2, Width: 4, Height: 4}}, 4, 4, false, nil, image.NewNRGBA(image.Rect(0, 0, 4, 4)))
+	assert.ErrorContains(t, err, "does not fit")
+}
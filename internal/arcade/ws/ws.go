@@ -0,0 +1,250 @@
+// Package ws is a minimal server side WebSocket (RFC 6455), without extensions, for the streams of the remote API.
+package ws
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+const (
+	OP_CONTINUATION uint8 = 0x0
+	OP_TEXT         uint8 = 0x1
+	OP_BINARY       uint8 = 0x2
+	OP_CLOSE        uint8 = 0x8
+	OP_PING         uint8 = 0x9
+	OP_PONG         uint8 = 0xA
+
+	// Messages sent by clients are small requests
+	MAX_MESSAGE_SIZE = 1 << 16
+
+	ACCEPT_GUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+var ErrMessageTooBig = errors.New("websocket message too big")
+
+type Conn struct {
+	conn net.Conn
+	r    *bufio.Reader
+
+	// Writes come from the stream and from the replies to pings
+	wmu sync.Mutex
+
+	// The reader and the writer of a stream both close it
+	closeOnce sync.Once
+}
+
+// Upgrade switches an HTTP request to the WebSocket protocol, errors are answered to the client. Browsers send the
+// Origin of the page opening the connection, pages of other sites are rejected so that they cannot drive the
+// server of the player.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") || key == "" {
+		http.Error(w, "websocket upgrade expected", http.StatusBadRequest)
+
+		return nil, errors.New("not a websocket upgrade request")
+	}
+
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+
+		return nil, errors.New("unsupported websocket version")
+	}
+
+	if !SameOrigin(r) {
+		http.Error(w, "websocket origin not allowed", http.StatusForbidden)
+
+		return nil, fmt.Errorf("websocket origin %s is not the host %s", r.Header.Get("Origin"), r.Host)
+	}
+
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("failed to hijack connection: %w", err)
+	}
+
+	sum := sha1.Sum([]byte(key + ACCEPT_GUID))
+
+	if _, err := rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n"); err != nil {
+		return nil, errors.Join(err, conn.Close())
+	}
+
+	if err := rw.Flush(); err != nil {
+		return nil, errors.Join(err, conn.Close())
+	}
+
+	return &Conn{conn: conn, r: rw.Reader}, nil
+}
+
+// SameOrigin reports whether the page sending a request is served by the host, clients which are not browsers
+// send no Origin.
+func SameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for t := range strings.SplitSeq(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// WriteMessage sends a text or binary message in one frame, server frames are not masked.
+func (c *Conn) WriteMessage(op uint8, data []byte) error {
+	header := make([]byte, 2, 10)
+	header[0] = 0x80 | op
+
+	switch n := len(data); {
+	case n < 126:
+		header[1] = uint8(n)
+	case n <= 0xFFFF:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	if _, err := c.conn.Write(header); err != nil {
+		return err
+	}
+
+	_, err := c.conn.Write(data)
+
+	return err
+}
+
+// ReadMessage returns the next text or binary message, answering pings on the way. It returns io.EOF once the
+// client closed the connection.
+func (c *Conn) ReadMessage() (uint8, []byte, error) {
+	var (
+		op      uint8
+		message []byte
+	)
+
+	for {
+		fin, frameOp, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch frameOp {
+		case OP_PING:
+			if err := c.WriteMessage(OP_PONG, payload); err != nil {
+				return 0, nil, err
+			}
+
+			continue
+		case OP_PONG:
+			continue
+		case OP_CLOSE:
+			_ = c.WriteMessage(OP_CLOSE, nil)
+
+			return 0, nil, io.EOF
+		case OP_CONTINUATION:
+			if op == 0 {
+				return 0, nil, errors.New("websocket continuation without a message")
+			}
+		default:
+			op = frameOp
+		}
+
+		if len(message)+len(payload) > MAX_MESSAGE_SIZE {
+			return 0, nil, ErrMessageTooBig
+		}
+
+		message = append(message, payload...)
+
+		if fin {
+			return op, message, nil
+		}
+	}
+}
+
+// readFrame reads a frame, client frames are masked.
+func (c *Conn) readFrame() (bool, uint8, []byte, error) {
+	var header [2]byte
+
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin, op := header[0]&0x80 != 0, header[0]&0x0F
+	masked, length := header[1]&0x80 != 0, uint64(header[1]&0x7F)
+
+	switch length {
+	case 126:
+		var b [2]byte
+		if _, err := io.ReadFull(c.r, b[:]); err != nil {
+			return false, 0, nil, err
+		}
+
+		length = uint64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		if _, err := io.ReadFull(c.r, b[:]); err != nil {
+			return false, 0, nil, err
+		}
+
+		length = binary.BigEndian.Uint64(b[:])
+	}
+
+	if length > MAX_MESSAGE_SIZE {
+		return false, 0, nil, ErrMessageTooBig
+	}
+
+	if !masked {
+		return false, 0, nil, errors.New("websocket client frame is not masked")
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.r, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return false, 0, nil, err
+	}
+
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return fin, op, payload, nil
+}
+
+// Close closes the connection, closing it again does nothing.
+func (c *Conn) Close() error {
+	var err error
+
+	c.closeOnce.Do(func() { err = c.conn.Close() })
+
+	return err
+}
@@ -0,0 +1,190 @@
+package ws
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// client is the other end of a connection, it masks its frames like browsers do.
+type client struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// dial opens a WebSocket to url, with extra request header lines.
+func dial(t *testing.T, url string, headers ...string) (*client, *http.Response) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	require.NoError(t, err)
+
+	t.Cleanup(func() { conn.Close() })
+
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: test\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n"+strings.Join(headers, "")+"\r\n")
+	require.NoError(t, err)
+
+	r := bufio.NewReader(conn)
+
+	res, err := http.ReadResponse(r, nil)
+	require.NoError(t, err)
+
+	return &client{conn: conn, r: r}, res
+}
+
+func (c *client) write(t *testing.T, fin bool, op uint8, data []byte) {
+	mask := [4]byte{1, 2, 3, 4}
+	frame := []byte{op, 0x80 | uint8(len(data))}
+
+	if fin {
+		frame[0] |= 0x80
+	}
+
+	frame = append(frame, mask[:]...)
+	for i, b := range data {
+		frame = append(frame, b^mask[i%4])
+	}
+
+	_, err := c.conn.Write(frame)
+	require.NoError(t, err)
+}
+
+func (c *client) read(t *testing.T) (uint8, []byte) {
+	var header [2]byte
+
+	_, err := io.ReadFull(c.r, header[:])
+	require.NoError(t, err)
+
+	length := int(header[1] & 0x7F)
+
+	if length == 126 {
+		var b [2]byte
+
+		_, err := io.ReadFull(c.r, b[:])
+		require.NoError(t, err)
+
+		length = int(binary.BigEndian.Uint16(b[:]))
+	}
+
+	data := make([]byte, length)
+
+	_, err = io.ReadFull(c.r, data)
+	require.NoError(t, err)
+
+	return header[0] & 0x0F, data
+}
+
+func Test_Conn(t *testing.T) {
+	errs := make(chan error, 1)
+
+	// Echoes the messages until the client closes the connection
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r)
+		if err != nil {
+			errs <- err
+
+			return
+		}
+		defer conn.Close()
+
+		for {
+			op, data, err := conn.ReadMessage()
+			if err != nil {
+				errs <- err
+
+				return
+			}
+
+			if err := conn.WriteMessage(op, data); err != nil {
+				errs <- err
+
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+
+	c, res := dial(t, srv.URL)
+
+	assert.Equal(t, http.StatusSwitchingProtocols, res.StatusCode)
+	// Example of the RFC
+	assert.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", res.Header.Get("Sec-WebSocket-Accept"))
+
+	t.Run("messages are echoed", func(t *testing.T) {
+		c.write(t, true, OP_TEXT, []byte("hello"))
+
+		op, data := c.read(t)
+		assert.Equal(t, OP_TEXT, op)
+		assert.Equal(t, "hello", string(data))
+
+		payload := []byte(strings.Repeat("x", 100))
+		c.write(t, true, OP_BINARY, payload)
+
+		op, data = c.read(t)
+		assert.Equal(t, OP_BINARY, op)
+		assert.Equal(t, payload, data)
+	})
+
+	t.Run("fragments are joined and pings answered", func(t *testing.T) {
+		c.write(t, false, OP_TEXT, []byte("hel"))
+		c.write(t, true, OP_PING, []byte("ping"))
+		c.write(t, true, OP_CONTINUATION, []byte("lo"))
+
+		op, data := c.read(t)
+		assert.Equal(t, OP_PONG, op)
+		assert.Equal(t, "ping", string(data))
+
+		op, data = c.read(t)
+		assert.Equal(t, OP_TEXT, op)
+		assert.Equal(t, "hello", string(data))
+	})
+
+	t.Run("close is answered", func(t *testing.T) {
+		c.write(t, true, OP_CLOSE, nil)
+
+		op, _ := c.read(t)
+		assert.Equal(t, OP_CLOSE, op)
+		assert.Equal(t, io.EOF, <-errs)
+	})
+}
+
+func Test_Upgrade(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = Upgrade(w, r)
+	}))
+	defer srv.Close()
+
+	t.Run("not an upgrade", func(t *testing.T) {
+		res, err := http.Get(srv.URL)
+		require.NoError(t, err)
+
+		defer res.Body.Close()
+
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("origin", func(t *testing.T) {
+		tests := []struct {
+			origin string
+			want   int
+		}{
+			{"Origin: http://test\r\n", http.StatusSwitchingProtocols},
+			{"Origin: http://TEST\r\n", http.StatusSwitchingProtocols},
+			{"Origin: http://evil.example\r\n", http.StatusForbidden},
+			{"Origin: http://test:8080\r\n", http.StatusForbidden},
+			{"", http.StatusSwitchingProtocols},
+		}
+
+		for _, tt := range tests {
+			_, res := dial(t, srv.URL, tt.origin)
+			assert.Equal(t, tt.want, res.StatusCode, tt.origin)
+		}
+	})
+}
@@ -0,0 +1,63 @@
+// Package gametest builds the game archives and configs used by the tests.
+package gametest
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Archive returns a .zip archive of the files, by name.
+func Archive(t testing.TB, files map[string][]uint8) []uint8 {
+	t.Helper()
+
+	var buf bytes.Buffer
+
+	w := zip.NewWriter(&buf)
+
+	for name, content := range files {
+		f, err := w.Create(name)
+		require.NoError(t, err)
+
+		_, err = f.Write(content)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, w.Close())
+
+	return buf.Bytes()
+}
+
+// Game returns the archive and the config of a game named "game" with the program as its only ROM part, loaded
+// at 0. The spec is added to its game spec, written without indentation.
+func Game(t testing.TB, program []uint8, spec string) ([]uint8, []uint8) {
+	t.Helper()
+
+	config := fmt.Sprintf("gameSpecs:\n  game:\n    romParts:\n      - fileName: a\n        startAddr: 0x0\n        expectedSize: %#x\n", len(program))
+
+	for line := range strings.Lines(spec) {
+		config += "    " + line
+	}
+
+	return Archive(t, map[string][]uint8{"a": program}), []uint8(config)
+}
+
+// InputsProgram adds the input ports to RAM in a loop, so that the state of the machine depends on the inputs
+// of every frame.
+var InputsProgram = []uint8{
+	0xDB, 0x01, // in 1
+	0x47,             // mov b,a
+	0x3A, 0x00, 0x20, // lda 2000h
+	0x80,             // add b
+	0x32, 0x00, 0x20, // sta 2000h
+	0xDB, 0x02, // in 2
+	0x47,             // mov b,a
+	0x3A, 0x01, 0x20, // lda 2001h
+	0x80,             // add b
+	0x32, 0x01, 0x20, // sta 2001h
+	0xC3, 0x00, 0x00, // jmp 0000h
+}
@@ -0,0 +1,101 @@
+package machine
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/cterence/goarcade/internal/arcade/config"
+)
+
+// initDIPSwitches sets every DIP switch to its default, then to the settings of the options (name=label).
+func (m *Machine) initDIPSwitches(dips []config.DIPSwitch) error {
+	m.dipSwitches = dips
+	m.dipSettings = make(map[string]string, len(dips))
+
+	for _, d := range dips {
+		m.dipSettings[d.Name] = d.DefaultSetting().Label
+	}
+
+	for _, arg := range m.dipArgs {
+		name, label, err := parseDIPSetting(arg)
+		if err != nil {
+			return err
+		}
+
+		if err := m.SetDIPSwitch(name, label); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func parseDIPSetting(arg string) (string, string, error) {
+	name, label, ok := strings.Cut(arg, "=")
+	if !ok {
+		return "", "", fmt.Errorf("invalid dip switch setting %q, expected name=setting", arg)
+	}
+
+	return name, label, nil
+}
+
+// DIPSwitch is a DIP switch of a game, set to one of its labeled settings.
+type DIPSwitch struct {
+	Name     string
+	Default  string
+	Settings []string
+}
+
+// DIPSwitches returns the DIP switches of the loaded game.
+func (m *Machine) DIPSwitches() []DIPSwitch {
+	dips := make([]DIPSwitch, len(m.dipSwitches))
+	for i, d := range m.dipSwitches {
+		dips[i] = DIPSwitch{Name: d.Name, Default: d.DefaultSetting().Label, Settings: d.Labels()}
+	}
+
+	return dips
+}
+
+// DIPSwitchSetting returns the label of the current setting of a DIP switch.
+func (m *Machine) DIPSwitchSetting(name string) string {
+	return m.dipSettings[name]
+}
+
+// SetDIPSwitch changes a DIP switch setting, it is applied right away and on every reset.
+func (m *Machine) SetDIPSwitch(name, label string) error {
+	i := slices.IndexFunc(m.dipSwitches, func(d config.DIPSwitch) bool { return d.Name == name })
+	if i == -1 {
+		names := make([]string, len(m.dipSwitches))
+		for i, d := range m.dipSwitches {
+			names[i] = d.Name
+		}
+
+		return fmt.Errorf("unknown dip switch %s, available: %s", name, strings.Join(names, ", "))
+	}
+
+	d := m.dipSwitches[i]
+
+	if _, ok := d.Setting(label); !ok {
+		return fmt.Errorf("unknown setting %s for dip switch %s, available: %s", label, name, strings.Join(d.Labels(), ", "))
+	}
+
+	m.dipSettings[name] = label
+	m.applyDIPSwitch(d)
+
+	return nil
+}
+
+func (m *Machine) applyDIPSwitches() {
+	for _, d := range m.dipSwitches {
+		m.applyDIPSwitch(d)
+	}
+}
+
+func (m *Machine) applyDIPSwitch(d config.DIPSwitch) {
+	setting, _ := d.Setting(m.dipSettings[d.Name])
+
+	for i, bit := range d.Bits {
+		m.cpu.SendInput(d.Port, bit, setting.Value>>i&1 == 1)
+	}
+}
@@ -0,0 +1,49 @@
+package machine
+
+import "github.com/cterence/goarcade/internal/arcade/config"
+
+// RAMValue is a number stored by a game in RAM, little endian like the 8080.
+type RAMValue struct {
+	Addr uint16
+	// Bytes of the value, 1 when unset
+	Size uint8
+	// Binary coded decimal digits, like the scores of most games
+	BCD bool
+}
+
+// Env describes a game for learning environments: where its score and lives are, and how to start and play a game.
+type Env struct {
+	Score *RAMValue
+	Lives *RAMValue
+	// Non-zero while a game is played, zero in attract mode and once the game is over
+	Playing *RAMValue
+	// Inputs pressed in turn to start a game
+	Start []string
+	// Inputs pressed by each action
+	Actions [][]string
+}
+
+// newEnv returns the env definition of a game spec with its defaults, nil when it has none.
+func newEnv(s *config.GameSpec) *Env {
+	if s.Env == nil {
+		return nil
+	}
+
+	return &Env{
+		Score:   ramValue(s.Env.Score),
+		Lives:   ramValue(s.Env.Lives),
+		Playing: ramValue(s.Env.Playing),
+		Start:   s.EnvStart(),
+		Actions: s.EnvActions(),
+	}
+}
+
+func ramValue(v *config.RAMValue) *RAMValue {
+	if v == nil {
+		return nil
+	}
+
+	r := RAMValue(*v)
+
+	return &r
+}
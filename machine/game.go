@@ -0,0 +1,99 @@
+package machine
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/cterence/goarcade/internal/arcade/config"
+	"github.com/cterence/goarcade/internal/arcade/romset"
+)
+
+// Game is a game archive with its spec resolved from the config, it can be loaded by many machines at once.
+type Game struct {
+	Name string
+	// Set when the game was identified by the archive content and not by its name
+	Identified bool
+	// Learning environment definition of the game, nil when it has none
+	Env *Env
+
+	spec *config.GameSpec
+	set  *romset.Set
+}
+
+// OpenGame opens a zip archive read from romPath and finds its game name and spec, by archive name first
+// then by archive content. The archives of the game ancestors are searched next to it for missing files.
+func OpenGame(romBytes, configBytes []uint8, romPath string) (*Game, error) {
+	set, err := romset.Open(romBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := config.ParseConfig(configBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &Game{Name: strings.TrimSuffix(filepath.Base(romPath), filepath.Ext(romPath)), set: set}
+	romDir := filepath.Dir(romPath)
+
+	// Clones are identified with the files of their parent archives
+	if _, ok := c.GameSpecs[g.Name]; !ok {
+		g.Name, err = romset.Identify(c, set, romDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to identify %s: %w", romPath, err)
+		}
+
+		g.Identified = true
+	}
+
+	g.spec, err = c.GameSpec(g.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	g.Env = newEnv(g.spec)
+
+	if err := set.AddParentArchives(c, g.Name, romDir); err != nil {
+		return nil, err
+	}
+
+	return g, nil
+}
+
+// readFile returns the verified content of a file of the game or of its ancestors.
+func (g *Game) readFile(f config.ROMFile) ([]uint8, error) {
+	return g.set.ReadFile(f)
+}
+
+// ROM returns the ROM parts of the game, concatenated in address order.
+func (g *Game) ROM() ([]uint8, error) {
+	var rom []uint8
+
+	for _, p := range g.spec.ROMParts {
+		b, err := g.readFile(p.ROMFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load rom part: %w", err)
+		}
+
+		rom = append(rom, b...)
+	}
+
+	return rom, nil
+}
+
+// ColorPROM returns the color PROMs of the game, concatenated.
+func (g *Game) ColorPROM() ([]uint8, error) {
+	var prom []uint8
+
+	for _, p := range g.spec.ColorPROMs {
+		b, err := g.readFile(p.ROMFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load color prom: %w", err)
+		}
+
+		prom = append(prom, b...)
+	}
+
+	return prom, nil
+}
@@ -0,0 +1,57 @@
+package machine
+
+import (
+	"testing"
+
+	"github.com/cterence/goarcade/internal/gametest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const gameSpec = `dipSwitches:
+  - name: lives
+    port: 2
+    bits: [0, 1]
+    default: "3"
+    settings:
+      - { label: "3", value: 0 }
+      - { label: "4", value: 1 }
+env:
+  score: { addr: 0x2400, bcd: true }
+  playing: { addr: 0x2401, size: 2 }
+`
+
+func newGame(t *testing.T) *Game {
+	archive, config := gametest.Game(t, program, gameSpec)
+
+	g, err := OpenGame(archive, config, "game.zip")
+	require.NoError(t, err)
+
+	return g
+}
+
+func Test_Game(t *testing.T) {
+	g := newGame(t)
+
+	assert.Equal(t, "game", g.Name)
+	assert.False(t, g.Identified)
+	assert.Equal(t, &Env{
+		Score:   &RAMValue{Addr: 0x2400, BCD: true},
+		Playing: &RAMValue{Addr: 0x2401, Size: 2},
+		Start:   []string{"coin", "p1_start"},
+		Actions: [][]string{{}, {"p1_fire"}, {"p1_left"}, {"p1_right"}},
+	}, g.Env)
+
+	m := New(WithDIPSwitches([]string{"lives=4"}))
+	require.NoError(t, m.LoadGame(g))
+
+	assert.Equal(t, Input{Port: 1, Bit: 4}, m.Inputs()["p1_fire"])
+	assert.Equal(t, []DIPSwitch{{Name: "lives", Default: "3", Settings: []string{"3", "4"}}}, m.DIPSwitches())
+	assert.Equal(t, "4", m.DIPSwitchSetting("lives"))
+
+	m.RunCycles(50)
+
+	assert.Equal(t, 0xFF, m.ReadValue(RAMValue{Addr: 0x2400}))
+	assert.Equal(t, 165, m.ReadValue(*g.Env.Score), "0xff is not decimal, its digits add up")
+	assert.Equal(t, 0, m.ReadValue(*g.Env.Playing))
+}
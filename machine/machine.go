@@ -0,0 +1,541 @@
+// Package machine emulates the Midway 8080 arcade board, its CPU, memory and I/O ports, without UI or audio device,
+// so that tools can load games, run them and read their screen and sounds.
+package machine
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/cterence/goarcade/internal/arcade/config"
+	"github.com/cterence/goarcade/internal/arcade/cpu"
+	"github.com/cterence/goarcade/internal/arcade/memory"
+)
+
+const (
+	// The 19.968MHz crystal of the Midway 8080 boards is divided by 10 for the CPU, and by 4 for the pixel clock
+	// which scans 262 lines of 320 pixels per frame
+	CPU_TPS           = 1_996_800
+	CPU_TPS_PER_FRAME = 320 * 262 * 4 / 10
+	FPS               = float64(CPU_TPS) / CPU_TPS_PER_FRAME
+
+	// RAM of the board, the work RAM of the game followed by the video RAM
+	RAM_START  uint16 = 0x2000
+	RAM_SIZE   uint16 = VRAM_START + VRAM_SIZE - RAM_START
+	VRAM_START uint16 = 0x2400
+	VRAM_SIZE  uint16 = 0x1C00
+
+	// Screen size on the vertical monitor of the cabinets
+	WIDTH  = 224
+	HEIGHT = 256
+
+	// Start address of the programs in CP/M compatibility mode
+	CPM_START = 0x100
+	// Audio events kept when they are not read, the oldest are dropped
+	MAX_AUDIO_EVENTS = 1024
+)
+
+// SoundAction is what a game does to a sound through its sound ports.
+type SoundAction uint8
+
+const (
+	SOUND_PLAY SoundAction = iota
+	SOUND_LOOP_START
+	SOUND_LOOP_STOP
+)
+
+// AudioEvent is a sound started or stopped by the game, sounds are numbered like the WAV files of the sound directory.
+type AudioEvent struct {
+	Action SoundAction
+	Sound  uint8
+	// CPU cycles run since the reset when the game wrote the sound port
+	Cycle uint64
+}
+
+type Machine struct {
+	cpu    *cpu.CPU
+	memory *memory.Memory
+	audio  audioEvents
+
+	// Loaded game, or program when nil
+	game    *Game
+	program []uint8
+	path    string
+
+	cpuOpts []cpu.Option
+	cpm     bool
+
+	dipArgs     []string
+	dipSwitches []config.DIPSwitch
+	dipSettings map[string]string
+
+	// Cycles run in the current half frame, whose end requests interrupt half+1
+	cycles int
+	half   uint8
+
+	frame *image.Gray
+}
+
+// Snapshot is an in-memory copy of the machine state, much faster to take and restore than a save state,
+// for rollbacks. Snapshots can be reused.
+type Snapshot struct {
+	cpu    cpu.Snapshot
+	memory memory.Snapshot
+	cycles int
+	half   uint8
+}
+
+type Option func(*Machine)
+
+// WithDebug prints every instruction run by the CPU.
+func WithDebug(debug bool) Option {
+	return func(m *Machine) {
+		m.cpuOpts = append(m.cpuOpts, cpu.WithDebug(debug))
+	}
+}
+
+// WithOutput writes the console output of CP/M programs to w instead of stdout.
+func WithOutput(w io.Writer) Option {
+	return func(m *Machine) {
+		m.cpuOpts = append(m.cpuOpts, cpu.WithOutput(w))
+	}
+}
+
+// WithLog writes the debug traces and warnings of the CPU to w instead of stdout.
+func WithLog(w io.Writer) Option {
+	return func(m *Machine) {
+		m.cpuOpts = append(m.cpuOpts, cpu.WithLog(w))
+	}
+}
+
+// WithCPM runs programs like CP/M, for the CPU tests: they start at CPM_START, print with the BDOS calls
+// and stop the CPU when they exit. There are no video interrupts.
+func WithCPM(cpm bool) Option {
+	return func(m *Machine) {
+		m.cpm = cpm
+	}
+}
+
+// WithDIPSwitches overrides the DIP switch defaults of the games with name=setting values.
+func WithDIPSwitches(dips []string) Option {
+	return func(m *Machine) {
+		m.dipArgs = dips
+	}
+}
+
+func New(options ...Option) *Machine {
+	m := &Machine{
+		cpu:    &cpu.CPU{},
+		memory: &memory.Memory{},
+		frame:  image.NewGray(image.Rect(0, 0, WIDTH, HEIGHT)),
+	}
+
+	m.audio.cpu = m.cpu
+	m.cpu.Bus = m.memory
+	m.cpu.APU = &m.audio
+
+	for _, o := range options {
+		o(m)
+	}
+
+	m.memory.Watch(VRAM_START, VRAM_SIZE)
+
+	return m
+}
+
+// Load resets the machine with a game .zip archive read from romPath, or with a program loaded at address 0.
+func (m *Machine) Load(romBytes, configBytes []uint8, romPath string) error {
+	if len(romBytes) == 0 {
+		return errors.New("no rom passed to emulator")
+	}
+
+	m.path = romPath
+
+	if filepath.Ext(romPath) != ".zip" {
+		return m.LoadProgram(romBytes)
+	}
+
+	g, err := OpenGame(romBytes, configBytes, romPath)
+	if err != nil {
+		return err
+	}
+
+	return m.LoadGame(g)
+}
+
+// LoadGame resets the machine with the ROM parts and the inputs of a game.
+func (m *Machine) LoadGame(g *Game) error {
+	m.game = g
+	m.cpu.InPorts = g.spec.InPorts
+	m.cpu.Inputs = g.spec.Inputs
+
+	if err := m.initDIPSwitches(g.spec.DIPSwitches); err != nil {
+		return err
+	}
+
+	m.clearMemory()
+	m.Reset()
+
+	for _, p := range g.spec.ROMParts {
+		b, err := g.readFile(p.ROMFile)
+		if err != nil {
+			return fmt.Errorf("failed to load rom part: %w", err)
+		}
+
+		m.writeBytes(p.StartAddr, b)
+	}
+
+	return nil
+}
+
+// LoadProgram resets the machine with a program, loaded at address 0 or at CPM_START in CP/M mode.
+// Programs have the default inputs and no DIP switches, setting some in the options is an error.
+func (m *Machine) LoadProgram(program []uint8) error {
+	if len(m.dipArgs) > 0 {
+		return fmt.Errorf("dip switch settings %s cannot be applied, programs have no dip switches", strings.Join(m.dipArgs, ", "))
+	}
+
+	start := uint16(0)
+	if m.cpm {
+		start = CPM_START
+	}
+
+	if len(program) > int(memory.MEMORY_SIZE)-int(start) {
+		return fmt.Errorf("program of %d bytes does not fit in memory", len(program))
+	}
+
+	m.game = nil
+	m.program = program
+	m.cpu.InPorts = nil
+	m.cpu.Inputs = config.DefaultInputs
+	m.dipSwitches = nil
+	m.dipSettings = nil
+
+	m.clearMemory()
+	m.Reset()
+	m.writeBytes(start, program)
+
+	if m.cpm {
+		// inject "out 0,a" at 0x0000 (signal to stop the test)
+		m.memory.Write(0x0000, 0xD3)
+		m.memory.Write(0x0001, 0x00)
+
+		// inject "out 1,a" at 0x0005 (signal to output some characters)
+		m.memory.Write(0x0005, 0xD3)
+		m.memory.Write(0x0006, 0x01)
+		m.memory.Write(0x0007, 0xC9)
+	}
+
+	return nil
+}
+
+// PowerOn reloads the game or program with cleared memory, like a cabinet switched off and on.
+func (m *Machine) PowerOn() error {
+	if m.game != nil {
+		return m.LoadGame(m.game)
+	}
+
+	if m.program == nil {
+		return errors.New("no game or program loaded")
+	}
+
+	return m.LoadProgram(m.program)
+}
+
+// Reset restarts the CPU with the DIP switch settings, the memory is kept like on the hardware.
+func (m *Machine) Reset() {
+	pc := uint16(0)
+	if m.cpm {
+		pc = CPM_START
+	}
+
+	m.cpu.Init(pc, m.cpuOpts...)
+	m.applyDIPSwitches()
+
+	m.cycles = 0
+	m.half = 0
+	m.audio.events = nil
+}
+
+// Game returns the loaded game, nil for programs.
+func (m *Machine) Game() *Game {
+	return m.game
+}
+
+// Path returns the path of the loaded ROM.
+func (m *Machine) Path() string {
+	return m.path
+}
+
+// Running reports whether the CPU runs, programs stop it in CP/M mode when they exit.
+func (m *Machine) Running() bool {
+	return m.cpu.Running
+}
+
+// Cycles returns the CPU cycles run since the reset.
+func (m *Machine) Cycles() uint64 {
+	return m.cpu.Cyc
+}
+
+// Step runs an instruction and returns its cycles. The video interrupt of a half frame is requested
+// by the instruction which ends it.
+func (m *Machine) Step() int {
+	cycles := int(m.cpu.Step())
+
+	m.cycles += cycles
+	if m.cycles >= CPU_TPS_PER_FRAME/2 {
+		m.cycles -= CPU_TPS_PER_FRAME / 2
+
+		if !m.cpm {
+			m.cpu.RequestInterrupt(m.half + 1)
+		}
+
+		m.half ^= 1
+	}
+
+	return cycles
+}
+
+// RunCycles runs instructions for at least the given cycles, or until the CPU stops, and returns the cycles run.
+func (m *Machine) RunCycles(cycles int) int {
+	run := 0
+
+	for m.cpu.Running && run < cycles {
+		run += m.Step()
+	}
+
+	return run
+}
+
+// RunHalfFrame runs until the end of the current half frame, which requests its video interrupt.
+func (m *Machine) RunHalfFrame() {
+	for half := m.half; m.cpu.Running && m.half == half; {
+		m.Step()
+	}
+}
+
+// RunFrame runs until the end of the current frame.
+func (m *Machine) RunFrame() {
+	m.RunHalfFrame()
+
+	if m.half == 1 {
+		m.RunHalfFrame()
+	}
+}
+
+// Half returns the half frame running, 0 for the first half.
+func (m *Machine) Half() uint8 {
+	return m.half
+}
+
+// Input is a logical input of a game, a bit of an input port.
+type Input struct {
+	Port uint8
+	Bit  uint8
+}
+
+// Inputs returns the logical inputs of the loaded game by name, like p1_fire.
+func (m *Machine) Inputs() map[string]Input {
+	inputs := make(map[string]Input, len(m.cpu.Inputs))
+	for name, in := range m.cpu.Inputs {
+		inputs[name] = Input{Port: in.Port, Bit: in.Bit}
+	}
+
+	return inputs
+}
+
+// SetInput presses or releases a logical input.
+func (m *Machine) SetInput(name string, pressed bool) error {
+	in, ok := m.cpu.Inputs[name]
+	if !ok {
+		return fmt.Errorf("unknown input %s", name)
+	}
+
+	m.cpu.SendInput(in.Port, in.Bit, pressed)
+
+	return nil
+}
+
+// Pressed reports whether a logical input is pressed.
+func (m *Machine) Pressed(name string) bool {
+	in, ok := m.cpu.Inputs[name]
+
+	return ok && m.cpu.InputActive(in.Port, in.Bit)
+}
+
+// SendInput sets the level of an input port bit from the state of its input, active low bits are inverted.
+func (m *Machine) SendInput(port, bit uint8, active bool) {
+	m.cpu.SendInput(port, bit, active)
+}
+
+// ReadPort returns the latch of an I/O port, last written by the game or set by inputs.
+func (m *Machine) ReadPort(port uint8) uint8 {
+	return m.cpu.ReadPort(port)
+}
+
+// ReadValue returns a number stored by the game in RAM, like its score.
+func (m *Machine) ReadValue(v RAMValue) int {
+	c := config.RAMValue(v)
+
+	b := make([]uint8, c.Bytes())
+	for i := range b {
+		b[i] = m.memory.Read(c.Addr + uint16(i))
+	}
+
+	return c.Decode(b)
+}
+
+func (m *Machine) Read(addr uint16) uint8 {
+	return m.memory.Read(addr)
+}
+
+func (m *Machine) Write(addr uint16, value uint8) {
+	m.memory.Write(addr, value)
+}
+
+// TakeDirty reports whether a video RAM byte changed since the last call for it, for renderers
+// which only convert the changed bytes.
+func (m *Machine) TakeDirty(addr uint16) bool {
+	return m.memory.TakeDirty(addr)
+}
+
+// Frame draws the screen upright as on the vertical monitor of the cabinets, lit pixels are white.
+// The image is reused by the next call.
+func (m *Machine) Frame() *image.Gray {
+	// The monitor is rotated: each VRAM row is a screen column, drawn from the bottom
+	for x := range WIDTH {
+		for b := range HEIGHT / 8 {
+			pixels := m.memory.Read(VRAM_START + uint16(x*(HEIGHT/8)+b))
+
+			for bit := range 8 {
+				y := HEIGHT - 1 - b*8 - bit
+				m.frame.Pix[y*m.frame.Stride+x] = 0xFF * (pixels >> bit & 1)
+			}
+		}
+	}
+
+	return m.frame
+}
+
+// AudioEvents returns the sounds started and stopped since the last call.
+func (m *Machine) AudioEvents() []AudioEvent {
+	events := m.audio.events
+	m.audio.events = nil
+
+	return events
+}
+
+type state struct {
+	CPU    []uint8
+	Memory []uint8
+	// Position in the frame, missing from the states of older versions
+	Cycles int
+	Half   uint8
+}
+
+// SaveState writes the CPU, memory and frame position, DIP switch settings are not part of it.
+func (m *Machine) SaveState(w io.Writer) error {
+	cpu, err := m.cpu.SaveState()
+	if err != nil {
+		return err
+	}
+
+	s := state{
+		CPU:    cpu,
+		Memory: make([]uint8, memory.MEMORY_SIZE),
+		Cycles: m.cycles,
+		Half:   m.half,
+	}
+
+	for addr := range s.Memory {
+		s.Memory[addr] = m.memory.Read(uint16(addr))
+	}
+
+	if err := gob.NewEncoder(w).Encode(s); err != nil {
+		return fmt.Errorf("failed to encode save state: %w", err)
+	}
+
+	return nil
+}
+
+// LoadState reads a state written by SaveState, the current DIP switch settings are kept over the saved ones.
+func (m *Machine) LoadState(r io.Reader) error {
+	var s state
+
+	if err := gob.NewDecoder(r).Decode(&s); err != nil {
+		return fmt.Errorf("failed to decode save state: %w", err)
+	}
+
+	if err := m.cpu.LoadState(s.CPU); err != nil {
+		return fmt.Errorf("failed to load CPU state: %w", err)
+	}
+
+	m.applyDIPSwitches()
+
+	for addr, b := range s.Memory {
+		m.memory.Write(uint16(addr), b)
+	}
+
+	m.cycles = s.Cycles
+	m.half = s.Half
+
+	return nil
+}
+
+// Snapshot copies the CPU, memory and frame position into s.
+func (m *Machine) Snapshot(s *Snapshot) {
+	m.cpu.Snapshot(&s.cpu)
+	m.memory.Snapshot(&s.memory)
+	s.cycles = m.cycles
+	s.half = m.half
+}
+
+// Restore brings back a state copied by Snapshot, with the inputs and DIP switches of that time.
+func (m *Machine) Restore(s *Snapshot) {
+	m.cpu.Restore(&s.cpu)
+	m.memory.Restore(&s.memory)
+	m.cycles = s.cycles
+	m.half = s.half
+}
+
+func (m *Machine) writeBytes(start uint16, b []uint8) {
+	for i, v := range b {
+		m.memory.Write(start+uint16(i), v)
+	}
+}
+
+func (m *Machine) clearMemory() {
+	for addr := range memory.MEMORY_SIZE {
+		m.memory.Write(uint16(addr), 0)
+	}
+}
+
+// audioEvents records the sounds of the game, in place of an audio device.
+type audioEvents struct {
+	cpu    *cpu.CPU
+	events []AudioEvent
+}
+
+func (a *audioEvents) add(action SoundAction, sound uint8) {
+	if len(a.events) == MAX_AUDIO_EVENTS {
+		a.events = a.events[1:]
+	}
+
+	a.events = append(a.events, AudioEvent{Action: action, Sound: sound, Cycle: a.cpu.Cyc})
+}
+
+func (a *audioEvents) PlaySound(id uint8) {
+	a.add(SOUND_PLAY, id)
+}
+
+func (a *audioEvents) StartSoundLoop(id uint8) {
+	a.add(SOUND_LOOP_START, id)
+}
+
+func (a *audioEvents) StopSoundLoop(id uint8) {
+	a.add(SOUND_LOOP_STOP, id)
+}
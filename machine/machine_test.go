@@ -0,0 +1,154 @@
+package machine
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Plays sound 1, lights the first VRAM byte and loops
+var program = []uint8{
+	0x3E, 0x02, // mvi a,02h
+	0xD3, 0x03, // out 3
+	0x3E, 0xFF, // mvi a,ffh
+	0x32, 0x00, 0x24, // sta 2400h
+	0xC3, 0x09, 0x00, // jmp 0009h
+}
+
+func newMachine(t *testing.T) *Machine {
+	m := New()
+	assert.NoError(t, m.LoadProgram(program))
+
+	return m
+}
+
+func Test_Machine(t *testing.T) {
+	t.Run("frames are two halves", func(t *testing.T) {
+		m := newMachine(t)
+
+		m.RunHalfFrame()
+		assert.Equal(t, uint8(1), m.Half())
+
+		m.RunFrame()
+		assert.Equal(t, uint8(0), m.Half())
+		assert.GreaterOrEqual(t, m.Cycles(), uint64(CPU_TPS_PER_FRAME))
+
+		m.RunFrame()
+		assert.Equal(t, uint8(0), m.Half())
+		assert.GreaterOrEqual(t, m.Cycles(), uint64(CPU_TPS_PER_FRAME*2))
+	})
+
+	t.Run("audio events", func(t *testing.T) {
+		m := newMachine(t)
+		m.RunCycles(20)
+
+		events := m.AudioEvents()
+		assert.Len(t, events, 1)
+		assert.Equal(t, SOUND_PLAY, events[0].Action)
+		assert.Equal(t, uint8(1), events[0].Sound)
+		assert.Empty(t, m.AudioEvents())
+	})
+
+	t.Run("frame is upright", func(t *testing.T) {
+		m := newMachine(t)
+		m.RunFrame()
+
+		f := m.Frame()
+		assert.Equal(t, uint8(0xFF), f.GrayAt(0, HEIGHT-1).Y)
+		assert.Equal(t, uint8(0xFF), f.GrayAt(0, HEIGHT-8).Y)
+		assert.Equal(t, uint8(0), f.GrayAt(0, HEIGHT-9).Y)
+		assert.Equal(t, uint8(0), f.GrayAt(1, HEIGHT-1).Y)
+	})
+
+	t.Run("inputs", func(t *testing.T) {
+		m := newMachine(t)
+
+		assert.NoError(t, m.SetInput("coin", true))
+		assert.Equal(t, uint8(1), m.ReadPort(1)&1)
+		assert.True(t, m.Pressed("coin"))
+		assert.False(t, m.Pressed("p1_fire"))
+		assert.Error(t, m.SetInput("p3_fire", true))
+	})
+
+	t.Run("programs have no dip switches", func(t *testing.T) {
+		m := New(WithDIPSwitches([]string{"lives=5"}))
+		assert.EqualError(t, m.LoadProgram(program), "dip switch settings lives=5 cannot be applied, programs have no dip switches")
+	})
+
+	t.Run("save states", func(t *testing.T) {
+		m := newMachine(t)
+		m.RunCycles(CPU_TPS_PER_FRAME / 3)
+
+		var b bytes.Buffer
+		assert.NoError(t, m.SaveState(&b))
+
+		cycles, half := m.Cycles(), m.Half()
+
+		m.Reset()
+		m.Write(VRAM_START, 0)
+		assert.NoError(t, m.LoadState(&b))
+
+		assert.Equal(t, cycles, m.Cycles())
+		assert.Equal(t, half, m.Half())
+		assert.Equal(t, uint8(0xFF), m.Read(VRAM_START))
+	})
+
+	t.Run("snapshots", func(t *testing.T) {
+		m := newMachine(t)
+		assert.NoError(t, m.SetInput("coin", true))
+
+		var s Snapshot
+
+		m.Snapshot(&s)
+		m.RunFrame()
+		m.TakeDirty(VRAM_START)
+
+		cycles := m.Cycles()
+
+		m.Restore(&s)
+		assert.Equal(t, uint64(0), m.Cycles())
+		assert.Equal(t, uint8(0), m.Read(VRAM_START))
+		assert.True(t, m.TakeDirty(VRAM_START))
+		// Inputs are part of the snapshot
+		assert.Equal(t, uint8(1), m.ReadPort(1)&1)
+
+		m.RunFrame()
+		assert.Equal(t, cycles, m.Cycles())
+		assert.Equal(t, uint8(0xFF), m.Read(VRAM_START))
+	})
+}
+
+func Test_Movie(t *testing.T) {
+	_, err := ParseMovie([]uint8("frames: 10\ninputs:\n  - { frame: 10, input: coin, pressed: true }\n"))
+	assert.EqualError(t, err, "movie input 0: frame 10 is out of range (0-9)")
+
+	mv, err := ParseMovie([]uint8("frames: 10\ninputs:\n  - { frame: 4, input: coin, pressed: true }\n"))
+	assert.NoError(t, err)
+
+	// Replays on concurrent machines loading the same game give the same result
+	g := newGame(t)
+	cycles := make([]uint64, 4)
+
+	var wg sync.WaitGroup
+
+	for i := range cycles {
+		wg.Go(func() {
+			m := New()
+			assert.NoError(t, m.LoadGame(g))
+
+			frames, err := m.Replay(t.Context(), mv)
+			assert.NoError(t, err)
+			assert.Equal(t, 10, frames)
+			assert.Equal(t, uint8(1), m.ReadPort(1)&1)
+
+			cycles[i] = m.Cycles()
+		})
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, []uint64{cycles[0], cycles[0], cycles[0], cycles[0]}, cycles)
+	assert.GreaterOrEqual(t, cycles[0], uint64(CPU_TPS_PER_FRAME*10))
+}
@@ -0,0 +1,102 @@
+package machine
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/goccy/go-yaml"
+)
+
+// Movie is a recording of the inputs of a game from power on, replayed frame by frame. Replays are deterministic:
+// a movie gives the same result on every machine.
+type Movie struct {
+	// Game the inputs were recorded on, checked by the replay when set
+	Game string `yaml:"game"`
+	// DIP switch settings (name=setting) over the defaults of the game
+	DIPSwitches []string `yaml:"dipSwitches"`
+	// Frames run by the replay
+	Frames int `yaml:"frames"`
+	// Input changes, in frame order
+	Inputs []MovieInput `yaml:"inputs"`
+}
+
+// MovieInput presses or releases an input before a frame runs, frames start at 0.
+type MovieInput struct {
+	Frame   int    `yaml:"frame"`
+	Input   string `yaml:"input"`
+	Pressed bool   `yaml:"pressed"`
+}
+
+func ParseMovie(movieBytes []uint8) (*Movie, error) {
+	var mv Movie
+
+	if err := yaml.UnmarshalWithOptions(movieBytes, &mv, yaml.Strict()); err != nil {
+		return nil, fmt.Errorf("failed to parse movie: %w", err)
+	}
+
+	if mv.Frames <= 0 {
+		return nil, fmt.Errorf("movie frames %d must be positive", mv.Frames)
+	}
+
+	for i, in := range mv.Inputs {
+		if in.Frame < 0 || in.Frame >= mv.Frames {
+			return nil, fmt.Errorf("movie input %d: frame %d is out of range (0-%d)", i, in.Frame, mv.Frames-1)
+		}
+
+		if i > 0 && in.Frame < mv.Inputs[i-1].Frame {
+			return nil, fmt.Errorf("movie input %d: frame %d is before the frame of the previous input", i, in.Frame)
+		}
+	}
+
+	return &mv, nil
+}
+
+// Replay powers the machine on with the movie DIP switches and runs the movie frames with its inputs,
+// until the end of the movie, the CPU stops or the context is done. It returns the frames run.
+func (m *Machine) Replay(ctx context.Context, mv *Movie) (int, error) {
+	if m.game != nil && mv.Game != "" && mv.Game != m.game.Name {
+		return 0, fmt.Errorf("movie was recorded on %s, not on %s", mv.Game, m.game.Name)
+	}
+
+	if err := m.PowerOn(); err != nil {
+		return 0, err
+	}
+
+	for _, arg := range mv.DIPSwitches {
+		name, label, err := parseDIPSetting(arg)
+		if err != nil {
+			return 0, err
+		}
+
+		if err := m.SetDIPSwitch(name, label); err != nil {
+			return 0, err
+		}
+	}
+
+	for _, in := range mv.Inputs {
+		if _, ok := m.cpu.Inputs[in.Input]; !ok {
+			return 0, fmt.Errorf("movie input %s is unknown", in.Input)
+		}
+	}
+
+	inputs := mv.Inputs
+	frame := 0
+
+	for ; frame < mv.Frames && m.cpu.Running; frame++ {
+		if err := ctx.Err(); err != nil {
+			return frame, err
+		}
+
+		for len(inputs) > 0 && inputs[0].Frame == frame {
+			if err := m.SetInput(inputs[0].Input, inputs[0].Pressed); err != nil {
+				return frame, err
+			}
+
+			inputs = inputs[1:]
+		}
+
+		m.RunFrame()
+	}
+
+	return frame, nil
+}
@@ -2,13 +2,23 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"runtime"
+	"syscall"
 
+	"github.com/cterence/goarcade/env"
 	"github.com/cterence/goarcade/internal/arcade"
+	"github.com/cterence/goarcade/internal/arcade/lib"
+	"github.com/cterence/goarcade/internal/arcade/netplay"
+	"github.com/cterence/goarcade/internal/arcade/pacing"
+	"github.com/cterence/goarcade/internal/arcade/spectate"
+	"github.com/cterence/goarcade/machine"
 	"github.com/urfave/cli/v3"
 )
 
@@ -23,6 +33,10 @@ func readFiles(romPath, configPath, soundDir string) ([]uint8, []uint8, [][]uint
 		return nil, nil, nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
+	return romBytes, configBytes, readSounds(soundDir), nil
+}
+
+func readSounds(soundDir string) [][]uint8 {
 	var soundListBytes [][]uint8
 
 	if soundDir != "" {
@@ -46,7 +60,39 @@ func readFiles(romPath, configPath, soundDir string) ([]uint8, []uint8, [][]uint
 		}
 	}
 
-	return romBytes, configBytes, soundListBytes, err
+	return soundListBytes
+}
+
+// trapSignals cancels the context on interrupt, for the commands which stop with it.
+func trapSignals(ctx context.Context) (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+}
+
+// startNetplay hosts or joins a netplay game, once both players are connected.
+func startNetplay(ctx context.Context, m *machine.Machine, host, connect, protocol string, delay int) (*netplay.Session, error) {
+	if host != "" && connect != "" {
+		return nil, errors.New("--host and --connect cannot be used together")
+	}
+
+	if host != "" {
+		fmt.Printf("waiting for player 2 on %s (%s)\n", host, protocol)
+
+		s, err := netplay.Host(ctx, protocol, host, m, delay)
+		if err == nil {
+			fmt.Println("player 2 joined")
+		}
+
+		return s, err
+	}
+
+	fmt.Printf("joining %s (%s)\n", connect, protocol)
+
+	s, err := netplay.Connect(ctx, protocol, connect, m)
+	if err == nil {
+		fmt.Println("joined as player 2")
+	}
+
+	return s, err
 }
 
 func main() {
@@ -59,12 +105,29 @@ func main() {
 		soundDir      string
 		saveStatePath string
 		configPath    string
+		romDir        string
+		dipSwitches   []string
+		rotation      uint16
+		flipX         bool
+		flipY         bool
+		cocktail      bool
+		scale         int
+		monitorAspect bool
+		speed         int
+		sync          string
+		serve         string
+		host          string
+		connect       string
+		netProtocol   string
+		inputDelay    int
+		spectators    string
+		spectateAddr  string
 	)
 
 	cmd := &cli.Command{
 		Name:      "goarcade",
 		Usage:     "Intel 8080 arcade emulator",
-		ArgsUsage: "[rom path (binary file or .zip archive)]",
+		ArgsUsage: "[rom path (binary file or .zip archive), opens the launcher when omitted]",
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:        "config",
@@ -83,6 +146,14 @@ func main() {
 				Destination: &saveStatePath,
 			},
 
+			&cli.StringFlag{
+				Name:        "rom-dir",
+				Aliases:     []string{"r"},
+				Usage:       "directory of the .zip archives listed by the launcher (default: config romDir, then current directory)",
+				TakesFile:   true,
+				Destination: &romDir,
+			},
+
 			&cli.StringFlag{
 				Name:        "sound-dir",
 				Aliases:     []string{"sd"},
@@ -91,6 +162,63 @@ func main() {
 				Destination: &soundDir,
 			},
 
+			&cli.StringSliceFlag{
+				Name:        "dip",
+				Usage:       "set a dip switch, repeatable (e.g. --dip lives=5)",
+				Destination: &dipSwitches,
+			},
+
+			&cli.Uint16Flag{
+				Name:        "rotate",
+				Usage:       "turn the screen clockwise by 0, 90, 180 or 270 degrees, on top of the game rotation",
+				Destination: &rotation,
+				Validator: func(rotation uint16) error {
+					if rotation%90 != 0 || rotation >= 360 {
+						return fmt.Errorf("rotation %d is not 0, 90, 180 or 270", rotation)
+					}
+
+					return nil
+				},
+			},
+
+			&cli.BoolFlag{
+				Name:        "flip-x",
+				Usage:       "mirror the screen horizontally",
+				Destination: &flipX,
+			},
+
+			&cli.BoolFlag{
+				Name:        "flip-y",
+				Usage:       "mirror the screen vertically",
+				Destination: &flipY,
+			},
+
+			&cli.BoolFlag{
+				Name:        "cocktail",
+				Usage:       "flip the screen for player 2 like a cocktail cabinet, for games with a cocktail flip bit",
+				Destination: &cocktail,
+			},
+
+			&cli.IntFlag{
+				Name:        "scale",
+				Usage:       "window size as a multiple of the screen size",
+				DefaultText: "saved window size, then 3",
+				Destination: &scale,
+				Validator: func(scale int) error {
+					if scale < 0 {
+						return fmt.Errorf("scale %d is negative", scale)
+					}
+
+					return nil
+				},
+			},
+
+			&cli.BoolFlag{
+				Name:        "monitor-aspect",
+				Usage:       "show the screen at the 4:3 aspect of the arcade monitor instead of square pixels",
+				Destination: &monitorAspect,
+			},
+
 			&cli.BoolFlag{
 				Name:    "pprof",
 				Aliases: []string{"p"},
@@ -104,6 +232,50 @@ func main() {
 				},
 			},
 
+			&cli.StringFlag{
+				Name:        "host",
+				Usage:       "host a netplay game as player 1, waiting for player 2 on an address (e.g. :7000)",
+				Destination: &host,
+			},
+
+			&cli.StringFlag{
+				Name:        "connect",
+				Usage:       "join a netplay game as player 2 at the address of the host",
+				Destination: &connect,
+			},
+
+			&cli.StringFlag{
+				Name:        "net-protocol",
+				Usage:       "netplay protocol: udp or tcp",
+				Value:       netplay.PROTOCOL_UDP,
+				Destination: &netProtocol,
+			},
+
+			&cli.IntFlag{
+				Name:        "input-delay",
+				Usage:       fmt.Sprintf("netplay frames between an input and its frame, set by the host (0-%d)", netplay.MAX_INPUT_DELAY),
+				Value:       netplay.DEFAULT_INPUT_DELAY,
+				Destination: &inputDelay,
+			},
+
+			&cli.StringFlag{
+				Name:        "spectators",
+				Usage:       "stream the game to spectators on an address (e.g. :7001)",
+				Destination: &spectators,
+			},
+
+			&cli.StringFlag{
+				Name:        "spectate",
+				Usage:       "watch the game streamed to spectators at an address, with the same rom",
+				Destination: &spectateAddr,
+			},
+
+			&cli.StringFlag{
+				Name:        "serve",
+				Usage:       "serve the remote control API, the frame stream and the web player on an address (e.g. :8080)",
+				Destination: &serve,
+			},
+
 			&cli.BoolFlag{
 				Name:        "debug",
 				Aliases:     []string{"d"},
@@ -126,7 +298,7 @@ func main() {
 
 			&cli.BoolFlag{
 				Name:        "cpm",
-				Usage:       "run in CP/M compatibility mode (for CPU tests)",
+				Usage:       "run in CP/M compatibility mode without UI window (for CPU tests)",
 				Destination: &cpm,
 			},
 
@@ -136,13 +308,62 @@ func main() {
 				Usage:       "do not throttle cpu at 2MHz",
 				Destination: &unthrottle,
 			},
+			&cli.IntFlag{
+				Name:        "speed",
+				Usage:       fmt.Sprintf("emulation speed in percent (%d-%d)", arcade.MIN_SPEED, arcade.MAX_SPEED),
+				Value:       arcade.DEFAULT_SPEED,
+				Destination: &speed,
+				Validator:   arcade.CheckSpeed,
+			},
+			&cli.StringFlag{
+				Name:        "sync",
+				Usage:       "timing source of the emulation: clock, vsync (display refresh) or audio (audio playback)",
+				Value:       string(pacing.MODE_CLOCK),
+				Destination: &sync,
+			},
 		},
 		Action: func(ctx context.Context, cmd *cli.Command) error {
+			ctx, stop := trapSignals(ctx)
+			defer stop()
+
+			machineOptions := []machine.Option{
+				machine.WithDebug(debug),
+				machine.WithCPM(cpm),
+				machine.WithDIPSwitches(dipSwitches),
+			}
+
+			options := []arcade.Option{
+				arcade.WithDebug(debug),
+				arcade.WithMachine(machineOptions...),
+				// CP/M programs only print to the console
+				arcade.WithHeadless(headless || cpm),
+				arcade.WithMute(mute),
+				arcade.WithUnthrottle(unthrottle),
+				arcade.WithSaveState(saveStatePath),
+				arcade.WithRotation(rotation),
+				arcade.WithFlip(flipX, flipY),
+				arcade.WithCocktail(cocktail),
+				arcade.WithScale(scale),
+				arcade.WithMonitorAspect(monitorAspect),
+				arcade.WithSpeed(speed),
+				arcade.WithSync(sync),
+				arcade.WithServe(serve),
+			}
+
 			romPath := cmd.Args().First()
 
 			if romPath == "" {
-				fmt.Printf("error: no rom path given\n\n")
-				return cli.ShowSubcommandHelp(cmd)
+				if headless || host != "" || connect != "" || spectators != "" || spectateAddr != "" {
+					fmt.Printf("error: no rom path given\n\n")
+					return cli.ShowSubcommandHelp(cmd)
+				}
+
+				configBytes, err := os.ReadFile(configPath)
+				if err != nil {
+					return fmt.Errorf("failed to read config file: %w", err)
+				}
+
+				return arcade.Launch(ctx, configBytes, readSounds(soundDir), romDir, options...)
 			}
 
 			romBytes, configBytes, soundListBytes, err := readFiles(romPath, configPath, soundDir)
@@ -150,19 +371,62 @@ func main() {
 				return err
 			}
 
-			return arcade.Run(
-				ctx,
-				romBytes,
-				configBytes,
-				soundListBytes,
-				romPath,
-				arcade.WithDebug(debug),
-				arcade.WithCPM(cpm),
-				arcade.WithHeadless(headless),
-				arcade.WithMute(mute),
-				arcade.WithUnthrottle(unthrottle),
-				arcade.WithSaveState(saveStatePath),
-			)
+			m := machine.New(machineOptions...)
+
+			if err := m.Load(romBytes, configBytes, romPath); err != nil {
+				return err
+			}
+
+			switch {
+			case spectateAddr != "" && (host != "" || connect != "" || spectators != ""):
+				return errors.New("--spectate cannot be used with --host, --connect or --spectators")
+			case spectators != "" && (host != "" || connect != ""):
+				// Rollbacks would change frames already streamed
+				return errors.New("--spectators cannot be used with --host or --connect")
+			}
+
+			if host != "" || connect != "" {
+				s, err := startNetplay(ctx, m, host, connect, netProtocol, inputDelay)
+				if err != nil {
+					return err
+				}
+				defer lib.DeferErr(s.Close)
+
+				options = append(options, arcade.WithNetplay(s))
+			}
+
+			if spectateAddr != "" {
+				fmt.Printf("joining the game streamed at %s\n", spectateAddr)
+
+				v, err := spectate.Watch(ctx, spectateAddr, m)
+				if err != nil {
+					return err
+				}
+				defer lib.DeferErr(v.Close)
+
+				options = append(options, arcade.WithSpectate(v))
+			}
+
+			if spectators != "" {
+				s, err := spectate.Listen(spectators, m)
+				if err != nil {
+					return err
+				}
+				defer lib.DeferErr(s.Close)
+
+				fmt.Printf("streaming the game to spectators on %s\n", s.Addr())
+
+				options = append(options, arcade.WithSpectators(s))
+			}
+
+			err = arcade.Run(ctx, m, configBytes, soundListBytes, options...)
+			if errors.Is(err, netplay.ErrPeerLeft) || errors.Is(err, spectate.ErrEnded) {
+				fmt.Println(err)
+
+				return nil
+			}
+
+			return err
 		},
 		Commands: []*cli.Command{
 			{
@@ -186,6 +450,231 @@ func main() {
 					return arcade.Disassemble(romBytes, configBytes, romPath)
 				},
 			},
+			{
+				Name:      "env",
+				Usage:     "serve a learning environment of a game to local clients, with JSON line requests",
+				ArgsUsage: "[rom path (.zip archive)]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "listen",
+						Usage: "TCP address, or unix socket path prefixed with unix:",
+						Value: "localhost:5555",
+					},
+					&cli.StringFlag{
+						Name:  "observation",
+						Usage: "observation of the agents: frame (screen) or ram",
+						Value: string(env.OBS_FRAME),
+					},
+					&cli.IntFlag{
+						Name:  "frame-skip",
+						Usage: "frames run by each step with the action held",
+						Value: env.DEFAULT_FRAME_SKIP,
+					},
+					&cli.IntFlag{
+						Name:  "max-frames",
+						Usage: "truncate the episodes after a number of frames, 0 for no limit",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					romPath := cmd.Args().First()
+
+					if romPath == "" {
+						fmt.Printf("error: no rom path given\n\n")
+						return cli.ShowSubcommandHelp(cmd)
+					}
+
+					romBytes, configBytes, _, err := readFiles(romPath, configPath, "")
+					if err != nil {
+						return err
+					}
+
+					envOptions := []env.Option{
+						env.WithObservation(env.Observation(cmd.String("observation"))),
+						env.WithFrameSkip(cmd.Int("frame-skip")),
+						env.WithMaxFrames(cmd.Int("max-frames")),
+					}
+
+					newEnv := func() (*env.Env, error) {
+						m := machine.New(machine.WithDIPSwitches(dipSwitches))
+
+						if err := m.Load(romBytes, configBytes, romPath); err != nil {
+							return nil, err
+						}
+
+						return env.New(m, envOptions...)
+					}
+
+					// Fail before listening when the game has no env definition
+					if _, err := newEnv(); err != nil {
+						return err
+					}
+
+					ctx, stop := trapSignals(ctx)
+					defer stop()
+
+					ln, err := env.Listen(cmd.String("listen"))
+					if err != nil {
+						return fmt.Errorf("failed to listen: %w", err)
+					}
+
+					fmt.Printf("serving %s env on %s\n", romPath, ln.Addr())
+
+					return env.Serve(ctx, ln, newEnv)
+				},
+			},
+			{
+				Name:      "batch",
+				Usage:     "replay movies headless on many instances in parallel, and compare their results",
+				ArgsUsage: "[rom path (binary file or .zip archive)] [movie paths...]",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:  "instances",
+						Usage: "instances replaying each movie",
+						Value: 1,
+					},
+					&cli.IntFlag{
+						Name:  "jobs",
+						Usage: "instances running at once",
+						Value: runtime.NumCPU(),
+					},
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "print the result of each instance as a JSON line",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					romPath := cmd.Args().First()
+
+					if romPath == "" || cmd.NArg() < 2 {
+						fmt.Printf("error: no rom path or movie path given\n\n")
+						return cli.ShowSubcommandHelp(cmd)
+					}
+
+					romBytes, configBytes, _, err := readFiles(romPath, configPath, "")
+					if err != nil {
+						return err
+					}
+
+					var movies []arcade.BatchMovie
+
+					for _, path := range cmd.Args().Tail() {
+						movieBytes, err := os.ReadFile(path)
+						if err != nil {
+							return fmt.Errorf("failed to read movie file: %w", err)
+						}
+
+						mv, err := machine.ParseMovie(movieBytes)
+						if err != nil {
+							return fmt.Errorf("%s: %w", path, err)
+						}
+
+						movies = append(movies, arcade.BatchMovie{Path: path, Movie: mv})
+					}
+
+					ctx, stop := trapSignals(ctx)
+					defer stop()
+
+					machineOptions := []machine.Option{
+						machine.WithCPM(cpm),
+						machine.WithDIPSwitches(dipSwitches),
+					}
+
+					o := arcade.BatchOptions{
+						Instances: cmd.Int("instances"),
+						Jobs:      cmd.Int("jobs"),
+						JSON:      cmd.Bool("json"),
+						Output:    os.Stdout,
+						Stats:     os.Stderr,
+						Machine:   machineOptions,
+					}
+
+					var game *machine.Game
+
+					if filepath.Ext(romPath) == ".zip" {
+						game, err = machine.OpenGame(romBytes, configBytes, romPath)
+						if err != nil {
+							return err
+						}
+					} else {
+						o.Program = romBytes
+					}
+
+					return arcade.Batch(ctx, game, movies, o)
+				},
+			},
+			{
+				Name:    "list",
+				Aliases: []string{"l"},
+				Usage:   "list supported games and their required files",
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					configBytes, err := os.ReadFile(configPath)
+					if err != nil {
+						return fmt.Errorf("failed to read config file: %w", err)
+					}
+
+					return arcade.List(os.Stdout, configBytes)
+				},
+			},
+			{
+				Name:  "config",
+				Usage: "manage the game specs config file",
+				Commands: []*cli.Command{
+					{
+						Name:  "check",
+						Usage: "report every problem of the config file",
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							configBytes, err := os.ReadFile(configPath)
+							if err != nil {
+								return fmt.Errorf("failed to read config file: %w", err)
+							}
+
+							return arcade.CheckConfig(configBytes, configPath)
+						},
+					},
+					{
+						Name:      "import",
+						Usage:     "import game specs from a MAME -listxml file into the config file",
+						ArgsUsage: "[mame xml path]",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "dry-run",
+								Usage: "print the merged config instead of writing the config file",
+							},
+						},
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							xmlPath := cmd.Args().First()
+
+							if xmlPath == "" {
+								fmt.Printf("error: no mame xml path given\n\n")
+								return cli.ShowSubcommandHelp(cmd)
+							}
+
+							return arcade.ImportMAME(configPath, xmlPath, cmd.Bool("dry-run"))
+						},
+					},
+				},
+			},
+			{
+				Name:      "verify",
+				Aliases:   []string{"v"},
+				Usage:     "verify the .zip archives of a rom directory",
+				ArgsUsage: "[rom directory path]",
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					romDir := cmd.Args().First()
+
+					if romDir == "" {
+						fmt.Printf("error: no rom directory given\n\n")
+						return cli.ShowSubcommandHelp(cmd)
+					}
+
+					configBytes, err := os.ReadFile(configPath)
+					if err != nil {
+						return fmt.Errorf("failed to read config file: %w", err)
+					}
+
+					return arcade.Verify(os.Stdout, configBytes, romDir)
+				},
+			},
 		},
 	}
 